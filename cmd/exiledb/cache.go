@@ -0,0 +1,370 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jchantrell/exiledb/internal/bundle"
+	"github.com/jchantrell/exiledb/internal/cache"
+	"github.com/spf13/cobra"
+)
+
+var (
+	verifyRemove      bool
+	pruneKeep         int
+	pruneOlderThan    string
+	pruneUnreferenced bool
+	pruneDryRun       bool
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspect and clean up the bundle cache",
+	Long: `Extract keeps the index and bundles it downloads under ~/.exiledb/cache,
+one directory per patch, and does not delete them itself. Bundles that are
+identical between patches are stored once, in the cache's objects directory,
+and linked into each patch that has them. These commands show what the cache
+holds, check it for damaged bundles and remove what is no longer needed.`,
+}
+
+var cacheLsCmd = &cobra.Command{
+	Use:   "ls [patch]",
+	Short: "List cached patches, or the files of one patch",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := cache.New()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		defer w.Flush()
+
+		if len(args) == 1 {
+			files, err := c.PatchFiles(args[0])
+			if err != nil {
+				return err
+			}
+			for _, f := range files {
+				shared := ""
+				if f.Stored {
+					shared = "shared"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\n", formatSize(f.Size), f.Name, shared)
+			}
+			return nil
+		}
+
+		patches, err := c.Patches()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "PATCH\tFILES\tSIZE\tSHARED\tLAST USED")
+		for _, p := range patches {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", p.Patch, p.Files, formatSize(p.Size), formatSize(p.Stored), p.LastUsed.Format(time.DateTime))
+		}
+		return nil
+	},
+}
+
+var cacheDuCmd = &cobra.Command{
+	Use:   "du",
+	Short: "Show disk usage of the cache per patch",
+	Long: `Du shows the space each patch takes of its own, and that of the bundles
+patches share through the object store, which count once towards the total.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := cache.New()
+		if err != nil {
+			return err
+		}
+		patches, err := c.Patches()
+		if err != nil {
+			return err
+		}
+		objects, err := c.Objects()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		defer w.Flush()
+		var total int64
+		for _, p := range patches {
+			fmt.Fprintf(w, "%s\t%s\n", formatSize(p.Size-p.Stored), p.Patch)
+			total += p.Size - p.Stored
+		}
+		var stored int64
+		for _, o := range objects {
+			stored += o.Size
+		}
+		fmt.Fprintf(w, "%s\t%s\n", formatSize(stored), "shared bundles")
+		total += stored
+		if info, err := os.Stat(c.SchemaPath()); err == nil {
+			fmt.Fprintf(w, "%s\t%s\n", formatSize(info.Size()), "schema")
+			total += info.Size()
+		}
+		archived, err := c.ArchivedSchemas()
+		if err != nil {
+			return err
+		}
+		var archivedSize int64
+		for _, a := range archived {
+			if info, err := os.Stat(a.Path); err == nil {
+				archivedSize += info.Size()
+			}
+		}
+		if len(archived) > 0 {
+			fmt.Fprintf(w, "%s\t%s\n", formatSize(archivedSize), fmt.Sprintf("archived schemas (%d)", len(archived)))
+			total += archivedSize
+		}
+		fmt.Fprintf(w, "%s\t%s\n", formatSize(total), "total")
+		return nil
+	},
+}
+
+var cacheDedupeCmd = &cobra.Command{
+	Use:   "dedupe [patch...]",
+	Short: "Share identical bundles between cached patches",
+	Long: `Extract stores bundles it downloads once, however many patches have them.
+Dedupe does the same for bundles downloaded before the cache worked that way,
+in the given patches (all cached patches by default).`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := cache.New()
+		if err != nil {
+			return err
+		}
+		patches := args
+		if len(patches) == 0 {
+			usage, err := c.Patches()
+			if err != nil {
+				return err
+			}
+			// Oldest first, so the store fills in the order patches came.
+			for i := len(usage) - 1; i >= 0; i-- {
+				patches = append(patches, usage[i].Patch)
+			}
+		}
+
+		out := cmd.OutOrStdout()
+		var total int64
+		for _, patch := range patches {
+			saved, err := c.Dedupe(patch)
+			if err != nil {
+				return fmt.Errorf("deduplicating %s: %w", patch, err)
+			}
+			fmt.Fprintf(out, "%s: %s shared with other patches\n", patch, formatSize(saved))
+			total += saved
+		}
+		fmt.Fprintf(out, "Freed %s in total\n", formatSize(total))
+		return nil
+	},
+}
+
+var cacheVerifyCmd = &cobra.Command{
+	Use:   "verify [patch...]",
+	Short: "Check cached bundles against their patch's index",
+	Long: `Verify opens every cached bundle of the given patches (all cached patches by
+default) and checks its header and sizes against the patch's index. Bundles
+that were never downloaded are not an error. With --remove, damaged bundles
+are deleted so the next extract downloads them again.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := cache.New()
+		if err != nil {
+			return err
+		}
+		patches := args
+		if len(patches) == 0 {
+			usage, err := c.Patches()
+			if err != nil {
+				return err
+			}
+			for _, p := range usage {
+				patches = append(patches, p.Patch)
+			}
+		}
+
+		out := cmd.OutOrStdout()
+		corrupt := 0
+		for _, patch := range patches {
+			if _, err := os.Stat(c.IndexPath(patch)); errors.Is(err, fs.ErrNotExist) {
+				fmt.Fprintf(out, "%s: no cached index, skipped\n", patch)
+				continue
+			}
+			report, err := bundle.VerifyCache(cmd.Context(), c, patch, nil)
+			if err != nil {
+				return fmt.Errorf("verifying %s: %w", patch, err)
+			}
+			fmt.Fprintf(out, "%s: %d of %d bundles cached, %d damaged\n", patch, report.Cached, report.Bundles, len(report.Corrupt))
+			for _, b := range report.Corrupt {
+				fmt.Fprintf(out, "  %s: %v\n", b.Name, b.Err)
+				if verifyRemove {
+					if err := os.Remove(b.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+						return fmt.Errorf("removing damaged bundle: %w", err)
+					}
+				}
+			}
+			corrupt += len(report.Corrupt)
+		}
+
+		if corrupt > 0 && !verifyRemove {
+			return fmt.Errorf("%d damaged bundles (use --remove to delete them)", corrupt)
+		}
+		return nil
+	},
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove old patches or unreferenced bundles from the cache",
+	Long: `Prune removes cached patches beyond the --keep most recently used, or unused
+for longer than --older-than (such as 720h or 30d). With --unreferenced it
+also removes files in each remaining patch that its index does not name, such
+as leftovers of interrupted downloads. Shared bundles no patch links to any
+more are removed as well. Use --dry-run to see what would go.`,
+	Example: `  exiledb cache prune --keep 2
+  exiledb cache prune --older-than 30d --unreferenced --dry-run`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if pruneKeep <= 0 && pruneOlderThan == "" && !pruneUnreferenced {
+			return fmt.Errorf("nothing to prune: use --keep, --older-than or --unreferenced")
+		}
+		olderThan, err := parseAge(pruneOlderThan)
+		if err != nil {
+			return err
+		}
+
+		c, err := cache.New()
+		if err != nil {
+			return err
+		}
+		patches, err := c.Patches()
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		verb := "Removed"
+		if pruneDryRun {
+			verb = "Would remove"
+		}
+		var freed int64
+		stale := make(map[string]bool)
+		removed := make(map[string]bool) // patch/name of unreferenced files
+		for _, p := range cache.SelectStale(patches, pruneKeep, olderThan, time.Now()) {
+			stale[p.Patch] = true
+			if !pruneDryRun {
+				if err := c.RemovePatch(p.Patch); err != nil {
+					return err
+				}
+			}
+			fmt.Fprintf(out, "%s %s (%s, last used %s)\n", verb, p.Patch, formatSize(p.Size-p.Stored), p.LastUsed.Format(time.DateTime))
+			freed += p.Size - p.Stored
+		}
+
+		if pruneUnreferenced {
+			for _, p := range patches {
+				if stale[p.Patch] {
+					continue
+				}
+				index, err := bundle.LoadIndex(bundle.NewCacheSource(c, p.Patch))
+				if err != nil {
+					fmt.Fprintf(out, "Skipping %s: %v\n", p.Patch, err)
+					continue
+				}
+				var names []string
+				for _, b := range index.Bundles() {
+					names = append(names, b.Name)
+				}
+				files, err := c.Unreferenced(p.Patch, names)
+				if err != nil {
+					return err
+				}
+				for _, f := range files {
+					removed[p.Patch+"/"+f.Name] = true
+					if !pruneDryRun {
+						if err := c.RemoveFile(p.Patch, f.Name); err != nil {
+							return err
+						}
+					}
+					fmt.Fprintf(out, "%s %s/%s (%s)\n", verb, p.Patch, f.Name, formatSize(f.Size))
+					if !f.Stored {
+						freed += f.Size
+					}
+				}
+			}
+		}
+
+		// A dry run removed nothing, so count what it would have as gone.
+		unused, err := c.UnusedObjects(func(patch, name string) bool {
+			return stale[patch] || removed[patch+"/"+name]
+		})
+		if err != nil {
+			return err
+		}
+		var sharedFreed int64
+		for _, o := range unused {
+			if !pruneDryRun {
+				if err := c.RemoveObject(o); err != nil {
+					return err
+				}
+			}
+			sharedFreed += o.Size
+		}
+		if len(unused) > 0 {
+			fmt.Fprintf(out, "%s %d shared bundles no patch uses (%s)\n", verb, len(unused), formatSize(sharedFreed))
+			freed += sharedFreed
+		}
+
+		fmt.Fprintf(out, "%s %s in total\n", verb, formatSize(freed))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheLsCmd, cacheDuCmd, cacheDedupeCmd, cacheVerifyCmd, cachePruneCmd)
+	cacheVerifyCmd.Flags().BoolVar(&verifyRemove, "remove", false, "delete damaged bundles")
+	cachePruneCmd.Flags().IntVar(&pruneKeep, "keep", 0, "keep only this many most recently used patches")
+	cachePruneCmd.Flags().StringVar(&pruneOlderThan, "older-than", "", "remove patches unused for longer than this (e.g. 720h, 30d)")
+	cachePruneCmd.Flags().BoolVar(&pruneUnreferenced, "unreferenced", false, "remove files the patch's index does not reference")
+	cachePruneCmd.Flags().BoolVar(&pruneDryRun, "dry-run", false, "list what would be removed without removing it")
+}
+
+// parseAge parses a duration, additionally accepting whole days as 30d.
+func parseAge(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid age %q: %w", s, err)
+	}
+	return d, nil
+}
+
+// formatSize renders a byte count in binary units, as du -h does.
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jchantrell/exiledb/internal/cdn"
+	"github.com/jchantrell/exiledb/internal/diff"
+	"github.com/jchantrell/exiledb/internal/extract"
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffFrom   string
+	diffTo     string
+	diffFormat string
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare table rows between two patches",
+	Long: `Diff parses the selected tables from two patches with the community schema
+and reports rows that were added, removed or changed, with the before and
+after value of every changed column.
+
+Rows are matched on their Id column (or another unique string column) when
+the table has one, and on row index otherwise. --languages selects which
+languages to compare (default English).
+
+Output formats: text (default), json, markdown.`,
+	Example: `  exiledb diff --from 4.4.0.12 --to 4.4.0.13 --tables Mods,Stats
+  exiledb diff --from 4.4.0.12 --to 4.4.0.13 --tables Mods --format markdown > mods.md`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		from, err := cdn.ResolvePatch(cmd.Context(), diffFrom)
+		if err != nil {
+			return err
+		}
+		to, err := cdn.ResolvePatch(cmd.Context(), diffTo)
+		if err != nil {
+			return err
+		}
+		diffs, err := extract.DiffPatches(cmd.Context(), cfg, from, to)
+		if err != nil {
+			return err
+		}
+		return diff.Write(os.Stdout, diffFormat, diffs)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().StringVar(&diffFrom, "from", "", "patch version to compare from, or latest / latest-poe2")
+	diffCmd.Flags().StringVar(&diffTo, "to", "", "patch version to compare to, or latest / latest-poe2")
+	diffCmd.Flags().StringVar(&diffFormat, "format", "text", fmt.Sprintf("output format (%s)", strings.Join(diff.Formats, ", ")))
+	diffCmd.MarkFlagRequired("from")
+	diffCmd.MarkFlagRequired("to")
+}
@@ -1,15 +1,29 @@
 package main
 
 import (
+	"fmt"
 	"log/slog"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/jchantrell/exiledb/internal/extract"
+	"github.com/jchantrell/exiledb/internal/output"
 	"github.com/jchantrell/exiledb/internal/ui"
 	"github.com/spf13/cobra"
 )
 
-var forceDownload bool
+var (
+	forceDownload bool
+	replaceTables bool
+	resumeExtract bool
+	multiPatch    bool
+	outputFormat  string
+	outputDir     string
+	createViews   bool
+	withRefs      int
+	dryRun        bool
+)
 
 var extractCmd = &cobra.Command{
 	Use:   "extract",
@@ -17,8 +31,69 @@ var extractCmd = &cobra.Command{
 	Long: `Extract downloads Path of Exile game bundles from CDN servers and
 extracts DAT files into a queryable SQLite database.
 
-Use --ggpk to extract directly from a Content.ggpk file instead of downloading from CDN.`,
+Extracting into an existing database adds the selected tables, or new
+languages of tables it already holds, in place. If a selected table already
+holds a requested language, or no longer fits the schema, the extract stops
+before writing anything and lists every such table; rerun with --replace to
+re-extract them.
+
+Each table and language is committed, and recorded in the database, as it
+is inserted. If an extract is interrupted, rerun it with --resume to skip
+what it completed: tables and languages it left half written are cleared
+and inserted again.
+
+Use --with-references to also extract every table the selected tables
+reference through foreign keys, and the tables those reference, until none
+are left; --with-references=1 stops at the tables referenced directly. Add
+--dry-run to list the tables an extract would write, and the reference that
+pulled each one in, without downloading or writing anything.
+
+Use --multi-patch to keep several patches in one database: every table gains
+a _patch column, keys and references are scoped by patch, and each extract
+with a different --patch adds its rows alongside the others. Tables keep
+every column of the schema, null in patches that no longer have it.
+
+Use --views to also create a <table>_resolved view over every table in the
+database. Views add the referenced row's id and name next to each foreign
+key (stat1 -> stat1_id, stat1_name) and turn junction tables back into JSON
+arrays on the row (families, families_id). They are rebuilt on every extract
+with --views, so they follow tables added later.
+
+Pass a postgres:// URL as --database to load into PostgreSQL instead. Tables
+go into the schema named by the URL's search_path parameter, created if
+missing, and are bulk loaded with COPY. Foreign keys are not declared there;
+like SQLite's, they are checked after the load and violations are logged.
+
+Use --format parquet, ndjson or csv with --out to write one file per table
+and language, <out>/<language>/<table>.<format>, instead of a database.
+Columns are named as in SQLite. Arrays, including those SQLite keeps in
+junction tables, stay on the row: Parquet lists, NDJSON arrays, or JSON
+strings in CSV. Parquet records foreign keys in the file metadata, as
+exiledb.references.<column>, and in column metadata.
+
+Use --ggpk to extract directly from a Content.ggpk file, or --game-dir to read
+the Bundles2 directory of a Steam or Epic install, instead of downloading from CDN.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if withRefs < extract.AllReferences {
+			return fmt.Errorf("--with-references takes a depth of 0 or more, or no value for all references")
+		}
+		if err := resolvePatch(cmd); err != nil {
+			return err
+		}
+		opts := extract.Options{
+			ForceDownload:  forceDownload,
+			Replace:        replaceTables,
+			Resume:         resumeExtract,
+			MultiPatch:     multiPatch,
+			Format:         outputFormat,
+			OutDir:         outputDir,
+			Views:          createViews,
+			WithReferences: withRefs,
+		}
+		if dryRun {
+			return printSelectedTables(cmd, opts)
+		}
+
 		noProgress, _ := cmd.Flags().GetBool("no-progress")
 		showProgress := !(noProgress || cfg.LogFormat == "json" || cfg.LogLevel == "debug")
 
@@ -29,10 +104,8 @@ Use --ggpk to extract directly from a Content.ggpk file instead of downloading f
 
 		slog.Info("Starting extract...", "languages", cfg.Languages)
 
-		stats, err := extract.Run(cmd.Context(), cfg, extract.Options{
-			ForceDownload: forceDownload,
-			Progress:      progress.Phase,
-		})
+		opts.Progress = progress.Phase
+		stats, err := extract.Run(cmd.Context(), cfg, opts)
 		if stats != nil {
 			stats.Report(os.Stdout)
 		}
@@ -43,4 +116,31 @@ Use --ggpk to extract directly from a Content.ggpk file instead of downloading f
 func init() {
 	rootCmd.AddCommand(extractCmd)
 	extractCmd.Flags().BoolVar(&forceDownload, "force", false, "Force re-download bundles even if cached")
+	extractCmd.Flags().BoolVar(&replaceTables, "replace", false, "Re-extract selected tables that already exist in the database")
+	extractCmd.Flags().BoolVar(&resumeExtract, "resume", false, "Continue an interrupted extract, skipping tables and languages it completed")
+	extractCmd.Flags().BoolVar(&multiPatch, "multi-patch", false, "Scope rows by a _patch column so one database holds several patches")
+	extractCmd.Flags().BoolVar(&createViews, "views", false, "Create <table>_resolved views that resolve foreign keys to id and name")
+	extractCmd.Flags().IntVar(&withRefs, "with-references", 0, "Also extract tables the selected tables reference, up to this many references away (no value: all)")
+	extractCmd.Flags().Lookup("with-references").NoOptDefVal = strconv.Itoa(extract.AllReferences)
+	extractCmd.Flags().BoolVar(&dryRun, "dry-run", false, "List the tables that would be extracted and exit")
+	extractCmd.Flags().StringVar(&outputFormat, "format", extract.FormatSQLite, "Output format: sqlite, or "+strings.Join(output.Formats, ", ")+" to write table files")
+	extractCmd.Flags().StringVar(&outputDir, "out", "", "Directory for table files when --format is not sqlite")
+}
+
+// printSelectedTables lists the tables an extract would write, one per line,
+// with the reference that pulled in each table --tables did not pick.
+func printSelectedTables(cmd *cobra.Command, opts extract.Options) error {
+	selected, err := extract.SelectTables(cmd.Context(), cfg, opts)
+	if err != nil {
+		return err
+	}
+	out := cmd.OutOrStdout()
+	for _, table := range selected {
+		if table.Via == "" {
+			fmt.Fprintln(out, table.Name)
+		} else {
+			fmt.Fprintf(out, "%s\tvia %s (depth %d)\n", table.Name, table.Via, table.Depth)
+		}
+	}
+	return nil
 }
@@ -17,8 +17,12 @@ var listCmd = &cobra.Command{
 	Long: `List files and directories at a given path within the game bundle index.
 Only downloads the index file — no bundles are fetched.
 
-Use --ggpk to list from a Content.ggpk file instead of downloading from CDN.`,
+Use --ggpk to list from a Content.ggpk file, or --game-dir from the Bundles2
+directory of a Steam or Epic install, instead of downloading from CDN.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := resolvePatch(cmd); err != nil {
+			return err
+		}
 		index, err := extract.LoadIndex(cmd.Context(), cfg)
 		if err != nil {
 			return err
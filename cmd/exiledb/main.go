@@ -6,9 +6,12 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
+	"github.com/jchantrell/exiledb/internal/cdn"
 	"github.com/jchantrell/exiledb/internal/config"
+	"github.com/jchantrell/exiledb/internal/database"
 	"github.com/jchantrell/exiledb/internal/ui"
 	"github.com/jchantrell/exiledb/internal/version"
 	"github.com/lmittmann/tint"
@@ -21,6 +24,13 @@ var cfg *config.Config
 // them into cfg after Cobra has parsed the command line.
 var flagValues config.Config
 
+// configPath and profileName select the project config file and the profile
+// in it whose settings fill flags not given on the command line.
+var (
+	configPath  string
+	profileName string
+)
+
 // logOutput is the destination for all log output. Commands that render
 // progress bars swap it to the bar container so log lines print above live
 // bars instead of through them.
@@ -38,6 +48,15 @@ and processes them according to the latest schema to create a local database.`,
 		values := flagValues
 		cfg = &values
 
+		skipConfig := cmd.Name() == "version"
+		configFile := ""
+		if !skipConfig {
+			var err error
+			if configFile, err = applyConfigFile(cmd, cfg); err != nil {
+				return err
+			}
+		}
+
 		var level slog.Level
 		switch cfg.LogLevel {
 		case "debug":
@@ -64,8 +83,11 @@ and processes them according to the latest schema to create a local database.`,
 		}
 
 		slog.SetDefault(slog.New(handler))
+		cdn.SetOffline(cfg.Offline)
 
-		if cmd.Name() == "version" || cmd.Name() == "upgrade" {
+		// Upgrade takes its offline setting and logging from the config,
+		// but no patch.
+		if skipConfig || cmd.Name() == "upgrade" {
 			return nil
 		}
 
@@ -73,12 +95,19 @@ and processes them according to the latest schema to create a local database.`,
 			return err
 		}
 
+		cdn.SetBaseURLs(cfg.CDNURLs())
+
 		slog.Debug("Configuration",
+			"config_file", configFile,
+			"profile", profileName,
 			"patch", cfg.Patch,
-			"database", cfg.Database,
+			"database", database.Redacted(cfg.Database),
 			"languages", cfg.Languages,
 			"tables", cfg.Tables,
 			"files", cfg.Files,
+			"game_dir", cfg.GameDir,
+			"offline", cfg.Offline,
+			"cdn_url", cfg.CDNURL,
 			"log_level", cfg.LogLevel,
 			"log_format", cfg.LogFormat)
 
@@ -86,6 +115,50 @@ and processes them according to the latest schema to create a local database.`,
 	},
 }
 
+// resolvePatch replaces a latest keyword in cfg.Patch with the version the
+// patch server serves. Only commands that read cfg.Patch call it, so the
+// others neither contact the patch server nor fail offline over a patch
+// they do not use.
+func resolvePatch(cmd *cobra.Command) error {
+	patch, err := cdn.ResolvePatch(cmd.Context(), cfg.Patch)
+	if err != nil {
+		return err
+	}
+	cfg.Patch = patch
+	return nil
+}
+
+// applyConfigFile fills cfg from --config, or the exiledb.toml or
+// exiledb.yaml nearest the working directory, leaving flags given on the
+// command line as they are. It returns the file used, if any.
+func applyConfigFile(cmd *cobra.Command, cfg *config.Config) (string, error) {
+	path := configPath
+	if path == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("finding config file: %w", err)
+		}
+		if path, err = config.FindFile(wd); err != nil {
+			return "", err
+		}
+	}
+	if path == "" {
+		if profileName != "" {
+			return "", fmt.Errorf("profile %q requested but no %s found", profileName, strings.Join(config.FileNames, " or "))
+		}
+		return "", nil
+	}
+
+	file, err := config.LoadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if err := file.Apply(cfg, profileName, cmd.Flags().Changed); err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	return path, nil
+}
+
 func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
@@ -99,14 +172,21 @@ func main() {
 func init() {
 	rootCmd.Version = version.Get()
 	flags := rootCmd.PersistentFlags()
-	flags.StringVarP(&flagValues.Patch, "patch", "p", "", "patch version to use")
-	flags.StringVarP(&flagValues.Database, "database", "d", "exile.db", "database file path")
-	flags.StringSliceVar(&flagValues.Tables, "tables", nil, "comma-separated list of tables to extract")
+	flags.StringVarP(&flagValues.Patch, "patch", "p", "", "patch version to use, or latest (PoE1) or latest-poe2 to ask the patch server")
+	flags.StringVarP(&flagValues.Database, "database", "d", "exile.db", "database file path, or postgres:// URL to load into PostgreSQL")
+	flags.StringSliceVar(&flagValues.Tables, "tables", nil, "comma-separated tables to extract: names, globs (Passive*), tag:<tag>, all, and -<term> to exclude")
 	flags.StringSliceVar(&flagValues.Files, "files", nil, "comma-separated list of files to extract")
 	flags.StringSliceVar(&flagValues.Languages, "languages", []string{"English"}, "comma-separated list of languages to extract")
 	flags.StringVar(&flagValues.LogLevel, "log-level", "info", "log level (debug, info, warn, error)")
 	flags.StringVar(&flagValues.LogFormat, "log-format", "text", "log format (text, json)")
 	flags.Bool("no-progress", false, "disable progress bar")
 	flags.StringVar(&flagValues.GgpkPath, "ggpk", "", "path to Content.ggpk file (reads from GGPK instead of CDN)")
+	flags.StringVar(&flagValues.GameDir, "game-dir", "", "path to an installed game (Steam or Epic) with a Bundles2 directory to read instead of CDN")
 	flags.StringVar(&flagValues.SchemaPath, "schema", "", "path to a local schema.min.json (default: download latest release)")
+	flags.IntVar(&flagValues.SchemaVersion, "schema-version", 0, "use the newest archived schema with this format version, which moves as schemas are archived; only --schema-at pins one reproducibly")
+	flags.StringVar(&flagValues.SchemaAt, "schema-at", "", "use the newest archived schema created at or before this date or time")
+	flags.StringVar(&flagValues.CDNURL, "cdn-url", "", "base URL of a CDN mirror to download from instead of the official CDN")
+	flags.BoolVar(&flagValues.Offline, "offline", false, "never access the network: use only cached downloads and local files, and list what is missing")
+	flags.StringVar(&configPath, "config", "", "path to a config file (default: exiledb.toml or exiledb.yaml in the working directory or a parent)")
+	flags.StringVar(&profileName, "profile", "", "named profile in the config file to apply")
 }
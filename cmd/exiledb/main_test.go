@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jchantrell/exiledb/internal/cdn"
+)
+
+// executeRoot runs the root command with args, discarding its output, and
+// resets the global state a run leaves behind.
+func executeRoot(t *testing.T, args ...string) error {
+	t.Helper()
+	t.Cleanup(func() {
+		cdn.SetOffline(false)
+		configPath = ""
+		rootCmd.SetArgs(nil)
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+	})
+	rootCmd.SetOut(io.Discard)
+	rootCmd.SetErr(io.Discard)
+	rootCmd.SetArgs(args)
+	return rootCmd.ExecuteContext(context.Background())
+}
+
+// TestCacheLatestPatchOffline runs a cache command with a latest patch and
+// offline set in the config: cache commands do not read the patch, so they
+// must not try to resolve it.
+func TestCacheLatestPatchOffline(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.MkdirAll(filepath.Join(home, ".exiledb", "cache"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "exiledb.toml")
+	if err := os.WriteFile(path, []byte("patch = \"latest\"\noffline = true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := executeRoot(t, "cache", "ls", "--config", path); err != nil {
+		t.Errorf("cache ls with a latest patch offline = %v, want no error", err)
+	}
+}
@@ -24,8 +24,12 @@ Use --stats to emit per-dat-table structural metrics and a content hash as
 JSONL (one object per line), suitable for diffing dat changes between patches.
 --stats honors --languages (default English), scoping to that language's dat
 files; English is the master data and indicative of genuine table changes.
-Use --ggpk to read from a Content.ggpk file instead of downloading from CDN.`,
+Use --ggpk to read from a Content.ggpk file, or --game-dir from the Bundles2
+directory of a Steam or Epic install, instead of downloading from CDN.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := resolvePatch(cmd); err != nil {
+			return err
+		}
 		stats, err := cmd.Flags().GetBool("stats")
 		if err != nil {
 			return err
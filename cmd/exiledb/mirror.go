@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/jchantrell/exiledb/internal/extract"
+	"github.com/jchantrell/exiledb/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var (
+	mirrorDir     string
+	mirrorBundles []string
+	mirrorForce   bool
+)
+
+var mirrorCmd = &cobra.Command{
+	Use:   "mirror",
+	Short: "Copy a patch's bundles into a directory laid out like the CDN",
+	Long: `Mirror downloads a patch's index and bundles and writes them to --out as
+<out>/<patch>/Bundles2/..., the layout of the official CDN. Serve the
+directory with any static file server and point other machines at it with
+--cdn-url, or cdn_url in a config file.
+
+All bundles are mirrored unless --bundles names some, by name or glob.
+Files already in the mirror are kept, so rerunning for the same patch only
+adds what is missing.`,
+	Example: `  exiledb mirror --patch 4.4.0.13 --out /srv/poecdn
+  exiledb mirror --patch latest-poe2 --out /srv/poecdn --bundles 'Folders/data*'
+  exiledb extract --cdn-url http://mirror.internal/poecdn --patch 4.4.0.13`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if cfg.Patch == "" {
+			return fmt.Errorf("mirror needs --patch")
+		}
+		if err := resolvePatch(cmd); err != nil {
+			return err
+		}
+
+		noProgress, _ := cmd.Flags().GetBool("no-progress")
+		showProgress := !(noProgress || cfg.LogFormat == "json" || cfg.LogLevel == "debug")
+
+		progress := ui.NewProgress(showProgress)
+		logOutput.Swap(progress.LogWriter())
+		defer progress.Close()
+		defer logOutput.Swap(os.Stderr)
+
+		stats, err := extract.Mirror(cmd.Context(), cfg, extract.MirrorOptions{
+			Dir:           mirrorDir,
+			Bundles:       mirrorBundles,
+			ForceDownload: mirrorForce,
+			Progress:      progress.Phase,
+		})
+		if err != nil {
+			return err
+		}
+		slog.Info("Mirror complete", "patch", cfg.Patch, "bundles", stats.Bundles, "added", stats.Copied, "size", formatSize(stats.Size))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mirrorCmd)
+	mirrorCmd.Flags().StringVar(&mirrorDir, "out", "", "Directory to write the mirror to")
+	mirrorCmd.Flags().StringSliceVar(&mirrorBundles, "bundles", nil, "Comma-separated bundle names or globs to mirror (default: all)")
+	mirrorCmd.Flags().BoolVar(&mirrorForce, "force", false, "Re-download bundles and rewrite files already in the mirror")
+	mirrorCmd.MarkFlagRequired("out")
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 
+	"github.com/jchantrell/exiledb/internal/cdn"
 	"github.com/jchantrell/exiledb/internal/upgrade"
 	"github.com/jchantrell/exiledb/internal/version"
 	"github.com/spf13/cobra"
@@ -14,8 +15,12 @@ var upgradeCmd = &cobra.Command{
 	Use:   "upgrade",
 	Short: "Upgrade exiledb to the latest release",
 	Long: `Check GitHub for the latest exiledb release and replace the current
-binary with it if a newer version is available.`,
+binary with it if a newer version is available. It does not run offline,
+whether --offline is passed or set in the config file.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if cdn.Offline() {
+			return fmt.Errorf("upgrade checks GitHub for releases and cannot run offline")
+		}
 		current := version.Get()
 		if current == "dev" {
 			return fmt.Errorf("this binary was built from source without version information; upgrade with git pull or go install")
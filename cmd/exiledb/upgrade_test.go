@@ -0,0 +1,19 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpgradeOfflineConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exiledb.toml")
+	if err := os.WriteFile(path, []byte("offline = true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := executeRoot(t, "upgrade", "--config", path)
+	if err == nil || !strings.Contains(err.Error(), "cannot run offline") {
+		t.Errorf("upgrade with offline = true in the config = %v, want the offline error", err)
+	}
+}
@@ -3,6 +3,8 @@ module github.com/jchantrell/exiledb
 go 1.25.0
 
 require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/lib/pq v1.10.9
 	github.com/lmittmann/tint v1.1.2
 	github.com/mattn/go-sqlite3 v1.14.17
 	github.com/oriath-net/gooz v1.0.1
@@ -11,6 +13,7 @@ require (
 	github.com/x448/float16 v0.8.4
 	golang.org/x/sync v0.20.0
 	golang.org/x/term v0.35.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
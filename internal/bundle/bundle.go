@@ -90,6 +90,28 @@ func OpenBundle(r io.ReaderAt) (*bundle, error) {
 	return &b, nil
 }
 
+// VerifyBundle checks that r, a file of size bytes, holds a whole bundle
+// whose uncompressed size is want: the head parses, the size matches, and
+// the compressed blocks end exactly at the end of the file. Blocks are not
+// decompressed.
+func VerifyBundle(r io.ReaderAt, size, want int64) error {
+	b, err := OpenBundle(r)
+	if err != nil {
+		return err
+	}
+	if b.size != want {
+		return fmt.Errorf("uncompressed size %d, index says %d", b.size, want)
+	}
+	end := int64(binary.Size(bundleHead{}))
+	if n := len(b.blocks); n > 0 {
+		end = b.blocks[n-1].offset + b.blocks[n-1].length
+	}
+	if end != size {
+		return fmt.Errorf("blocks end at byte %d of %d", end, size)
+	}
+	return nil
+}
+
 func (b *bundle) Size() int64 {
 	return b.size
 }
@@ -12,8 +12,9 @@ import (
 // Index is the parsed bundle index: which bundles exist and where each file
 // lives within them. File paths are kept case-fold sorted for binary search.
 type Index struct {
-	bundles []string
-	files   []bundleFileInfo
+	bundles     []string
+	bundleSizes []uint32 // uncompressed size of each bundle
+	files       []bundleFileInfo
 }
 
 type bundleFileInfo struct {
@@ -50,6 +51,7 @@ func loadBundleIndexFromRawData(indexData []byte) (*Index, error) {
 	}
 
 	bundles := make([]string, bundleCount)
+	bundleSizes := make([]uint32, bundleCount)
 	for i := range bundles {
 		nameLen, err := cur.uint32()
 		if err != nil {
@@ -59,11 +61,12 @@ func loadBundleIndexFromRawData(indexData []byte) (*Index, error) {
 		if err != nil {
 			return nil, fmt.Errorf("reading bundle %d name: %w", i, err)
 		}
-		// skip uncompressed size -- available elsewhere
-		if _, err := cur.take(4); err != nil {
+		size, err := cur.uint32()
+		if err != nil {
 			return nil, fmt.Errorf("reading bundle %d size: %w", i, err)
 		}
 		bundles[i] = string(name)
+		bundleSizes[i] = size
 	}
 
 	fileCount, err := cur.uint32()
@@ -180,8 +183,9 @@ func loadBundleIndexFromRawData(indexData []byte) (*Index, error) {
 	})
 
 	return &Index{
-		bundles: bundles,
-		files:   files,
+		bundles:     bundles,
+		bundleSizes: bundleSizes,
+		files:       files,
 	}, nil
 }
 
@@ -275,6 +279,15 @@ func (idx *Index) GetFileInfo(path string) (*FileLocation, error) {
 	}, nil
 }
 
+// Bundles lists every bundle the index names, with its uncompressed size.
+func (idx *Index) Bundles() []BundleEntry {
+	entries := make([]BundleEntry, len(idx.bundles))
+	for i, name := range idx.bundles {
+		entries[i] = BundleEntry{Name: name, Size: int64(idx.bundleSizes[i])}
+	}
+	return entries
+}
+
 func (idx *Index) ListFiles() []string {
 	files := make([]string, len(idx.files))
 	for i, file := range idx.files {
@@ -7,11 +7,12 @@ import (
 	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
 )
 
 const (
 	cacheMagic    = "EIDX"
-	cacheVersion  = uint32(3)
+	cacheVersion  = uint32(4)
 	cacheHashSeed = uint64(0x6578696c65646230)
 )
 
@@ -79,6 +80,7 @@ func readIndexCache(cachePath string, expectedSourceHash uint64) (*Index, error)
 	bundleCount := int(binary.LittleEndian.Uint32(buf[:4]))
 
 	bundles := make([]string, bundleCount)
+	bundleSizes := make([]uint32, bundleCount)
 	for i := range bundles {
 		if _, err := io.ReadFull(r, buf[:4]); err != nil {
 			return nil, err
@@ -89,6 +91,10 @@ func readIndexCache(cachePath string, expectedSourceHash uint64) (*Index, error)
 			return nil, err
 		}
 		bundles[i] = string(name)
+		if _, err := io.ReadFull(r, buf[:4]); err != nil {
+			return nil, err
+		}
+		bundleSizes[i] = binary.LittleEndian.Uint32(buf[:4])
 	}
 
 	if _, err := io.ReadFull(r, buf[:4]); err != nil {
@@ -146,10 +152,13 @@ func readIndexCache(cachePath string, expectedSourceHash uint64) (*Index, error)
 		}
 	}
 
-	return &Index{bundles: bundles, files: files}, nil
+	return &Index{bundles: bundles, bundleSizes: bundleSizes, files: files}, nil
 }
 
 func writeIndexCache(cachePath string, sourceHash uint64, idx *Index) error {
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return err
+	}
 	tmpPath := cachePath + ".tmp"
 	f, err := os.Create(tmpPath)
 	if err != nil {
@@ -168,10 +177,12 @@ func writeIndexCache(cachePath string, sourceHash uint64, idx *Index) error {
 
 	binary.LittleEndian.PutUint32(buf[:4], uint32(len(idx.bundles)))
 	w.Write(buf[:4])
-	for _, name := range idx.bundles {
+	for i, name := range idx.bundles {
 		binary.LittleEndian.PutUint32(buf[:4], uint32(len(name)))
 		w.Write(buf[:4])
 		w.WriteString(name)
+		binary.LittleEndian.PutUint32(buf[:4], idx.bundleSizes[i])
+		w.Write(buf[:4])
 	}
 
 	binary.LittleEndian.PutUint32(buf[:4], uint32(len(idx.files)))
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/jchantrell/exiledb/internal/cache"
 	"github.com/jchantrell/exiledb/internal/ggpk"
@@ -16,6 +18,8 @@ type BundleSource interface {
 	Close() error
 }
 
+// CacheSource reads a patch downloaded into the cache. Its bundles may be
+// hard links into the cache's object store, which reads no differently.
 type CacheSource struct {
 	patch string
 	cache *cache.Cache
@@ -83,3 +87,48 @@ func (s *GgpkSource) IndexCachePath() string {
 func (s *GgpkSource) Close() error {
 	return s.reader.Close()
 }
+
+// DirSource reads the loose Bundles2 directory of an installed game, as the
+// Steam and Epic clients lay it out, without a Content.ggpk.
+type DirSource struct {
+	bundlesDir     string
+	indexCachePath string
+}
+
+// NewDirSource opens the install at gameDir, or its Bundles2 directory
+// itself. The parsed index is cached at indexCachePath rather than in the
+// install, which the game's launcher owns.
+func NewDirSource(gameDir, indexCachePath string) (*DirSource, error) {
+	bundlesDir := filepath.Join(gameDir, "Bundles2")
+	if strings.EqualFold(filepath.Base(gameDir), "Bundles2") {
+		bundlesDir = gameDir
+	}
+	if _, err := os.Stat(filepath.Join(bundlesDir, "_.index.bin")); err != nil {
+		if _, ggpkErr := os.Stat(filepath.Join(gameDir, "Content.ggpk")); ggpkErr == nil {
+			return nil, fmt.Errorf("%s has a Content.ggpk and no Bundles2 directory: use --ggpk", gameDir)
+		}
+		return nil, fmt.Errorf("finding bundle index in game directory: %w", err)
+	}
+	return &DirSource{bundlesDir: bundlesDir, indexCachePath: indexCachePath}, nil
+}
+
+func (s *DirSource) ReadIndex() ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.bundlesDir, "_.index.bin"))
+}
+
+func (s *DirSource) OpenBundle(name string) (io.ReaderAt, io.Closer, error) {
+	bundlePath := filepath.Join(s.bundlesDir, filepath.FromSlash(name)+".bundle.bin")
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening bundle file %s: %w", bundlePath, err)
+	}
+	return f, f, nil
+}
+
+func (s *DirSource) IndexCachePath() string {
+	return s.indexCachePath
+}
+
+func (s *DirSource) Close() error {
+	return nil
+}
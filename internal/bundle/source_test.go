@@ -0,0 +1,153 @@
+package bundle
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates each file under dir with its contents.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNewDirSource(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		open  string // the directory passed, relative to the install
+		err   string
+	}{
+		{
+			name:  "install",
+			files: map[string]string{"Bundles2/_.index.bin": "index"},
+		},
+		{
+			name:  "bundles directory",
+			files: map[string]string{"Bundles2/_.index.bin": "index"},
+			open:  "Bundles2",
+		},
+		{
+			name:  "lower-case bundles directory",
+			files: map[string]string{"bundles2/_.index.bin": "index"},
+			open:  "bundles2",
+		},
+		{
+			name:  "ggpk install",
+			files: map[string]string{"Content.ggpk": "ggpk"},
+			err:   "has a Content.ggpk and no Bundles2 directory: use --ggpk",
+		},
+		{
+			name:  "no index",
+			files: map[string]string{"Bundles2/Data.bundle.bin": "bundle"},
+			err:   "finding bundle index in game directory",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			install := t.TempDir()
+			writeFiles(t, install, tt.files)
+
+			src, err := NewDirSource(filepath.Join(install, tt.open), filepath.Join(t.TempDir(), "index.cache"))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("NewDirSource = %v, want an error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data, err := src.ReadIndex(); err != nil || string(data) != "index" {
+				t.Errorf("ReadIndex = %q, %v; want index", data, err)
+			}
+		})
+	}
+}
+
+func TestDirSourceOpenBundle(t *testing.T) {
+	install := t.TempDir()
+	writeFiles(t, install, map[string]string{
+		"Bundles2/_.index.bin":                  "index",
+		"Bundles2/Folders/Data/Mods.bundle.bin": "mods bundle",
+	})
+	src, err := NewDirSource(install, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, closer, err := src.OpenBundle("Folders/Data/Mods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+	data, err := io.ReadAll(io.NewSectionReader(r, 0, 1<<20))
+	if err != nil || string(data) != "mods bundle" {
+		t.Errorf("bundle contents = %q, %v; want mods bundle", data, err)
+	}
+
+	if _, _, err := src.OpenBundle("Folders/Missing"); err == nil {
+		t.Error("OpenBundle of a missing bundle succeeded")
+	}
+}
+
+// TestDirSourceIndexCache loads a bundle manager from an install whose index
+// is already cached outside it, and checks the cache is used and nothing is
+// written into the install.
+func TestDirSourceIndexCache(t *testing.T) {
+	install := t.TempDir()
+	indexData := "compressed index"
+	writeFiles(t, install, map[string]string{"Bundles2/_.index.bin": indexData})
+
+	cachePath := filepath.Join(t.TempDir(), "installs", "game.index.bin.cache")
+	cached := &Index{
+		bundles:     []string{"Folders/Data"},
+		bundleSizes: []uint32{100},
+		files:       []bundleFileInfo{{path: "data/mods.datc64", size: 10}},
+	}
+	if err := writeIndexCache(cachePath, MurmurHash64A([]byte(indexData), cacheHashSeed), cached); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := NewDirSource(install, cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.IndexCachePath() != cachePath {
+		t.Errorf("IndexCachePath = %s, want %s", src.IndexCachePath(), cachePath)
+	}
+	// The index data is not a real compressed index, so only a cache hit
+	// loads.
+	m, err := NewBundleManager(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if !m.FileExists("Data/Mods.datc64") {
+		t.Error("cached index does not list Data/Mods.datc64")
+	}
+
+	var files []string
+	filepath.WalkDir(install, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	})
+	if len(files) != 1 {
+		t.Errorf("install holds %v, want only its index", files)
+	}
+}
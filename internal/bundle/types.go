@@ -5,6 +5,11 @@ type FileEntry struct {
 	Size uint32
 }
 
+type BundleEntry struct {
+	Name string
+	Size int64 // uncompressed
+}
+
 type FileLocation struct {
 	BundleName string
 	Offset     uint32
@@ -0,0 +1,63 @@
+package bundle
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+
+	"github.com/jchantrell/exiledb/internal/cache"
+)
+
+// CacheReport is the outcome of VerifyCache for one patch.
+type CacheReport struct {
+	Bundles int // bundles the index names
+	Cached  int // of those, how many are in the cache
+	Corrupt []CorruptBundle
+}
+
+// CorruptBundle is a cached bundle that failed verification.
+type CorruptBundle struct {
+	Name string
+	Path string
+	Err  error
+}
+
+// VerifyCache checks every cached bundle of a patch against the patch's
+// cached index with VerifyBundle. Bundles that were never downloaded are
+// counted but are not an error: extracts fetch bundles on demand.
+func VerifyCache(ctx context.Context, c *cache.Cache, patch string, progress func(done, total int, label string)) (*CacheReport, error) {
+	index, err := LoadIndex(NewCacheSource(c, patch))
+	if err != nil {
+		return nil, err
+	}
+
+	bundles := index.Bundles()
+	report := &CacheReport{Bundles: len(bundles)}
+	for i, b := range bundles {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if progress != nil {
+			progress(i+1, len(bundles), b.Name)
+		}
+
+		path := c.BundlePath(patch, b.Name)
+		f, err := os.Open(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		report.Cached++
+		if err == nil {
+			var info os.FileInfo
+			if info, err = f.Stat(); err == nil {
+				err = VerifyBundle(f, info.Size(), b.Size)
+			}
+			f.Close()
+		}
+		if err != nil {
+			report.Corrupt = append(report.Corrupt, CorruptBundle{Name: b.Name, Path: path, Err: err})
+		}
+	}
+	return report, nil
+}
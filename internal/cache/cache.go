@@ -1,12 +1,18 @@
 package cache
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 )
 
+// installsDir holds the index caches of game installs; see
+// InstallIndexCachePath.
+const installsDir = "installs"
+
 type Cache struct {
 	root string
 }
@@ -35,8 +41,24 @@ func (c *Cache) IndexPath(patch string) string {
 	return filepath.Join(c.PatchDir(patch), "_.index.bin")
 }
 
+// InstallIndexCachePath is where the parsed index of a game install at dir
+// is cached, so reading an install never writes into it.
+func (c *Cache) InstallIndexCachePath(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	sum := sha256.Sum256([]byte(dir))
+	return filepath.Join(c.root, installsDir, hex.EncodeToString(sum[:8])+".index.bin.cache")
+}
+
 func (c *Cache) BundlePath(patch, bundleName string) string {
 	safeBundleName := strings.ReplaceAll(bundleName, "/", "_")
 	safeBundleName = strings.ReplaceAll(safeBundleName, " ", "_")
 	return filepath.Join(c.PatchDir(patch), safeBundleName)
 }
+
+// SchemaValidatorsPath holds the ETag and Last-Modified of the schema at
+// SchemaPath, for revalidating it rather than downloading it again.
+func (c *Cache) SchemaValidatorsPath() string {
+	return c.SchemaPath() + ".validators"
+}
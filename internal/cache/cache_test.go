@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInstallIndexCachePath(t *testing.T) {
+	c := &Cache{root: t.TempDir()}
+	install := t.TempDir()
+
+	path := c.InstallIndexCachePath(install)
+	if !strings.HasPrefix(path, filepath.Join(c.root, installsDir)+string(filepath.Separator)) {
+		t.Errorf("InstallIndexCachePath(%s) = %s, want it under the cache", install, path)
+	}
+	if other := c.InstallIndexCachePath(filepath.Join(install, "other")); other == path {
+		t.Errorf("two installs share the index cache %s", path)
+	}
+
+	// A relative path to the same install shares its cache.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(install); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if got := c.InstallIndexCachePath("."); got != path {
+		t.Errorf("InstallIndexCachePath(.) = %s, want %s", got, path)
+	}
+}
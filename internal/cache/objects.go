@@ -0,0 +1,224 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// objectsDir is the content-addressed store under the cache root. Most
+// bundles are byte-identical between consecutive patches, so each one is
+// kept there once, named by its SHA-256, and patch directories hold hard
+// links to it. Readers open bundles through BundlePath as before and never
+// see the difference.
+const objectsDir = "objects"
+
+// ObjectPath is where a bundle with the given hex SHA-256 lives in the
+// object store.
+func (c *Cache) ObjectPath(hash string) string {
+	return filepath.Join(c.root, objectsDir, hash[:2], hash)
+}
+
+// StoreBundle moves a bundle downloaded into a patch directory into the
+// object store. If an identical bundle is already stored, the patch's copy
+// is replaced by a link to it; otherwise the download itself becomes the
+// stored object. It reports whether an identical bundle was already stored.
+//
+// Where the filesystem does not support hard links, the bundle is left as
+// it is, unshared.
+func (c *Cache) StoreBundle(patch, bundleName string) (bool, error) {
+	return c.storeFile(c.BundlePath(patch, bundleName))
+}
+
+func (c *Cache) storeFile(path string) (bool, error) {
+	hash, err := hashFile(path)
+	if err != nil {
+		return false, err
+	}
+	object := c.ObjectPath(hash)
+	if err := os.MkdirAll(filepath.Dir(object), 0755); err != nil {
+		return false, fmt.Errorf("creating object store directory: %w", err)
+	}
+
+	err = os.Link(path, object)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, fs.ErrExist) {
+		slog.Debug("Cannot link bundle into the object store, keeping it unshared", "path", path, "error", err)
+		return false, nil
+	}
+
+	// An identical bundle is stored already; point the patch at it. The link
+	// goes in next to path and is renamed over it, so path never goes
+	// missing.
+	if info, err := os.Stat(path); err == nil {
+		if stored, err := os.Stat(object); err == nil && os.SameFile(info, stored) {
+			return true, nil
+		}
+	}
+	tmp := path + ".tmplink"
+	os.Remove(tmp)
+	if err := os.Link(object, tmp); err != nil {
+		return false, fmt.Errorf("linking stored bundle %s: %w", hash, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return false, fmt.Errorf("linking stored bundle %s: %w", hash, err)
+	}
+	return true, nil
+}
+
+// Dedupe moves the bundles of a patch that are not in the object store yet
+// into it, as StoreBundle does for new downloads. It is for caches filled
+// before the object store existed. It returns how many bytes of the patch
+// turned out to be stored already and so no longer take space of their own.
+func (c *Cache) Dedupe(patch string) (int64, error) {
+	files, err := c.PatchFiles(patch)
+	if err != nil {
+		return 0, err
+	}
+	var saved int64
+	for _, f := range files {
+		if f.Stored || isIndexFile(f.Name) || strings.Contains(f.Name, ".tmp") {
+			continue
+		}
+		shared, err := c.storeFile(filepath.Join(c.PatchDir(patch), f.Name))
+		if err != nil {
+			return saved, err
+		}
+		if shared {
+			saved += f.Size
+		}
+	}
+	return saved, nil
+}
+
+// ObjectUsage is one bundle in the object store.
+type ObjectUsage struct {
+	Hash string
+	Path string
+	Size int64
+
+	info fs.FileInfo
+}
+
+// Objects lists the bundles in the object store.
+func (c *Cache) Objects() ([]ObjectUsage, error) {
+	var objects []ObjectUsage
+	err := filepath.WalkDir(filepath.Join(c.root, objectsDir), func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectUsage{Hash: d.Name(), Path: path, Size: info.Size(), info: info})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading object store: %w", err)
+	}
+	return objects, nil
+}
+
+// UnusedObjects returns the stored bundles that no patch directory links to
+// any more, such as those of removed patches. Files for which skip reports
+// true are treated as gone already, so callers can preview what removing
+// them would leave unused.
+func (c *Cache) UnusedObjects(skip func(patch, name string) bool) ([]ObjectUsage, error) {
+	objects, err := c.Objects()
+	if err != nil {
+		return nil, err
+	}
+	patches, err := c.patchNames()
+	if err != nil {
+		return nil, err
+	}
+
+	store := newObjectSet(objects)
+	for _, patch := range patches {
+		entries, err := os.ReadDir(c.PatchDir(patch))
+		if err != nil {
+			return nil, fmt.Errorf("reading cache directory for %s: %w", patch, err)
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() || (skip != nil && skip(patch, entry.Name())) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return nil, fmt.Errorf("reading cache directory for %s: %w", patch, err)
+			}
+			store.use(info)
+		}
+	}
+
+	var unused []ObjectUsage
+	for _, o := range objects {
+		if !store.used[o.Hash] {
+			unused = append(unused, o)
+		}
+	}
+	return unused, nil
+}
+
+// RemoveObject deletes a bundle from the object store. Patches linking to
+// it keep their copy.
+func (c *Cache) RemoveObject(o ObjectUsage) error {
+	if err := os.Remove(c.ObjectPath(o.Hash)); err != nil {
+		return fmt.Errorf("removing stored bundle %s: %w", o.Hash, err)
+	}
+	return nil
+}
+
+// objectSet finds which stored bundle, if any, a file in a patch directory
+// is a link to. Objects are bucketed by size so only same-sized files need
+// comparing.
+type objectSet struct {
+	bySize map[int64][]ObjectUsage
+	used   map[string]bool
+}
+
+func newObjectSet(objects []ObjectUsage) *objectSet {
+	s := &objectSet{bySize: make(map[int64][]ObjectUsage), used: make(map[string]bool)}
+	for _, o := range objects {
+		s.bySize[o.Size] = append(s.bySize[o.Size], o)
+	}
+	return s
+}
+
+// use reports whether info is a stored bundle, and marks it used.
+func (s *objectSet) use(info fs.FileInfo) bool {
+	for _, o := range s.bySize[info.Size()] {
+		if os.SameFile(info, o.info) {
+			s.used[o.Hash] = true
+			return true
+		}
+	}
+	return false
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("opening bundle to store: %w", err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hashing bundle %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
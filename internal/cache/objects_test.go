@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStoreBundleSharesIdenticalBundles(t *testing.T) {
+	c := &Cache{root: t.TempDir()}
+	write := func(patch, bundle, content string) {
+		t.Helper()
+		path := c.BundlePath(patch, bundle)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store := func(patch, bundle string, wantShared bool) {
+		t.Helper()
+		shared, err := c.StoreBundle(patch, bundle)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if shared != wantShared {
+			t.Errorf("StoreBundle(%s, %s) shared = %v, want %v", patch, bundle, shared, wantShared)
+		}
+	}
+
+	write("4.1.0", "Folders/a", "unchanged")
+	write("4.1.0", "Folders/b", "old")
+	store("4.1.0", "Folders/a", false)
+	store("4.1.0", "Folders/b", false)
+	write("4.1.1", "Folders/a", "unchanged")
+	write("4.1.1", "Folders/b", "new")
+	store("4.1.1", "Folders/a", true)
+	store("4.1.1", "Folders/b", false)
+
+	old, err := os.Stat(c.BundlePath("4.1.0", "Folders/a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cur, err := os.Stat(c.BundlePath("4.1.1", "Folders/a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(old, cur) {
+		t.Error("identical bundles of two patches are separate files")
+	}
+
+	patches, err := c.Patches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patches) != 2 {
+		t.Fatalf("Patches = %+v, want the two patches without the object store", patches)
+	}
+	for _, p := range patches {
+		if p.Stored != p.Size {
+			t.Errorf("%s: %d of %d bytes stored, want all", p.Patch, p.Stored, p.Size)
+		}
+	}
+
+	if err := c.RemovePatch("4.1.0"); err != nil {
+		t.Fatal(err)
+	}
+	unused, err := c.UnusedObjects(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unused) != 1 || unused[0].Size != int64(len("old")) {
+		t.Fatalf("UnusedObjects = %+v, want only the old Folders/b", unused)
+	}
+	if err := c.RemoveObject(unused[0]); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(c.BundlePath("4.1.1", "Folders/a")); err != nil || string(got) != "unchanged" {
+		t.Errorf("shared bundle after pruning = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schemasDir archives every community schema extracts have used, so a
+// later run can pin one after the latest release has moved on.
+const schemasDir = "schemas"
+
+// ArchivedSchema is one schema in the archive, as its metadata names it.
+type ArchivedSchema struct {
+	Version   int
+	CreatedAt time.Time
+	Path      string
+}
+
+// SchemaArchivePath is where the schema with the given version and
+// creation time, a Unix timestamp, is archived.
+func (c *Cache) SchemaArchivePath(version, createdAt int) string {
+	return filepath.Join(c.root, schemasDir, fmt.Sprintf("%d-v%d.min.json", createdAt, version))
+}
+
+// ArchivedSchemas lists the archived schemas, newest first.
+func (c *Cache) ArchivedSchemas() ([]ArchivedSchema, error) {
+	entries, err := os.ReadDir(filepath.Join(c.root, schemasDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading schema archive: %w", err)
+	}
+
+	var schemas []ArchivedSchema
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".min.json")
+		if !ok || !entry.Type().IsRegular() {
+			continue
+		}
+		created, version, ok := strings.Cut(name, "-v")
+		if !ok {
+			continue
+		}
+		createdAt, err1 := strconv.ParseInt(created, 10, 64)
+		v, err2 := strconv.Atoi(version)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		schemas = append(schemas, ArchivedSchema{
+			Version:   v,
+			CreatedAt: time.Unix(createdAt, 0).UTC(),
+			Path:      filepath.Join(c.root, schemasDir, entry.Name()),
+		})
+	}
+	slices.SortFunc(schemas, func(a, b ArchivedSchema) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return schemas, nil
+}
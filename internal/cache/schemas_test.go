@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestArchivedSchemas(t *testing.T) {
+	c := &Cache{root: t.TempDir()}
+	if schemas, err := c.ArchivedSchemas(); err != nil || len(schemas) != 0 {
+		t.Fatalf("ArchivedSchemas of an empty cache = %v, %v; want none", schemas, err)
+	}
+
+	paths := []string{
+		c.SchemaArchivePath(7, 1700000000),
+		c.SchemaArchivePath(7, 1760000000),
+		c.SchemaArchivePath(6, 1600000000),
+	}
+	if want := filepath.Join(c.root, schemasDir, "1700000000-v7.min.json"); paths[0] != want {
+		t.Errorf("SchemaArchivePath = %s, want %s", paths[0], want)
+	}
+	// Files not named like an archived schema are ignored.
+	for _, name := range []string{"notes.txt", "1700000000.min.json", "x-v7.min.json", "1700000000-v7.min.json.tmp"} {
+		paths = append(paths, filepath.Join(c.root, schemasDir, name))
+	}
+	if err := os.MkdirAll(filepath.Join(c.root, schemasDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	schemas, err := c.ArchivedSchemas()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ArchivedSchema{
+		{Version: 7, CreatedAt: time.Unix(1760000000, 0).UTC(), Path: paths[1]},
+		{Version: 7, CreatedAt: time.Unix(1700000000, 0).UTC(), Path: paths[0]},
+		{Version: 6, CreatedAt: time.Unix(1600000000, 0).UTC(), Path: paths[2]},
+	}
+	if len(schemas) != len(want) {
+		t.Fatalf("ArchivedSchemas = %+v, want %+v", schemas, want)
+	}
+	for i := range want {
+		if schemas[i] != want[i] {
+			t.Errorf("schema %d = %+v, want %+v", i, schemas[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// PatchUsage is one patch directory of the cache.
+type PatchUsage struct {
+	Patch string
+	Files int
+	Size  int64
+
+	// Stored is the part of Size held in the object store, shared with
+	// other patches that have the same bundles.
+	Stored int64
+
+	// LastUsed is when an extract last downloaded into or read from the
+	// patch; see Touch.
+	LastUsed time.Time
+}
+
+// FileUsage is one file in a patch directory.
+type FileUsage struct {
+	Name string
+	Size int64
+
+	// Stored reports whether the file is a link into the object store.
+	Stored bool
+}
+
+// indexFiles are the files in a patch directory that are not bundles.
+var indexFiles = []string{"_.index.bin", "_.index.bin.cache"}
+
+// isReservedDir reports whether a directory under the cache root is one the
+// cache keeps for itself rather than a patch.
+func isReservedDir(name string) bool {
+	return name == objectsDir || name == installsDir || name == schemasDir
+}
+
+func isIndexFile(name string) bool {
+	return slices.Contains(indexFiles, name)
+}
+
+// Touch marks a patch as used now, so pruning by age keeps patches that are
+// still read even when nothing new is downloaded into them.
+func (c *Cache) Touch(patch string) error {
+	now := time.Now()
+	return os.Chtimes(c.PatchDir(patch), now, now)
+}
+
+// Patches lists the patch directories in the cache, most recently used
+// first.
+func (c *Cache) Patches() ([]PatchUsage, error) {
+	names, err := c.patchNames()
+	if err != nil {
+		return nil, err
+	}
+	objects, err := c.Objects()
+	if err != nil {
+		return nil, err
+	}
+	store := newObjectSet(objects)
+
+	var patches []PatchUsage
+	for _, name := range names {
+		info, err := os.Stat(c.PatchDir(name))
+		if err != nil {
+			return nil, fmt.Errorf("reading cache directory: %w", err)
+		}
+		files, err := c.patchFiles(name, store)
+		if err != nil {
+			return nil, err
+		}
+		usage := PatchUsage{Patch: name, Files: len(files), LastUsed: info.ModTime()}
+		for _, f := range files {
+			usage.Size += f.Size
+			if f.Stored {
+				usage.Stored += f.Size
+			}
+		}
+		patches = append(patches, usage)
+	}
+	slices.SortFunc(patches, func(a, b PatchUsage) int {
+		return b.LastUsed.Compare(a.LastUsed)
+	})
+	return patches, nil
+}
+
+// patchNames lists the patch directories in the cache, leaving out the
+// directories the cache keeps for itself.
+func (c *Cache) patchNames() ([]string, error) {
+	entries, err := os.ReadDir(c.root)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading cache directory: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && !isReservedDir(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// PatchFiles lists the files in a patch directory, sorted by name.
+func (c *Cache) PatchFiles(patch string) ([]FileUsage, error) {
+	objects, err := c.Objects()
+	if err != nil {
+		return nil, err
+	}
+	return c.patchFiles(patch, newObjectSet(objects))
+}
+
+func (c *Cache) patchFiles(patch string, store *objectSet) ([]FileUsage, error) {
+	entries, err := os.ReadDir(c.PatchDir(patch))
+	if err != nil {
+		return nil, fmt.Errorf("reading cache directory for %s: %w", patch, err)
+	}
+	var files []FileUsage
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("reading cache directory for %s: %w", patch, err)
+		}
+		files = append(files, FileUsage{Name: entry.Name(), Size: info.Size(), Stored: store.use(info)})
+	}
+	return files, nil
+}
+
+// Unreferenced returns the files in a patch directory that are neither its
+// index nor one of bundles: bundles a changed index no longer names, and
+// temp files of interrupted downloads.
+func (c *Cache) Unreferenced(patch string, bundles []string) ([]FileUsage, error) {
+	keep := make(map[string]bool, len(bundles)+len(indexFiles))
+	for _, name := range indexFiles {
+		keep[name] = true
+	}
+	for _, name := range bundles {
+		keep[filepath.Base(c.BundlePath(patch, name))] = true
+	}
+
+	files, err := c.PatchFiles(patch)
+	if err != nil {
+		return nil, err
+	}
+	var unreferenced []FileUsage
+	for _, f := range files {
+		if !keep[f.Name] {
+			unreferenced = append(unreferenced, f)
+		}
+	}
+	return unreferenced, nil
+}
+
+// RemovePatch deletes a patch directory and everything in it. Bundles it
+// shared through the object store stay there until UnusedObjects finds
+// them.
+func (c *Cache) RemovePatch(patch string) error {
+	if patch == "" || patch != filepath.Base(patch) || strings.HasPrefix(patch, ".") || isReservedDir(patch) {
+		return fmt.Errorf("invalid patch %q", patch)
+	}
+	if err := os.RemoveAll(c.PatchDir(patch)); err != nil {
+		return fmt.Errorf("removing cached patch %s: %w", patch, err)
+	}
+	return nil
+}
+
+// RemoveFile deletes one file from a patch directory.
+func (c *Cache) RemoveFile(patch, name string) error {
+	if name != filepath.Base(name) {
+		return fmt.Errorf("invalid cache file name %q", name)
+	}
+	if err := os.Remove(filepath.Join(c.PatchDir(patch), name)); err != nil {
+		return fmt.Errorf("removing cached file: %w", err)
+	}
+	return nil
+}
+
+// SelectStale picks the patches to prune from patches, ordered most
+// recently used first as Patches returns them: all but the first keep, when
+// keep is positive, and those unused for longer than olderThan, when it is
+// positive.
+func SelectStale(patches []PatchUsage, keep int, olderThan time.Duration, now time.Time) []PatchUsage {
+	var stale []PatchUsage
+	for i, p := range patches {
+		if (keep > 0 && i >= keep) || (olderThan > 0 && now.Sub(p.LastUsed) > olderThan) {
+			stale = append(stale, p)
+		}
+	}
+	return stale
+}
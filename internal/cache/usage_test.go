@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPrune(t *testing.T) {
+	c := &Cache{root: t.TempDir()}
+	now := time.Now()
+	for i, patch := range []string{"3.25.0", "3.26.0", "3.27.0"} {
+		dir := c.PatchDir(patch)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"_.index.bin", "Folders_a", "Folders_gone", "Folders_b.tmp123"} {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		used := now.Add(-time.Duration(2-i) * 10 * 24 * time.Hour) // 20, 10 and 0 days ago
+		if err := os.Chtimes(dir, used, used); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	patches, err := c.Patches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range patches {
+		names = append(names, p.Patch)
+	}
+	if !slices.Equal(names, []string{"3.27.0", "3.26.0", "3.25.0"}) || patches[0].Files != 4 {
+		t.Fatalf("Patches = %+v, want most recently used first", patches)
+	}
+
+	for _, tt := range []struct {
+		keep      int
+		olderThan time.Duration
+		want      int
+	}{
+		{keep: 1, want: 2},
+		{olderThan: 15 * 24 * time.Hour, want: 1},
+		{keep: 3, olderThan: 5 * 24 * time.Hour, want: 2},
+	} {
+		if stale := SelectStale(patches, tt.keep, tt.olderThan, now); len(stale) != tt.want {
+			t.Errorf("SelectStale(keep %d, older than %s) = %d patches, want %d", tt.keep, tt.olderThan, len(stale), tt.want)
+		}
+	}
+
+	files, err := c.Unreferenced("3.27.0", []string{"Folders/a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var unreferenced []string
+	for _, f := range files {
+		unreferenced = append(unreferenced, f.Name)
+	}
+	if !slices.Equal(unreferenced, []string{"Folders_b.tmp123", "Folders_gone"}) {
+		t.Errorf("Unreferenced = %v, want the temp file and Folders_gone", unreferenced)
+	}
+}
@@ -2,11 +2,14 @@ package cdn
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"sync"
 	"sync/atomic"
 
 	"golang.org/x/sync/errgroup"
@@ -21,12 +24,27 @@ const (
 	downloadConcurrency = 6
 )
 
+// baseURLs are the CDN roots ConstructURL builds on, for PoE1 and PoE2.
+// SetBaseURLs points them elsewhere, such as at a mirror.
+var baseURLs = struct{ poe1, poe2 string }{PoE1CDNURL, PoE2CDNURL}
+
+// SetBaseURLs replaces the CDN roots for PoE1 and PoE2. An empty URL keeps
+// the game's official CDN. A replacement must be laid out like the CDN,
+// <root>/<patch>/Bundles2/..., as the mirror command writes it.
+func SetBaseURLs(poe1, poe2 string) {
+	baseURLs.poe1, baseURLs.poe2 = PoE1CDNURL, PoE2CDNURL
+	if poe1 != "" {
+		baseURLs.poe1 = strings.TrimSuffix(poe1, "/")
+	}
+	if poe2 != "" {
+		baseURLs.poe2 = strings.TrimSuffix(poe2, "/")
+	}
+}
+
 func ConstructURL(gameVersion int, patch string, filename string) string {
-	var baseURL string
+	baseURL := baseURLs.poe1
 	if gameVersion >= 4 {
-		baseURL = PoE2CDNURL
-	} else {
-		baseURL = PoE1CDNURL
+		baseURL = baseURLs.poe2
 	}
 	return fmt.Sprintf("%s/%s/Bundles2/%s", baseURL, patch, filename)
 }
@@ -40,6 +58,12 @@ func DownloadIndex(ctx context.Context, cache *cache.Cache, patch string, gameVe
 		return nil
 	}
 
+	if offline {
+		missing := &MissingError{}
+		missing.Add("index of patch "+patch, indexPath)
+		return missing
+	}
+
 	indexURL := ConstructURL(gameVersion, patch, "_.index.bin")
 	slog.Info("Fetching bundles from CDN", "url", indexURL, "destination", indexPath)
 
@@ -78,24 +102,57 @@ func DownloadBundles(ctx context.Context, cache *cache.Cache, patch string, game
 		slog.Info("Using cached bundles")
 		return nil
 	}
+	if offline {
+		missing := &MissingError{}
+		for _, bundleName := range bundlesToDownload {
+			missing.Add("bundle "+bundleName, cache.BundlePath(patch, bundleName))
+		}
+		return missing
+	}
 
 	slog.Info("Downloading bundles", "count", downloadableCount)
 	sort.Strings(bundlesToDownload)
 
-	var downloaded atomic.Int64
-	g, ctx := errgroup.WithContext(ctx)
+	// A bundle that still fails after Download's retries does not stop the
+	// others: every failure is reported once all have been tried, so a
+	// rerun only has the failed bundles left to fetch.
+	var (
+		downloaded atomic.Int64
+		mu         sync.Mutex
+		failed     []error
+	)
+	g := new(errgroup.Group)
 	g.SetLimit(downloadConcurrency)
 	for _, bundleName := range bundlesToDownload {
+		if ctx.Err() != nil {
+			break
+		}
 		g.Go(func() error {
 			bundlePath := cache.BundlePath(patch, bundleName)
 
-			if err := os.MkdirAll(filepath.Dir(bundlePath), 0755); err != nil {
-				return fmt.Errorf("creating cache directory for bundle %s: %w", bundleName, err)
+			err := os.MkdirAll(filepath.Dir(bundlePath), 0755)
+			if err != nil {
+				err = fmt.Errorf("creating cache directory for bundle %s: %w", bundleName, err)
+			} else {
+				slog.Debug("Downloading bundle", "bundle", bundleName)
+				if err = Download(ctx, ConstructURL(gameVersion, patch, bundleName+".bundle.bin"), bundlePath); err != nil {
+					err = fmt.Errorf("downloading bundle %s: %w", bundleName, err)
+				} else if shared, storeErr := cache.StoreBundle(patch, bundleName); storeErr != nil {
+					// The download is good either way; it just takes space
+					// of its own.
+					slog.Warn("Could not add bundle to the object store", "bundle", bundleName, "error", storeErr)
+				} else if shared {
+					slog.Debug("Bundle unchanged from a cached patch, sharing it", "bundle", bundleName)
+				}
 			}
-
-			slog.Debug("Downloading bundle", "bundle", bundleName)
-			if err := Download(ctx, ConstructURL(gameVersion, patch, bundleName+".bundle.bin"), bundlePath); err != nil {
-				return fmt.Errorf("downloading bundle %s: %w", bundleName, err)
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Error("Bundle download failed", "bundle", bundleName, "error", err)
+				}
+				mu.Lock()
+				failed = append(failed, err)
+				mu.Unlock()
+				return nil
 			}
 
 			if progress != nil {
@@ -104,6 +161,13 @@ func DownloadBundles(ctx context.Context, cache *cache.Cache, patch string, game
 			return nil
 		})
 	}
+	g.Wait()
 
-	return g.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d bundles failed to download: %w", len(failed), downloadableCount, errors.Join(failed...))
+	}
+	return nil
 }
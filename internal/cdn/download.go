@@ -2,11 +2,17 @@ package cdn
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"log/slog"
+	"math/rand/v2"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -18,44 +24,261 @@ var httpClient = &http.Client{
 	},
 }
 
+// retryPolicy is how often and how patiently Download retries. Tests
+// shorten it.
+var retryPolicy = struct {
+	attempts  int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+}{
+	attempts:  6,
+	baseDelay: 500 * time.Millisecond,
+	maxDelay:  30 * time.Second,
+}
+
+// StatusError is a response whose status is neither the content nor a
+// part of it.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+
+	// RetryAfter is the wait the server asked for, if any.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("downloading %s: unexpected status %s", e.URL, e.Status)
+}
+
+// Temporary reports whether the status may clear on its own: timeouts,
+// rate limiting and server errors. Anything else, a 404 above all, fails
+// the same way every time.
+func (e *StatusError) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests:
+		return true
+	}
+	return e.StatusCode >= 500
+}
+
+// ErrShortBody is a response body that ended before its Content-Length.
+var ErrShortBody = errors.New("response body shorter than Content-Length")
+
 // Download fetches url into dest atomically: the body streams to a temp file
 // in dest's directory which is renamed into place only on success, so an
 // interrupted download can never leave a truncated file at dest.
-func Download(ctx context.Context, url, dest string) (err error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return fmt.Errorf("building request for %s: %w", url, err)
-	}
+//
+// Failed attempts are retried with jittered exponential backoff, as long as
+// the failure is one that can clear: network errors, bodies cut short and
+// temporary statuses. A retry continues where the temp file ends with a
+// Range request, guarded by If-Range so a file that changed meanwhile is
+// fetched whole.
+//
+// In offline mode Download fails with ErrOffline without connecting.
+func Download(ctx context.Context, url, dest string) error {
+	_, _, err := DownloadIfModified(ctx, url, dest, Validators{})
+	return err
+}
 
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("requesting %s: %w", url, err)
-	}
-	defer resp.Body.Close()
+// Validators identify one version of a remote file, for conditional
+// requests.
+type Validators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("downloading %s: unexpected status %s", url, resp.Status)
+// DownloadIfModified is Download made conditional on cached, the validators
+// of the version already at dest: if the server answers that the file has
+// not changed since, dest is left alone and modified is false. It returns
+// the validators of the version dest holds afterwards.
+func DownloadIfModified(ctx context.Context, url, dest string, cached Validators) (_ Validators, modified bool, err error) {
+	if offline {
+		return cached, false, fmt.Errorf("downloading %s: %w", url, ErrOffline)
 	}
 
 	tmp, err := os.CreateTemp(filepath.Dir(dest), filepath.Base(dest)+".tmp*")
 	if err != nil {
-		return fmt.Errorf("creating temp file for %s: %w", dest, err)
+		return cached, false, fmt.Errorf("creating temp file for %s: %w", dest, err)
 	}
 	defer func() {
-		if err != nil {
+		if err != nil || !modified {
 			tmp.Close()
 			os.Remove(tmp.Name())
 		}
 	}()
 
-	if _, err = io.Copy(tmp, resp.Body); err != nil {
-		return fmt.Errorf("downloading %s: %w", url, err)
+	state := &fetchState{cached: cached}
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		retry, err = fetch(ctx, url, tmp, state)
+		if err == nil {
+			break
+		}
+		if !retry || attempt >= retryPolicy.attempts || ctx.Err() != nil {
+			if attempt > 1 {
+				err = fmt.Errorf("%w (after %d attempts)", err, attempt)
+			}
+			return cached, false, err
+		}
+
+		delay := backoff(attempt, err)
+		slog.Warn("Download failed, retrying", "url", url, "attempt", attempt, "delay", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return cached, false, ctx.Err()
+		case <-time.After(delay):
+		}
 	}
+	if state.notModified {
+		return cached, false, nil
+	}
+
 	if err = tmp.Close(); err != nil {
-		return fmt.Errorf("closing temp file for %s: %w", dest, err)
+		return cached, false, fmt.Errorf("closing temp file for %s: %w", dest, err)
 	}
 	if err = os.Rename(tmp.Name(), dest); err != nil {
-		return fmt.Errorf("moving download into place at %s: %w", dest, err)
+		return cached, false, fmt.Errorf("moving download into place at %s: %w", dest, err)
+	}
+	return state.got, true, nil
+}
+
+// fetchState carries what one download's attempts learn from each other.
+type fetchState struct {
+	// cached makes the first request conditional; see DownloadIfModified.
+	cached      Validators
+	notModified bool
+
+	// got are the validators of the full response the temp file holds the
+	// start of; a resumed request is made If-Range on them.
+	got Validators
+}
+
+// ifRange is the validator a Range request is made conditional on.
+func (s *fetchState) ifRange() string {
+	if s.got.ETag != "" {
+		return s.got.ETag
+	}
+	return s.got.LastModified
+}
+
+// fetch makes one attempt at completing the download in tmp, resuming from
+// its current size, and reports whether a failure is worth retrying.
+func fetch(ctx context.Context, url string, tmp *os.File, state *fetchState) (retry bool, err error) {
+	offset, err := tmp.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false, fmt.Errorf("seeking temp file for %s: %w", url, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, fmt.Errorf("building request for %s: %w", url, err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if v := state.ifRange(); v != "" {
+			req.Header.Set("If-Range", v)
+		}
+	} else {
+		if state.cached.ETag != "" {
+			req.Header.Set("If-None-Match", state.cached.ETag)
+		}
+		if state.cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", state.cached.LastModified)
+		}
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, fmt.Errorf("requesting %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		if offset == 0 && state.cached != (Validators{}) {
+			state.notModified = true
+			return false, nil
+		}
+		return false, &StatusError{URL: url, StatusCode: resp.StatusCode, Status: resp.Status}
+	case http.StatusOK:
+		// The whole file, either asked for or because the server ignored or
+		// refused the range: start over.
+		if offset > 0 {
+			slog.Debug("Restarting download from the beginning", "url", url, "had", offset)
+		}
+		if err := restart(tmp); err != nil {
+			return false, fmt.Errorf("truncating temp file for %s: %w", url, err)
+		}
+		offset = 0
+		state.got = Validators{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+	case http.StatusPartialContent:
+		if start, ok := rangeStart(resp.Header.Get("Content-Range")); !ok || start != offset {
+			restart(tmp)
+			return true, fmt.Errorf("downloading %s: server resumed at %q, not byte %d", url, resp.Header.Get("Content-Range"), offset)
+		}
+		slog.Debug("Resuming download", "url", url, "offset", offset)
+	default:
+		statusErr := &StatusError{URL: url, StatusCode: resp.StatusCode, Status: resp.Status}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			statusErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			restart(tmp)
+			return true, statusErr
+		}
+		return statusErr.Temporary(), statusErr
+	}
+
+	written, err := io.Copy(tmp, resp.Body)
+	if err != nil {
+		// Failing to write the temp file is local and will not clear.
+		var pathErr *fs.PathError
+		return ctx.Err() == nil && !errors.As(err, &pathErr), fmt.Errorf("downloading %s: %w", url, err)
+	}
+	if resp.ContentLength >= 0 && written != resp.ContentLength {
+		return true, fmt.Errorf("downloading %s: got %d of %d bytes: %w", url, written, resp.ContentLength, ErrShortBody)
+	}
+	return false, nil
+}
+
+// restart empties the temp file for a download from the first byte.
+func restart(tmp *os.File) error {
+	if err := tmp.Truncate(0); err != nil {
+		return err
+	}
+	_, err := tmp.Seek(0, io.SeekStart)
+	return err
+}
+
+// rangeStart parses the first byte position of a Content-Range header,
+// "bytes 100-199/200".
+func rangeStart(contentRange string) (int64, bool) {
+	spec, ok := strings.CutPrefix(contentRange, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	start, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(start, 10, 64)
+	return n, err == nil
+}
+
+// backoff is the wait before retry attempt+1: exponential from baseDelay,
+// capped at maxDelay, with jitter over its upper half so concurrent
+// downloads do not retry in lockstep. A Retry-After the server sent
+// overrides it, up to maxDelay.
+func backoff(attempt int, err error) time.Duration {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		return min(statusErr.RetryAfter, retryPolicy.maxDelay)
+	}
+
+	delay := retryPolicy.baseDelay << (attempt - 1)
+	if delay <= 0 || delay > retryPolicy.maxDelay {
+		delay = retryPolicy.maxDelay
 	}
-	return nil
+	return delay/2 + rand.N(delay/2+1)
 }
@@ -0,0 +1,165 @@
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func init() {
+	retryPolicy.baseDelay = time.Millisecond
+	retryPolicy.maxDelay = 5 * time.Millisecond
+}
+
+// flakyCDN serves content, failing requests as fail decides for the n-th
+// request (from 1): a status to answer with, or -1 to cut the body off
+// halfway. It records each request's Range header.
+type flakyCDN struct {
+	content []byte
+	fail    func(n int) int
+
+	mu     sync.Mutex
+	ranges []string
+}
+
+func (c *flakyCDN) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	c.ranges = append(c.ranges, r.Header.Get("Range"))
+	n := len(c.ranges)
+	c.mu.Unlock()
+
+	switch status := c.fail(n); {
+	case status > 0:
+		http.Error(w, http.StatusText(status), status)
+	case status < 0:
+		// Promise the whole file, send half and drop the connection.
+		w.Header().Set("Content-Length", fmt.Sprint(len(c.content)))
+		w.Header().Set("ETag", `"v1"`)
+		w.Write(c.content[:len(c.content)/2])
+		w.(http.Flusher).Flush()
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	default:
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(c.content))
+	}
+}
+
+func (c *flakyCDN) requests() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.ranges...)
+}
+
+func TestDownloadResumesCutOffBody(t *testing.T) {
+	content := bytes.Repeat([]byte("bundle"), 10000)
+	cdn := &flakyCDN{content: content, fail: func(n int) int {
+		switch n {
+		case 1:
+			return -1
+		case 2:
+			return http.StatusServiceUnavailable
+		}
+		return 0
+	}}
+	server := httptest.NewServer(cdn)
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "a.bundle.bin")
+	if err := Download(context.Background(), server.URL+"/a", dest); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatalf("downloaded %d bytes, want the %d served", len(got), len(content))
+	}
+
+	want := []string{"", fmt.Sprintf("bytes=%d-", len(content)/2), fmt.Sprintf("bytes=%d-", len(content)/2)}
+	if requests := cdn.requests(); strings.Join(requests, ",") != strings.Join(want, ",") {
+		t.Errorf("Range headers = %q, want %q", requests, want)
+	}
+	assertNoTempFiles(t, filepath.Dir(dest))
+}
+
+func TestDownloadDoesNotRetryNotFound(t *testing.T) {
+	cdn := &flakyCDN{fail: func(int) int { return http.StatusNotFound }}
+	server := httptest.NewServer(cdn)
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "missing.bin")
+	err := Download(context.Background(), server.URL+"/missing", dest)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound || statusErr.Temporary() {
+		t.Fatalf("Download = %v, want a permanent 404 StatusError", err)
+	}
+	if n := len(cdn.requests()); n != 1 {
+		t.Errorf("made %d requests, want 1", n)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("dest exists after a failed download: %v", err)
+	}
+	assertNoTempFiles(t, filepath.Dir(dest))
+}
+
+func TestDownloadGivesUpOnShortBodies(t *testing.T) {
+	cdn := &flakyCDN{content: []byte("0123456789"), fail: func(int) int { return -1 }}
+	server := httptest.NewServer(cdn)
+	defer server.Close()
+
+	err := Download(context.Background(), server.URL+"/short", filepath.Join(t.TempDir(), "short.bin"))
+	if err == nil {
+		t.Fatal("Download succeeded on a body that is always cut off")
+	}
+	if n := len(cdn.requests()); n != retryPolicy.attempts {
+		t.Errorf("made %d requests, want %d", n, retryPolicy.attempts)
+	}
+}
+
+func assertNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".tmp") {
+			t.Errorf("temp file %s left behind", e.Name())
+		}
+	}
+}
+
+func TestDownloadIfModifiedRevalidates(t *testing.T) {
+	cdn := &flakyCDN{content: []byte(`{"version":7}`), fail: func(int) int { return 0 }}
+	server := httptest.NewServer(cdn)
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "schema.min.json")
+	validators, modified, err := DownloadIfModified(context.Background(), server.URL+"/schema", dest, Validators{})
+	if err != nil || !modified || validators.ETag != `"v1"` {
+		t.Fatalf("first DownloadIfModified = %+v, %v, %v; want the file and its ETag", validators, modified, err)
+	}
+
+	if err := os.WriteFile(dest, []byte("cached"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	again, modified, err := DownloadIfModified(context.Background(), server.URL+"/schema", dest, validators)
+	if err != nil || modified || again != validators {
+		t.Fatalf("revalidating DownloadIfModified = %+v, %v, %v; want not modified", again, modified, err)
+	}
+	if got, _ := os.ReadFile(dest); string(got) != "cached" {
+		t.Errorf("dest = %q after a 304, want it left alone", got)
+	}
+	assertNoTempFiles(t, filepath.Dir(dest))
+}
@@ -0,0 +1,68 @@
+package cdn
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// offline makes everything in this package that would reach the network
+// fail instead; see SetOffline.
+var offline bool
+
+// SetOffline turns offline mode on or off. While it is on, Download and the
+// patch server refuse to connect, and DownloadIndex and DownloadBundles
+// succeed only when everything asked for is cached already, returning a
+// MissingError otherwise.
+func SetOffline(on bool) {
+	offline = on
+}
+
+// Offline reports whether offline mode is on.
+func Offline() bool {
+	return offline
+}
+
+// ErrOffline is the error of a network request made in offline mode.
+var ErrOffline = errors.New("network access disabled by --offline")
+
+// MissingError lists the inputs an offline run needs that are neither
+// cached nor given locally.
+type MissingError struct {
+	Inputs []MissingInput
+}
+
+// MissingInput is one absent input: what it is, and where it was looked
+// for.
+type MissingInput struct {
+	What string
+	Path string
+}
+
+// Add records an absent input.
+func (e *MissingError) Add(what, path string) {
+	e.Inputs = append(e.Inputs, MissingInput{What: what, Path: path})
+}
+
+// Err returns e if it lists any inputs, and nil otherwise.
+func (e *MissingError) Err() error {
+	if len(e.Inputs) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *MissingError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "offline and %d required inputs are not cached (run once with network access, or from a mirror, to fetch them):", len(e.Inputs))
+	for _, in := range e.Inputs {
+		fmt.Fprintf(&b, "\n  %s: %s", in.What, in.Path)
+	}
+	return b.String()
+}
+
+// Is makes a MissingError match ErrOffline, so callers can tell offline
+// failures from others with a single errors.Is.
+func (e *MissingError) Is(target error) bool {
+	return target == ErrOffline
+}
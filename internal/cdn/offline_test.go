@@ -0,0 +1,68 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jchantrell/exiledb/internal/cache"
+)
+
+func TestOfflineUsesOnlyTheCache(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	c, err := cache.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached := c.BundlePath("4.4.0.13", "Folders/a")
+	if err := os.MkdirAll(filepath.Dir(cached), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cached, []byte("bundle"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { requests++ }))
+	defer server.Close()
+	SetBaseURLs(server.URL, server.URL)
+	SetOffline(true)
+	defer SetBaseURLs("", "")
+	defer SetOffline(false)
+
+	ctx := context.Background()
+	if err := DownloadBundles(ctx, c, "4.4.0.13", 4, []string{"Folders/a"}, false, nil); err != nil {
+		t.Fatalf("DownloadBundles with every bundle cached = %v", err)
+	}
+
+	err = DownloadBundles(ctx, c, "4.4.0.13", 4, []string{"Folders/a", "Folders/b", "Folders/c"}, false, nil)
+	var missing *MissingError
+	if !errors.As(err, &missing) || !errors.Is(err, ErrOffline) {
+		t.Fatalf("DownloadBundles = %v, want a MissingError", err)
+	}
+	var what []string
+	for _, in := range missing.Inputs {
+		what = append(what, in.What)
+	}
+	if got := strings.Join(what, ","); got != "bundle Folders/b,bundle Folders/c" {
+		t.Errorf("missing inputs = %s, want the two uncached bundles", got)
+	}
+
+	if err := DownloadIndex(ctx, c, "4.4.0.13", 4, false); !errors.As(err, &missing) || missing.Inputs[0].Path != c.IndexPath("4.4.0.13") {
+		t.Errorf("DownloadIndex = %v, want the index listed as missing", err)
+	}
+	if err := Download(ctx, server.URL+"/schema.min.json", filepath.Join(t.TempDir(), "schema")); !errors.Is(err, ErrOffline) {
+		t.Errorf("Download = %v, want ErrOffline", err)
+	}
+	if _, err := ResolvePatch(ctx, LatestPoE2Patch); !errors.Is(err, ErrOffline) {
+		t.Errorf("ResolvePatch(latest-poe2) = %v, want ErrOffline", err)
+	}
+	if requests != 0 {
+		t.Errorf("made %d requests while offline", requests)
+	}
+}
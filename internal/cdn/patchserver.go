@@ -0,0 +1,123 @@
+package cdn
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/jchantrell/exiledb/internal/poe"
+)
+
+// Patch server addresses. The game client asks these for the CDN folder of
+// the current patch before it updates.
+const (
+	PoE1PatchServer = "patch.pathofexile.com:12995"
+	PoE2PatchServer = "patch.pathofexile2.com:13060"
+)
+
+// Patch keywords ResolvePatch replaces with the current version of a game.
+// LatestPatch is PoE1's.
+const (
+	LatestPatch     = "latest"
+	LatestPoE1Patch = "latest-poe1"
+	LatestPoE2Patch = "latest-poe2"
+)
+
+// patchServerTimeout bounds the whole exchange; the server answers at once.
+const patchServerTimeout = 15 * time.Second
+
+// ResolvePatch returns patch, or for one of the latest keywords the version
+// the game's patch server currently serves.
+func ResolvePatch(ctx context.Context, patch string) (string, error) {
+	var server string
+	switch strings.ToLower(patch) {
+	case LatestPatch, LatestPoE1Patch:
+		server = PoE1PatchServer
+	case LatestPoE2Patch:
+		server = PoE2PatchServer
+	default:
+		return patch, nil
+	}
+	if offline {
+		return "", fmt.Errorf("resolving %s patch needs the patch server: %w; pass a patch version instead", patch, ErrOffline)
+	}
+
+	version, err := QueryPatchServer(ctx, server)
+	if err != nil {
+		return "", fmt.Errorf("resolving %s patch: %w", patch, err)
+	}
+	slog.Info("Resolved patch version", "patch", patch, "version", version)
+	return version, nil
+}
+
+// QueryPatchServer asks the patch server at addr for the current patch and
+// returns its version, the CDN folder name ConstructURL takes.
+func QueryPatchServer(ctx context.Context, addr string) (string, error) {
+	if offline {
+		return "", fmt.Errorf("querying patch server %s: %w", addr, ErrOffline)
+	}
+	ctx, cancel := context.WithTimeout(ctx, patchServerTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return "", fmt.Errorf("connecting to patch server %s: %w", addr, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write([]byte{0x01, 0x06}); err != nil {
+		return "", fmt.Errorf("querying patch server %s: %w", addr, err)
+	}
+
+	cdnURL, err := readPatchResponse(conn)
+	if err != nil {
+		return "", fmt.Errorf("reading patch server %s response: %w", addr, err)
+	}
+	return patchFromURL(cdnURL)
+}
+
+// readPatchResponse reads the CDN URL from a patch server reply: opcode 0x02,
+// 33 bytes the client does not need, the URL's length in UTF-16 code units
+// as one byte, and the URL in UTF-16LE. A backup URL follows, which is not
+// read.
+func readPatchResponse(r io.Reader) (string, error) {
+	header := make([]byte, 35)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return "", err
+	}
+	if header[0] != 0x02 {
+		return "", fmt.Errorf("unexpected opcode 0x%02x", header[0])
+	}
+
+	units := make([]uint16, header[34])
+	if err := binary.Read(r, binary.LittleEndian, units); err != nil {
+		return "", err
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// patchFromURL takes the version from a CDN folder URL such as
+// https://patch.poecdn.com/3.25.3.4.2/.
+func patchFromURL(cdnURL string) (string, error) {
+	u, err := url.Parse(cdnURL)
+	if err != nil {
+		return "", fmt.Errorf("parsing CDN URL %q: %w", cdnURL, err)
+	}
+	version := path.Base(strings.TrimSuffix(u.Path, "/"))
+	if _, err := poe.ParseGameVersion(version); err != nil {
+		return "", fmt.Errorf("CDN URL %q does not name a patch: %w", cdnURL, err)
+	}
+	return version, nil
+}
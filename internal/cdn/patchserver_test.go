@@ -0,0 +1,73 @@
+package cdn
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// standInPatchServer answers each connection's query like the real patch
+// server, with urls as the CDN and backup URLs, split over two writes.
+func standInPatchServer(t *testing.T, urls ...string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	reply := make([]byte, 34)
+	reply[0] = 0x02
+	for _, u := range urls {
+		units := utf16.Encode([]rune(u))
+		reply = append(reply, byte(len(units)))
+		for _, unit := range units {
+			reply = binary.LittleEndian.AppendUint16(reply, unit)
+		}
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			query := make([]byte, 2)
+			if _, err := io.ReadFull(conn, query); err != nil || query[0] != 0x01 {
+				conn.Close()
+				continue
+			}
+			conn.Write(reply[:20])
+			conn.Write(reply[20:])
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestQueryPatchServer(t *testing.T) {
+	addr := standInPatchServer(t, "https://patch.poecdn.com/3.26.0.11/", "https://patch-backup.poecdn.com/3.26.0.11/")
+	version, err := QueryPatchServer(context.Background(), addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "3.26.0.11" {
+		t.Errorf("QueryPatchServer = %q, want 3.26.0.11", version)
+	}
+
+	addr = standInPatchServer(t, "https://patch.poecdn.com/maintenance/")
+	if _, err := QueryPatchServer(context.Background(), addr); err == nil || !strings.Contains(err.Error(), "maintenance") {
+		t.Errorf("QueryPatchServer with no version in the URL = %v, want an error", err)
+	}
+}
+
+func TestResolvePatchLeavesVersions(t *testing.T) {
+	patch, err := ResolvePatch(context.Background(), "4.4.0.13")
+	if err != nil || patch != "4.4.0.13" {
+		t.Errorf("ResolvePatch(4.4.0.13) = %q, %v", patch, err)
+	}
+}
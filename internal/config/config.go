@@ -2,7 +2,10 @@ package config
 
 import (
 	"fmt"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -14,10 +17,51 @@ type Config struct {
 	LogLevel   string
 	LogFormat  string
 	GgpkPath   string
+	GameDir    string
 	SchemaPath string
+
+	// SchemaVersion and SchemaAt pin the community schema to the newest
+	// archived one with that format version, or created at or before that
+	// time; see ParseSchemaAt. Only SchemaAt names one schema for good: the
+	// newest of a format version changes as schemas are archived.
+	SchemaVersion int
+	SchemaAt      string
+
+	// Offline forbids network access: only cached and local inputs are
+	// used.
+	Offline bool
+
+	// CDNURL replaces the official CDN for both games; PoE1CDNURL and
+	// PoE2CDNURL, which config files can set, replace it for one game.
+	CDNURL     string
+	PoE1CDNURL string
+	PoE2CDNURL string
+}
+
+// CDNURLs returns the CDN roots to use for PoE1 and PoE2, empty for the
+// official CDN.
+func (c *Config) CDNURLs() (poe1, poe2 string) {
+	poe1, poe2 = c.CDNURL, c.CDNURL
+	if c.PoE1CDNURL != "" {
+		poe1 = c.PoE1CDNURL
+	}
+	if c.PoE2CDNURL != "" {
+		poe2 = c.PoE2CDNURL
+	}
+	return poe1, poe2
+}
+
+// LocalSource reports whether bundles are read from a Content.ggpk or a
+// game install rather than downloaded from the CDN.
+func (c *Config) LocalSource() bool {
+	return c.GgpkPath != "" || c.GameDir != ""
 }
 
 func Validate(cfg *Config) error {
+	if cfg.GgpkPath != "" && cfg.GameDir != "" {
+		return fmt.Errorf("--ggpk and --game-dir cannot be combined")
+	}
+
 	if err := validateTableNames(cfg.Tables); err != nil {
 		return fmt.Errorf("invalid table configuration: %w", err)
 	}
@@ -26,6 +70,22 @@ func Validate(cfg *Config) error {
 		return fmt.Errorf("invalid language configuration: %w", err)
 	}
 
+	for _, u := range []string{cfg.CDNURL, cfg.PoE1CDNURL, cfg.PoE2CDNURL} {
+		if err := validateCDNURL(u); err != nil {
+			return err
+		}
+	}
+
+	if (cfg.SchemaVersion != 0 || cfg.SchemaAt != "") && cfg.SchemaPath != "" {
+		return fmt.Errorf("--schema-version and --schema-at pin an archived schema and cannot be combined with --schema")
+	}
+	if cfg.SchemaVersion < 0 {
+		return fmt.Errorf("invalid schema version %d", cfg.SchemaVersion)
+	}
+	if _, err := ParseSchemaAt(cfg.SchemaAt); err != nil {
+		return err
+	}
+
 	if len(cfg.Languages) == 0 {
 		cfg.Languages = []string{"English"}
 	}
@@ -39,3 +99,37 @@ func Validate(cfg *Config) error {
 
 	return nil
 }
+
+// validateCDNURL checks that a CDN root is an absolute http or https URL.
+func validateCDNURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid CDN URL %q: %w", raw, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid CDN URL %q: expected http:// or https://", raw)
+	}
+	return nil
+}
+
+// ParseSchemaAt parses a --schema-at time: RFC 3339, as _meta records
+// schema_created_at, a Unix timestamp, or a date, which stands for the end
+// of that day in UTC. An empty string is the zero time.
+func ParseSchemaAt(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t.Add(24*time.Hour - time.Second), nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && n > 0 {
+		return time.Unix(n, 0).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid schema time %q: expected a date (2026-01-31), RFC 3339 time or Unix timestamp", s)
+}
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchemaAt(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want time.Time
+		err  bool
+	}{
+		{in: ""},
+		{in: "2026-01-31T12:30:00Z", want: time.Date(2026, 1, 31, 12, 30, 0, 0, time.UTC)},
+		// A date means the whole day: every schema created on it matches.
+		{in: "2026-01-31", want: time.Date(2026, 1, 31, 23, 59, 59, 0, time.UTC)},
+		{in: "1769862600", want: time.Unix(1769862600, 0).UTC()},
+		{in: "0", err: true},
+		{in: "31/01/2026", err: true},
+	} {
+		got, err := ParseSchemaAt(tt.in)
+		if (err != nil) != tt.err || !got.Equal(tt.want) {
+			t.Errorf("ParseSchemaAt(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// FileNames are the project config files FindFile looks for, in order of
+// preference within a directory.
+var FileNames = []string{"exiledb.toml", "exiledb.yaml", "exiledb.yml"}
+
+// File is a project config file. Its top-level settings apply to every
+// command; a named profile's settings are layered over them, so a repository
+// can keep one file with a profile per extraction:
+//
+//	patch = "4.4.0.13"
+//	languages = ["English", "French"]
+//
+//	[profiles.items]
+//	tables = ["BaseItemTypes", "ItemClasses"]
+//
+//	[profiles.icons]
+//	files = ["art/2dart/skillicons"]
+type File struct {
+	Settings `yaml:",inline"`
+	Profiles map[string]Settings `toml:"profiles" yaml:"profiles"`
+
+	// dir is the directory holding the file; relative paths in it are
+	// resolved against it rather than the working directory.
+	dir string
+}
+
+// Settings mirrors the Config fields a file can set. Nil fields leave the
+// value from the layer below in place.
+type Settings struct {
+	Patch     *string  `toml:"patch" yaml:"patch"`
+	Database  *string  `toml:"database" yaml:"database"`
+	Tables    []string `toml:"tables" yaml:"tables"`
+	Files     []string `toml:"files" yaml:"files"`
+	Languages []string `toml:"languages" yaml:"languages"`
+	LogLevel  *string  `toml:"log_level" yaml:"log_level"`
+	LogFormat *string  `toml:"log_format" yaml:"log_format"`
+	Ggpk      *string  `toml:"ggpk" yaml:"ggpk"`
+	GameDir   *string  `toml:"game_dir" yaml:"game_dir"`
+	Schema    *string  `toml:"schema" yaml:"schema"`
+	Offline   *bool    `toml:"offline" yaml:"offline"`
+
+	SchemaVersion *int    `toml:"schema_version" yaml:"schema_version"`
+	SchemaAt      *string `toml:"schema_at" yaml:"schema_at"`
+
+	CDNURL     *string `toml:"cdn_url" yaml:"cdn_url"`
+	PoE1CDNURL *string `toml:"poe1_cdn_url" yaml:"poe1_cdn_url"`
+	PoE2CDNURL *string `toml:"poe2_cdn_url" yaml:"poe2_cdn_url"`
+}
+
+// FindFile looks for a project config file in dir and each of its parents,
+// returning the first found, or "" if there is none.
+func FindFile(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		for _, name := range FileNames {
+			path := filepath.Join(dir, name)
+			info, err := os.Stat(path)
+			if err == nil && !info.IsDir() {
+				return path, nil
+			}
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return "", fmt.Errorf("checking for config file: %w", err)
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// LoadFile reads a TOML or YAML config file, chosen by extension. Unknown
+// keys are errors, so a misspelled setting does not silently do nothing.
+func LoadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	f := &File{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".toml":
+		md, err := toml.Decode(string(data), f)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("parsing %s: unknown setting %q", path, undecoded[0].String())
+		}
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(f); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config file %s: expected .toml, .yaml or .yml", path)
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	f.dir = filepath.Dir(abs)
+	return f, nil
+}
+
+// ProfileNames returns the file's profile names, sorted.
+func (f *File) ProfileNames() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Apply fills cfg from the file's top-level settings and then, if profile
+// is not empty, from that profile. Fields whose flag was given on the
+// command line, as reported by changed with the flag's name, keep their
+// flag value.
+func (f *File) Apply(cfg *Config, profile string, changed func(flag string) bool) error {
+	layers := []Settings{f.Settings}
+	if profile != "" {
+		p, ok := f.Profiles[profile]
+		if !ok {
+			return fmt.Errorf("config file has no profile %q (profiles: %s)", profile, strings.Join(f.ProfileNames(), ", "))
+		}
+		layers = append(layers, p)
+	}
+
+	for _, s := range layers {
+		setString(&cfg.Patch, s.Patch, "patch", changed)
+		setString(&cfg.Database, f.path(s.Database), "database", changed)
+		setSlice(&cfg.Tables, s.Tables, "tables", changed)
+		setSlice(&cfg.Files, s.Files, "files", changed)
+		setSlice(&cfg.Languages, s.Languages, "languages", changed)
+		setString(&cfg.LogLevel, s.LogLevel, "log-level", changed)
+		setString(&cfg.LogFormat, s.LogFormat, "log-format", changed)
+		setString(&cfg.GgpkPath, f.path(s.Ggpk), "ggpk", changed)
+		setString(&cfg.GameDir, f.path(s.GameDir), "game-dir", changed)
+		setString(&cfg.SchemaPath, f.path(s.Schema), "schema", changed)
+		if s.Offline != nil && !changed("offline") {
+			cfg.Offline = *s.Offline
+		}
+		if s.SchemaVersion != nil && !changed("schema-version") {
+			cfg.SchemaVersion = *s.SchemaVersion
+		}
+		setString(&cfg.SchemaAt, s.SchemaAt, "schema-at", changed)
+		// --cdn-url replaces the CDN for both games, so it also overrides
+		// the per-game keys.
+		setString(&cfg.CDNURL, s.CDNURL, "cdn-url", changed)
+		setString(&cfg.PoE1CDNURL, s.PoE1CDNURL, "cdn-url", changed)
+		setString(&cfg.PoE2CDNURL, s.PoE2CDNURL, "cdn-url", changed)
+	}
+	return nil
+}
+
+// path resolves a relative path setting against the file's directory.
+// Database URLs are left alone.
+func (f *File) path(p *string) *string {
+	if p == nil || *p == "" || filepath.IsAbs(*p) || strings.Contains(*p, "://") {
+		return p
+	}
+	resolved := filepath.Join(f.dir, *p)
+	return &resolved
+}
+
+func setString(dst *string, value *string, flag string, changed func(string) bool) {
+	if value != nil && !changed(flag) {
+		*dst = *value
+	}
+}
+
+func setSlice(dst *[]string, value []string, flag string, changed func(string) bool) {
+	if value != nil && !changed(flag) {
+		*dst = slices.Clone(value)
+	}
+}
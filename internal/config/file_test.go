@@ -0,0 +1,121 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestConfigFile(t *testing.T) {
+	files := map[string]string{
+		"exiledb.toml": `
+patch = "4.4.0.13"
+database = "data/exile.db"
+languages = ["English", "French"]
+
+[profiles.mods]
+tables = ["Mods", "Stats"]
+languages = ["German"]
+`,
+		"exiledb.yaml": `
+patch: "4.4.0.13"
+database: data/exile.db
+languages: [English, French]
+profiles:
+  mods:
+    tables: [Mods, Stats]
+    languages: [German]
+`,
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			nested := filepath.Join(root, "a", "b")
+			if err := os.MkdirAll(nested, 0o755); err != nil {
+				t.Fatal(err)
+			}
+
+			path, err := FindFile(nested)
+			if err != nil || filepath.Base(path) != name {
+				t.Fatalf("FindFile = %q, %v; want %s", path, err, name)
+			}
+			file, err := LoadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// --patch was given on the command line, so it wins over the file.
+			cfg := &Config{Patch: "4.4.0.12", Database: "exile.db", Languages: []string{"English"}}
+			changed := func(flag string) bool { return flag == "patch" }
+			if err := file.Apply(cfg, "mods", changed); err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Patch != "4.4.0.12" {
+				t.Errorf("Patch = %q, want the flag's 4.4.0.12", cfg.Patch)
+			}
+			if want := filepath.Join(root, "data", "exile.db"); cfg.Database != want {
+				t.Errorf("Database = %q, want %q", cfg.Database, want)
+			}
+			if !slices.Equal(cfg.Tables, []string{"Mods", "Stats"}) || !slices.Equal(cfg.Languages, []string{"German"}) {
+				t.Errorf("Tables, Languages = %v, %v; want the profile's", cfg.Tables, cfg.Languages)
+			}
+
+			if err := file.Apply(&Config{}, "icons", changed); err == nil || !strings.Contains(err.Error(), "mods") {
+				t.Errorf("Apply with unknown profile = %v, want an error listing mods", err)
+			}
+		})
+	}
+}
+
+func TestConfigFileUnknownSetting(t *testing.T) {
+	for name, content := range map[string]string{
+		"exiledb.toml": "tabels = [\"Mods\"]\n",
+		"exiledb.yaml": "tabels: [Mods]\n",
+	} {
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadFile(path); err == nil || !strings.Contains(err.Error(), "tabels") {
+			t.Errorf("LoadFile(%s) = %v, want an error naming tabels", name, err)
+		}
+	}
+}
+
+func TestConfigFileCDNURLs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exiledb.toml")
+	content := "cdn_url = \"http://mirror.internal/poe1\"\npoe2_cdn_url = \"http://mirror.internal/poe2\"\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{}
+	if err := file.Apply(cfg, "", func(string) bool { return false }); err != nil {
+		t.Fatal(err)
+	}
+	if poe1, poe2 := cfg.CDNURLs(); poe1 != "http://mirror.internal/poe1" || poe2 != "http://mirror.internal/poe2" {
+		t.Errorf("CDNURLs = %q, %q; want cdn_url for PoE1 and poe2_cdn_url for PoE2", poe1, poe2)
+	}
+
+	// --cdn-url on the command line replaces the file's keys for both games.
+	cfg = &Config{CDNURL: "https://other.example"}
+	if err := file.Apply(cfg, "", func(flag string) bool { return flag == "cdn-url" }); err != nil {
+		t.Fatal(err)
+	}
+	if poe1, poe2 := cfg.CDNURLs(); poe1 != "https://other.example" || poe2 != "https://other.example" {
+		t.Errorf("CDNURLs = %q, %q; want the flag's for both", poe1, poe2)
+	}
+
+	if err := Validate(&Config{CDNURL: "mirror.internal"}); err == nil {
+		t.Error("Validate accepted a CDN URL without a scheme")
+	}
+}
@@ -1,21 +1,147 @@
 package config
 
-import "fmt"
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
 
-func validateTableNames(tables []string) error {
-	for _, table := range tables {
-		if table == "" {
-			return fmt.Errorf("table name cannot be empty")
+	"github.com/jchantrell/exiledb/internal/poe"
+)
+
+// TableSelector picks schema tables by the terms given to --tables:
+//
+//	Mods            the table Mods (or mods: names compare snake-cased)
+//	Passive*        tables whose name matches a glob (*, ? and [...])
+//	tag:items       tables the schema tags items
+//	all             every table
+//	-Unused*        leaves out what the rest of the term selects
+//
+// A table is selected when any plain term matches it and no exclusion does.
+// Exclusions alone start from every table.
+type TableSelector struct {
+	include []tableTerm
+	exclude []tableTerm
+	matched []bool // per include term, whether it has matched a table
+}
+
+type tableTerm struct {
+	raw   string
+	all   bool
+	tag   string
+	glob  string // lowercased
+	exact string // snake-cased
+}
+
+// ParseTableSelector parses --tables terms.
+func ParseTableSelector(terms []string) (*TableSelector, error) {
+	s := &TableSelector{}
+	for _, raw := range terms {
+		term, exclude := strings.CutPrefix(raw, "-")
+		t, err := parseTableTerm(term)
+		if err != nil {
+			return nil, err
+		}
+		t.raw = raw
+		if exclude {
+			s.exclude = append(s.exclude, t)
+		} else {
+			s.include = append(s.include, t)
+		}
+	}
+	if len(s.include) == 0 && len(s.exclude) > 0 {
+		s.include = []tableTerm{{raw: "all", all: true}}
+	}
+	s.matched = make([]bool, len(s.include))
+	return s, nil
+}
+
+func parseTableTerm(term string) (tableTerm, error) {
+	if term == "" {
+		return tableTerm{}, fmt.Errorf("table name cannot be empty")
+	}
+	if strings.EqualFold(term, "all") {
+		return tableTerm{all: true}, nil
+	}
+	if tag, ok := strings.CutPrefix(term, "tag:"); ok {
+		if tag == "" {
+			return tableTerm{}, fmt.Errorf("invalid table selector '%s': tag name cannot be empty", term)
 		}
+		return tableTerm{tag: tag}, nil
+	}
 
-		for _, char := range table {
-			if !((char >= 'a' && char <= 'z') ||
-				(char >= 'A' && char <= 'Z') ||
-				(char >= '0' && char <= '9') ||
-				char == '_') {
-				return fmt.Errorf("invalid table name '%s': contains invalid character '%c', only alphanumeric characters and underscores are allowed", table, char)
-			}
+	isGlob := strings.ContainsAny(term, "*?[")
+	for _, char := range term {
+		if !((char >= 'a' && char <= 'z') ||
+			(char >= 'A' && char <= 'Z') ||
+			(char >= '0' && char <= '9') ||
+			char == '_' ||
+			(isGlob && strings.ContainsRune("*?[]^-", char))) {
+			return tableTerm{}, fmt.Errorf("invalid table name '%s': contains invalid character '%c', only alphanumeric characters, underscores and glob patterns are allowed", term, char)
 		}
 	}
-	return nil
+	if !isGlob {
+		return tableTerm{exact: poe.ToSnakeCase(term)}, nil
+	}
+	glob := strings.ToLower(term)
+	if _, err := path.Match(glob, ""); err != nil {
+		return tableTerm{}, fmt.Errorf("invalid table pattern '%s': %w", term, err)
+	}
+	return tableTerm{glob: glob}, nil
+}
+
+// Match reports whether the selector selects the table name, tagged tags.
+func (s *TableSelector) Match(name string, tags []string) bool {
+	selected := false
+	for i, t := range s.include {
+		if t.match(name, tags) {
+			s.matched[i] = true
+			selected = true
+		}
+	}
+	if !selected {
+		return false
+	}
+	for _, t := range s.exclude {
+		if t.match(name, tags) {
+			return false
+		}
+	}
+	return true
+}
+
+// Unmatched returns the terms that have not matched any table passed to
+// Match, usually misspellings.
+func (s *TableSelector) Unmatched() []string {
+	var terms []string
+	for i, t := range s.include {
+		if !s.matched[i] {
+			terms = append(terms, t.raw)
+		}
+	}
+	return terms
+}
+
+// match compares globs against both the schema name and its snake_case
+// form, so Passive* and passive_* select the same tables.
+func (t tableTerm) match(name string, tags []string) bool {
+	switch {
+	case t.all:
+		return true
+	case t.tag != "":
+		return slices.ContainsFunc(tags, func(tag string) bool { return strings.EqualFold(tag, t.tag) })
+	case t.glob != "":
+		if ok, _ := path.Match(t.glob, strings.ToLower(name)); ok {
+			return true
+		}
+		ok, _ := path.Match(t.glob, poe.ToSnakeCase(name))
+		return ok
+	default:
+		return poe.ToSnakeCase(name) == t.exact
+	}
+}
+
+func validateTableNames(tables []string) error {
+	_, err := ParseTableSelector(tables)
+	return err
 }
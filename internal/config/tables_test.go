@@ -0,0 +1,58 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTableSelector(t *testing.T) {
+	tables := []struct {
+		name string
+		tags []string
+	}{
+		{"Mods", []string{"mods"}},
+		{"PassiveSkills", []string{"passives"}},
+		{"PassiveTreeExpansionJewels", []string{"passives", "items"}},
+		{"BaseItemTypes", []string{"items"}},
+		{"UnusedPassives", nil},
+	}
+
+	tests := []struct {
+		terms     []string
+		want      []string
+		unmatched []string
+	}{
+		{[]string{"mods"}, []string{"Mods"}, nil},
+		{[]string{"base_item_types", "Nope"}, []string{"BaseItemTypes"}, []string{"Nope"}},
+		{[]string{"Passive*"}, []string{"PassiveSkills", "PassiveTreeExpansionJewels"}, nil},
+		{[]string{"passive_*", "-*Jewels"}, []string{"PassiveSkills"}, nil},
+		{[]string{"tag:items", "-BaseItemTypes"}, []string{"PassiveTreeExpansionJewels"}, nil},
+		{[]string{"-Unused*", "-tag:Passives"}, []string{"Mods", "BaseItemTypes"}, nil},
+		{[]string{"all", "-Unused*"}, []string{"Mods", "PassiveSkills", "PassiveTreeExpansionJewels", "BaseItemTypes"}, nil},
+	}
+	for _, tt := range tests {
+		s, err := ParseTableSelector(tt.terms)
+		if err != nil {
+			t.Errorf("ParseTableSelector(%q): %v", tt.terms, err)
+			continue
+		}
+		var got []string
+		for _, table := range tables {
+			if s.Match(table.name, table.tags) {
+				got = append(got, table.name)
+			}
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q selects %v, want %v", tt.terms, got, tt.want)
+		}
+		if unmatched := s.Unmatched(); !slices.Equal(unmatched, tt.unmatched) {
+			t.Errorf("%q leaves %v unmatched, want %v", tt.terms, unmatched, tt.unmatched)
+		}
+	}
+
+	for _, bad := range []string{"", "-", "tag:", "Mods;", "Mods-Stats", "Passive[", "item.types"} {
+		if _, err := ParseTableSelector([]string{bad}); err == nil {
+			t.Errorf("ParseTableSelector(%q) succeeded, want an error", bad)
+		}
+	}
+}
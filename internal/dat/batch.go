@@ -0,0 +1,525 @@
+package dat
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+)
+
+// ColumnKind is the storage class of a decoded column. Every field type
+// decodes into one of a few Go representations, so consumers switch on the
+// kind rather than on the field type.
+type ColumnKind int
+
+const (
+	// KindInt holds bools (0 or 1), integers, row references (the referenced
+	// row index) and longids. Unsigned 64-bit values wrap into int64.
+	KindInt ColumnKind = iota
+	KindFloat
+	KindString
+	// KindArray holds a list per row of elements of the column's Elem kind.
+	KindArray
+)
+
+// Bitmap is a set of row positions, one bit per row.
+type Bitmap []uint64
+
+// Has reports whether row i is in the set.
+func (b Bitmap) Has(i int) bool {
+	return b[i/64]&(1<<(i%64)) != 0
+}
+
+func (b Bitmap) set(i int) {
+	b[i/64] |= 1 << (i % 64)
+}
+
+// Column is one field of a Batch. Scalar columns populate only the slice
+// matching Kind, indexed by the row's position in the batch. Array columns
+// hold every row's elements back to back in the slice matching Elem; Elems
+// returns where a row's are. Nulls marks rows whose value is null: null
+// references and longids, and fields that could not be read.
+type Column struct {
+	Field string
+	Kind  ColumnKind
+	// Type is the field's schema type, for arrays the type of each element.
+	Type    FieldType
+	Ints    []int64
+	Floats  []float64
+	Strings []string
+	Nulls   Bitmap
+
+	// Elem is the kind of an array column's elements. Row i's elements are
+	// at Offsets[i]:Offsets[i+1], and ElemNulls marks null elements (null
+	// row references) by their position in the element slice.
+	Elem      ColumnKind
+	Offsets   []int
+	ElemNulls Bitmap
+}
+
+// IsNull reports whether the column is null at row position i.
+func (c *Column) IsNull(i int) bool {
+	return c.Nulls.Has(i)
+}
+
+// Elems returns the bounds of row position i's elements in an array
+// column's element slice. Null rows have none.
+func (c *Column) Elems(i int) (start, end int) {
+	return c.Offsets[i], c.Offsets[i+1]
+}
+
+// ElemIsNull reports whether element j of an array column is null.
+func (c *Column) ElemIsNull(j int) bool {
+	return j/64 < len(c.ElemNulls) && c.ElemNulls.Has(j)
+}
+
+// AppendJSON appends row position i of an array column to buf as a JSON
+// array. Bools encode as true and false, u64 elements unsigned, and null
+// elements and non-finite floats as null.
+func (c *Column) AppendJSON(buf []byte, i int) []byte {
+	start, end := c.Elems(i)
+	buf = append(buf, '[')
+	for j := start; j < end; j++ {
+		if j > start {
+			buf = append(buf, ',')
+		}
+		switch {
+		case c.ElemIsNull(j):
+			buf = append(buf, "null"...)
+		case c.Elem == KindFloat:
+			buf = appendJSONFloat(buf, c.Floats[j], c.Type)
+		case c.Elem == KindString:
+			b, _ := json.Marshal(c.Strings[j]) // Marshaling a string cannot fail
+			buf = append(buf, b...)
+		case c.Type == TypeBool:
+			buf = strconv.AppendBool(buf, c.Ints[j] != 0)
+		case c.Type == TypeUint64:
+			buf = strconv.AppendUint(buf, uint64(c.Ints[j]), 10)
+		default:
+			buf = strconv.AppendInt(buf, c.Ints[j], 10)
+		}
+	}
+	return append(buf, ']')
+}
+
+// appendJSONFloat formats v as encoding/json does, at the precision of its
+// field type, with non-finite values as null.
+func appendJSONFloat(buf []byte, v float64, ft FieldType) []byte {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return append(buf, "null"...)
+	}
+	bits := 64
+	if ft == TypeFloat32 {
+		bits = 32
+	}
+	format := byte('f')
+	if abs := math.Abs(v); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) ||
+			bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	buf = strconv.AppendFloat(buf, v, format, -1, bits)
+	if format == 'e' {
+		// Shorten e-09 to e-9, as encoding/json does.
+		n := len(buf)
+		if n >= 4 && buf[n-4] == 'e' && buf[n-3] == '-' && buf[n-2] == '0' {
+			buf[n-2] = buf[n-1]
+			buf = buf[:n-1]
+		}
+	}
+	return buf
+}
+
+// reset resizes the column for n rows, reusing its backing arrays, and
+// clears the null set.
+func (c *Column) reset(n int) {
+	switch c.Kind {
+	case KindInt:
+		c.Ints = resize(c.Ints, n)
+	case KindFloat:
+		c.Floats = resize(c.Floats, n)
+	case KindString:
+		c.Strings = resize(c.Strings, n)
+	case KindArray:
+		c.Ints, c.Floats, c.Strings = c.Ints[:0], c.Floats[:0], c.Strings[:0]
+		c.Offsets = resize(c.Offsets, n+1)
+		c.Offsets[0] = 0
+		c.ElemNulls = c.ElemNulls[:0]
+	}
+	c.Nulls = resize(c.Nulls, (n+63)/64)
+	clear(c.Nulls)
+}
+
+// elemCount returns how many elements an array column holds.
+func (c *Column) elemCount() int {
+	switch c.Elem {
+	case KindFloat:
+		return len(c.Floats)
+	case KindString:
+		return len(c.Strings)
+	}
+	return len(c.Ints)
+}
+
+// truncateElems drops the elements after the first n, undoing a partly
+// decoded array.
+func (c *Column) truncateElems(n int) {
+	switch c.Elem {
+	case KindFloat:
+		c.Floats = c.Floats[:n]
+	case KindString:
+		c.Strings = c.Strings[:n]
+	default:
+		c.Ints = c.Ints[:n]
+	}
+}
+
+// setElemNull marks element j of an array column null, growing ElemNulls
+// as needed.
+func (c *Column) setElemNull(j int) {
+	for len(c.ElemNulls) <= j/64 {
+		c.ElemNulls = append(c.ElemNulls, 0)
+	}
+	c.ElemNulls.set(j)
+}
+
+func resize[T any](s []T, n int) []T {
+	if cap(s) < n {
+		return make([]T, n)
+	}
+	return s[:n]
+}
+
+// Batch is a run of consecutive rows decoded column by column. Columns are
+// in FieldNames order. A batch is reused across ReadBatch calls, so values
+// must be consumed before the next read.
+type Batch struct {
+	// Start is the file index of the batch's first row.
+	Start   int
+	Len     int
+	Columns []Column
+}
+
+// FieldNames lists the parser field names of schema in column order, with
+// interval columns split into their min and max fields. It is the column
+// order of every Batch decoded with schema.
+func FieldNames(schema *TableSchema) []string {
+	var names []string
+	for i := range schema.Columns {
+		column := &schema.Columns[i]
+		if column.Interval && !column.Array {
+			minField, maxField := IntervalFieldNames(column, i)
+			names = append(names, minField, maxField)
+			continue
+		}
+		names = append(names, FieldName(column, i))
+	}
+	return names
+}
+
+// NewBatch allocates an empty batch laid out for the reader's schema.
+func (r *RowReader) NewBatch() *Batch {
+	b := &Batch{}
+	for i := range r.schema.Columns {
+		column := &r.schema.Columns[i]
+		kind := fieldTypes[column.Type].codec.kind
+		if column.Interval && !column.Array {
+			minField, maxField := IntervalFieldNames(column, i)
+			b.Columns = append(b.Columns,
+				Column{Field: minField, Kind: kind, Type: column.Type},
+				Column{Field: maxField, Kind: kind, Type: column.Type})
+			continue
+		}
+		col := Column{Field: FieldName(column, i), Kind: kind, Type: column.Type}
+		if column.Array {
+			col.Kind, col.Elem = KindArray, kind
+		}
+		b.Columns = append(b.Columns, col)
+	}
+	return b
+}
+
+// ReadBatch decodes up to max of the next rows into b and returns how many it
+// decoded, 0 once every row has been read. It shares its position with Next.
+// Fields that cannot be read are null, as are the row's later fields,
+// matching the fields Next leaves out.
+func (r *RowReader) ReadBatch(b *Batch, max int) int {
+	n := min(max, r.count-r.next)
+	if n <= 0 {
+		return 0
+	}
+
+	b.Start = r.next
+	b.Len = n
+	for i := range b.Columns {
+		b.Columns[i].reset(n)
+	}
+	for k := range n {
+		i := r.next + k
+		r.decoder.decodeRow(b, k, r.fixed[i*r.rowSize:(i+1)*r.rowSize], r.schema)
+		for j := range b.Columns {
+			if c := &b.Columns[j]; c.Kind == KindArray {
+				c.Offsets[k+1] = c.elemCount()
+			}
+		}
+	}
+	r.next += n
+	return n
+}
+
+func (d *decoder) decodeRow(b *Batch, row int, rowData []byte, schema *TableSchema) {
+	offset := 0
+	slot := 0
+	failed := false
+
+	for i := range schema.Columns {
+		column := &schema.Columns[i]
+		size := fieldSize(column)
+		fieldData := rowData[min(offset, len(rowData)):min(offset+size, len(rowData))]
+		offset += size
+
+		if column.Interval && !column.Array {
+			half := column.Type.Size()
+			minCol, maxCol := &b.Columns[slot], &b.Columns[slot+1]
+			slot += 2
+			if column.absent {
+				minCol.Nulls.set(row)
+				maxCol.Nulls.set(row)
+				continue
+			}
+			if failed || len(fieldData) < size {
+				failed = true
+				minCol.Nulls.set(row)
+				maxCol.Nulls.set(row)
+				continue
+			}
+			if !d.decodeColumn(fieldData[:half], column, minCol, row) ||
+				!d.decodeColumn(fieldData[half:], column, maxCol, row) {
+				slog.Debug("Could not read field", "name", minCol.Field, "fieldStart", offset-size)
+				failed = true
+				minCol.Nulls.set(row)
+				maxCol.Nulls.set(row)
+			}
+			continue
+		}
+
+		col := &b.Columns[slot]
+		slot++
+		if column.absent {
+			col.Nulls.set(row)
+			continue
+		}
+		if failed || len(fieldData) < size {
+			failed = true
+			col.Nulls.set(row)
+			continue
+		}
+		if !d.decodeColumn(fieldData, column, col, row) {
+			slog.Debug("Could not read field", "name", col.Field, "fieldStart", offset-size)
+			failed = true
+			col.Nulls.set(row)
+		}
+	}
+}
+
+// decodeColumn decodes one field into col at position row. It reports false
+// when the field cannot be read.
+func (d *decoder) decodeColumn(data []byte, column *TableColumn, col *Column, row int) bool {
+	if column.Array {
+		return d.decodeArray(data, column, col) == nil
+	}
+
+	c := fieldTypes[column.Type].codec
+	if c.column == nil {
+		return false
+	}
+	return c.column(d, data, col, row) == nil
+}
+
+// decodeArray appends an array field's elements to col. A field that cannot
+// be read appends none.
+func (d *decoder) decodeArray(data []byte, column *TableColumn, col *Column) error {
+	elements, count, err := d.arrayElements(data, column)
+	if err != nil || count == 0 {
+		return err
+	}
+	c := fieldTypes[column.Type].codec
+	if c.elems == nil {
+		return fmt.Errorf("array: unsupported element type %s", column.Type)
+	}
+	n := col.elemCount()
+	if err := c.elems(d, elements, count, col); err != nil {
+		col.truncateElems(n)
+		return err
+	}
+	return nil
+}
+
+func intColumn[T int16 | uint16 | int32 | uint32 | int64 | uint64](decode func([]byte) T) func(*decoder, []byte, *Column, int) error {
+	return func(_ *decoder, data []byte, col *Column, row int) error {
+		col.Ints[row] = int64(decode(data))
+		return nil
+	}
+}
+
+func floatColumn[T float32 | float64](decode func([]byte) T) func(*decoder, []byte, *Column, int) error {
+	return func(_ *decoder, data []byte, col *Column, row int) error {
+		col.Floats[row] = float64(decode(data))
+		return nil
+	}
+}
+
+func boolColumn(_ *decoder, data []byte, col *Column, row int) error {
+	if data[0] != 0 {
+		col.Ints[row] = 1
+	} else {
+		col.Ints[row] = 0
+	}
+	return nil
+}
+
+func stringColumn(d *decoder, data []byte, col *Column, row int) error {
+	value, err := d.readString(uint64(binary.LittleEndian.Uint32(data)))
+	if err != nil {
+		return err
+	}
+	col.Strings[row] = value
+	return nil
+}
+
+func refColumn(_ *decoder, data []byte, col *Column, row int) error {
+	value := binary.LittleEndian.Uint32(data)
+	if value == NullRowSentinel {
+		col.Nulls.set(row)
+		return nil
+	}
+	col.Ints[row] = int64(value)
+	return nil
+}
+
+func longIDColumn(_ *decoder, data []byte, col *Column, row int) error {
+	value, null, err := readLongID(data)
+	if err != nil {
+		return err
+	}
+	if null {
+		col.Nulls.set(row)
+		return nil
+	}
+	col.Ints[row] = int64(value)
+	return nil
+}
+
+func intElems[T int16 | uint16 | int32 | uint32 | int64 | uint64](size int, decode func([]byte) T) func(*decoder, []byte, uint64, *Column) error {
+	return func(_ *decoder, data []byte, count uint64, col *Column) error {
+		if err := checkElements(data, count, size); err != nil {
+			return err
+		}
+		for i := range int(count) {
+			col.Ints = append(col.Ints, int64(decode(data[i*size:])))
+		}
+		return nil
+	}
+}
+
+func floatElems[T float32 | float64](size int, decode func([]byte) T) func(*decoder, []byte, uint64, *Column) error {
+	return func(_ *decoder, data []byte, count uint64, col *Column) error {
+		if err := checkElements(data, count, size); err != nil {
+			return err
+		}
+		for i := range int(count) {
+			col.Floats = append(col.Floats, float64(decode(data[i*size:])))
+		}
+		return nil
+	}
+}
+
+func boolElems(_ *decoder, data []byte, count uint64, col *Column) error {
+	if err := checkElements(data, count, 1); err != nil {
+		return err
+	}
+	for _, b := range data[:count] {
+		if b != 0 {
+			col.Ints = append(col.Ints, 1)
+		} else {
+			col.Ints = append(col.Ints, 0)
+		}
+	}
+	return nil
+}
+
+func stringElems(d *decoder, data []byte, count uint64, col *Column) error {
+	const offsetSize = 4
+	if err := checkElements(data, count, offsetSize); err != nil {
+		return fmt.Errorf("string array: offsets exceed available data")
+	}
+	for i := range int(count) {
+		str, err := d.readString(uint64(binary.LittleEndian.Uint32(data[i*offsetSize:])))
+		if err != nil {
+			return fmt.Errorf("string array: reading string at index %d: %w", i, err)
+		}
+		col.Strings = append(col.Strings, str)
+	}
+	return nil
+}
+
+// refElems decodes reference array elements, null ones as a zero marked in
+// ElemNulls. Bounds are checked before any element is appended, so a failed
+// array leaves no null marks behind.
+func refElems(ft FieldType, stride int) func(*decoder, []byte, uint64, *Column) error {
+	return func(_ *decoder, data []byte, count uint64, col *Column) error {
+		if err := checkElements(data, count, refElementSize(ft, stride)); err != nil {
+			return err
+		}
+		for i := range int(count) {
+			value := binary.LittleEndian.Uint32(data[i*stride:])
+			if value == NullRowSentinel {
+				col.setElemNull(col.elemCount())
+				value = 0
+			}
+			col.Ints = append(col.Ints, int64(value))
+		}
+		return nil
+	}
+}
+
+// Batches serves batches that are already decoded, one per ReadBatch call and
+// each whole whatever max asks for, numbering their rows on from the
+// previous batch's. It reads like a RowReader wherever rows are taken in
+// batches.
+type Batches struct {
+	batches []*Batch
+	next    int
+	start   int
+}
+
+// NewBatches returns a source of batches, served in order.
+func NewBatches(batches ...*Batch) *Batches {
+	return &Batches{batches: batches}
+}
+
+// NewBatch returns an empty batch for ReadBatch to fill.
+func (s *Batches) NewBatch() *Batch {
+	return &Batch{}
+}
+
+// ReadBatch copies the next batch into b and returns its length, 0 once every
+// batch has been read.
+func (s *Batches) ReadBatch(b *Batch, max int) int {
+	if s.next >= len(s.batches) {
+		return 0
+	}
+	*b = *s.batches[s.next]
+	b.Start = s.start
+	s.next++
+	s.start += b.Len
+	return b.Len
+}
+
+// Rewind starts reading again from the first batch.
+func (s *Batches) Rewind() {
+	s.next, s.start = 0, 0
+}
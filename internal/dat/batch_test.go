@@ -0,0 +1,332 @@
+package dat
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+// datBuilder lays out a dat file: rows of fixed-size fields, then the
+// boundary marker and dynamic data holding strings and arrays.
+type datBuilder struct {
+	rows    int
+	fixed   []byte
+	dynamic []byte
+}
+
+func newDatBuilder() *datBuilder {
+	return &datBuilder{dynamic: append([]byte(nil), BoundaryMarker...)}
+}
+
+// add appends bytes to the dynamic data and returns their offset.
+func (b *datBuilder) add(data []byte) uint32 {
+	offset := uint32(len(b.dynamic))
+	b.dynamic = append(b.dynamic, data...)
+	return offset
+}
+
+func (b *datBuilder) str(s string) uint32 {
+	var data []byte
+	for _, ch := range utf16.Encode([]rune(s)) {
+		data = binary.LittleEndian.AppendUint16(data, ch)
+	}
+	return b.add(append(data, 0, 0, 0, 0))
+}
+
+func (b *datBuilder) field(size int, value uint64) {
+	var buf [16]byte
+	binary.LittleEndian.PutUint64(buf[:], value)
+	b.fixed = append(b.fixed, buf[:size]...)
+}
+
+// array appends an array field of count elements at offset.
+func (b *datBuilder) array(count int, offset uint32) {
+	b.field(8, uint64(count))
+	b.field(8, uint64(offset))
+}
+
+func (b *datBuilder) bytes() []byte {
+	data := binary.LittleEndian.AppendUint32(nil, uint32(b.rows))
+	return append(append(data, b.fixed...), b.dynamic...)
+}
+
+func le[T uint16 | uint32 | uint64](values ...T) []byte {
+	var data []byte
+	for _, v := range values {
+		data, _ = binary.Append(data, binary.LittleEndian, v)
+	}
+	return data
+}
+
+// TestReadBatchMatchesParse decodes one file with every field kind, as a
+// scalar, an interval and an array, both ways and compares them field by
+// field. Rows cover plain values, nulls and empty arrays, and a field that
+// cannot be read.
+func TestReadBatchMatchesParse(t *testing.T) {
+	name := func(s string) *string { return &s }
+	columns := []TableColumn{
+		{Name: name("Bool"), Type: TypeBool},
+		{Name: name("I16"), Type: TypeInt16},
+		{Name: name("U16"), Type: TypeUint16},
+		{Name: name("I32"), Type: TypeInt32},
+		{Name: name("U32"), Type: TypeUint32},
+		{Name: name("I64"), Type: TypeInt64},
+		{Name: name("U64"), Type: TypeUint64},
+		{Name: name("F32"), Type: TypeFloat32},
+		{Name: name("F64"), Type: TypeFloat64},
+		{Name: name("Row"), Type: TypeRow},
+		{Name: name("Foreign"), Type: TypeForeignRow},
+		{Name: name("Enum"), Type: TypeEnumRow},
+		{Name: name("LongID"), Type: TypeLongID},
+		{Name: name("Range"), Type: TypeInt32, Interval: true},
+		{Name: name("Bools"), Type: TypeBool, Array: true},
+		{Name: name("I16s"), Type: TypeInt16, Array: true},
+		{Name: name("U16s"), Type: TypeUint16, Array: true},
+		{Name: name("I32s"), Type: TypeInt32, Array: true},
+		{Name: name("U32s"), Type: TypeUint32, Array: true},
+		{Name: name("I64s"), Type: TypeInt64, Array: true},
+		{Name: name("U64s"), Type: TypeUint64, Array: true},
+		{Name: name("F32s"), Type: TypeFloat32, Array: true},
+		{Name: name("F64s"), Type: TypeFloat64, Array: true},
+		{Name: name("Strings"), Type: TypeString, Array: true},
+		{Name: name("Rows"), Type: TypeRow, Array: true},
+		{Name: name("Foreigns"), Type: TypeForeignRow, Array: true},
+		{Name: name("Enums"), Type: TypeEnumRow, Array: true},
+		{Name: name("LongIDs"), Type: TypeLongID, Array: true},
+		{Name: name("String"), Type: TypeString},
+		{Type: TypeInt32},
+	}
+	schema := &TableSchema{Name: "Everything", Columns: columns}
+
+	const null32 = uint64(NullRowSentinel)
+	b := newDatBuilder()
+	for row := range 3 {
+		b.rows++
+		v := uint64(row + 1)
+		b.field(1, v%2)
+		b.field(2, uint64(0x10000-v)) // negative as i16
+		b.field(2, 0xfff0+v)
+		b.field(4, uint64(0x100000000-v*1000))
+		b.field(4, 0xffffff00+v)
+		b.field(8, math.MaxUint64-v)
+		b.field(8, math.MaxUint64-v) // wraps as u64
+		b.field(4, uint64(math.Float32bits(float32(v)/3)))
+		b.field(8, math.Float64bits(-float64(v)*1e-9))
+		if row == 1 {
+			b.field(8, null32)
+			b.field(16, null32)
+			b.field(4, null32)
+			b.field(8, LongIDNullSentinel)
+			b.field(8, LongIDNullSentinel)
+		} else {
+			b.field(8, v)
+			b.field(16, v+1)
+			b.field(4, v+2)
+			b.field(8, v+3)
+			b.field(8, 0)
+		}
+		b.field(4, v)
+		b.field(4, v*10)
+
+		if row == 1 {
+			// Empty and null arrays.
+			for range 14 {
+				b.array(0, 0)
+			}
+		} else {
+			b.array(3, b.add([]byte{1, 0, 1}))
+			b.array(2, b.add(le[uint16](0xffff, 2)))
+			b.array(2, b.add(le[uint16](0xfffe, 3)))
+			b.array(2, b.add(le[uint32](0xffffffff, 4)))
+			b.array(2, b.add(le[uint32](0xfffffffe, 5)))
+			b.array(2, b.add(le[uint64](math.MaxUint64, 6)))
+			b.array(2, b.add(le[uint64](math.MaxUint64-1, 7)))
+			b.array(3, b.add(le(math.Float32bits(0.1), math.Float32bits(float32(math.NaN())), math.Float32bits(1e-7))))
+			b.array(2, b.add(le(math.Float64bits(1e21), math.Float64bits(-0.5))))
+			b.array(2, b.add(le(b.str("fire"), b.str("ä€𝄞"))))
+			b.array(3, b.add(le[uint64](1, null32, 3)))
+			b.array(2, b.add(le[uint64](4, 0, null32, 0)))
+			// Enum rows are read 4 bytes apart but take 16 bytes each.
+			b.array(2, b.add(le[uint32](5, uint32(null32), 0, 0, 0, 0, 0, 0)))
+			b.array(0, 0)
+		}
+
+		if row == 2 {
+			b.field(8, 1<<20) // Past the dynamic data: this field and the next are unreadable
+		} else {
+			b.field(8, uint64(b.str("row")))
+		}
+		b.field(4, v*7)
+	}
+
+	data := b.bytes()
+	parsed, err := Parse(context.Background(), data, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := NewRowReader(data, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := reader.NewBatch()
+	// Two rows per batch, so the second batch reuses the first's arrays.
+	rows := 0
+	for n := reader.ReadBatch(batch, 2); n > 0; n = reader.ReadBatch(batch, 2) {
+		for k := range n {
+			compareRow(t, schema, batch, k, parsed.Rows[batch.Start+k].Fields)
+		}
+		rows += n
+	}
+	if rows != 3 {
+		t.Errorf("ReadBatch read %d rows, want 3", rows)
+	}
+}
+
+// compareRow checks batch row k against the fields Parse decoded.
+func compareRow(t *testing.T, schema *TableSchema, batch *Batch, k int, fields map[string]any) {
+	t.Helper()
+	slot := 0
+	for i := range schema.Columns {
+		column := &schema.Columns[i]
+		n := 1
+		if column.Interval && !column.Array {
+			n = 2
+		}
+		for range n {
+			col := &batch.Columns[slot]
+			slot++
+			want, present := fields[col.Field]
+			if col.IsNull(k) {
+				if present && want != nil {
+					t.Errorf("row %d %s: batch null, Parse %#v", batch.Start+k, col.Field, want)
+				}
+				continue
+			}
+			got := parsedValue(col, column, k)
+			if !present || !reflect.DeepEqual(got, want) && !sameNaNs(got, want) {
+				t.Errorf("row %d %s: batch %#v, Parse %#v", batch.Start+k, col.Field, got, want)
+			}
+		}
+	}
+}
+
+// parsedValue converts batch row k of col to the value Parse returns for it.
+func parsedValue(col *Column, column *TableColumn, k int) any {
+	if !column.Array {
+		return scalarValue(col, column.Type, k, k)
+	}
+	start, end := col.Elems(k)
+	switch column.Type {
+	case TypeLongID:
+		return []any{}
+	case TypeRow, TypeForeignRow, TypeEnumRow:
+		refs := make([]*uint32, 0, end-start)
+		for j := start; j < end; j++ {
+			if col.ElemIsNull(j) {
+				refs = append(refs, nil)
+			} else {
+				v := uint32(col.Ints[j])
+				refs = append(refs, &v)
+			}
+		}
+		return refs
+	}
+	first := reflect.ValueOf(scalarValue(col, column.Type, 0, 0))
+	if end == start && col.elemCount() == 0 {
+		first = reflect.ValueOf(scalarValue(&Column{Ints: []int64{0}, Floats: []float64{0}, Strings: []string{""}}, column.Type, 0, 0))
+	}
+	slice := reflect.MakeSlice(reflect.SliceOf(first.Type()), 0, end-start)
+	for j := start; j < end; j++ {
+		slice = reflect.Append(slice, reflect.ValueOf(scalarValue(col, column.Type, j, k)))
+	}
+	return slice.Interface()
+}
+
+// scalarValue converts element j of col, in row k, to the Go type Parse
+// decodes ft to.
+func scalarValue(col *Column, ft FieldType, j, k int) any {
+	switch ft {
+	case TypeBool:
+		return col.Ints[j] != 0
+	case TypeInt16:
+		return int16(col.Ints[j])
+	case TypeUint16:
+		return uint16(col.Ints[j])
+	case TypeInt32:
+		return int32(col.Ints[j])
+	case TypeUint32:
+		return uint32(col.Ints[j])
+	case TypeInt64:
+		return col.Ints[j]
+	case TypeUint64:
+		return uint64(col.Ints[j])
+	case TypeFloat32:
+		return float32(col.Floats[j])
+	case TypeFloat64:
+		return col.Floats[j]
+	case TypeString:
+		return col.Strings[j]
+	case TypeRow, TypeForeignRow, TypeEnumRow:
+		v := uint32(col.Ints[j])
+		return &v
+	case TypeLongID:
+		v := uint64(col.Ints[j])
+		return &v
+	}
+	return nil
+}
+
+// sameNaNs reports whether two float slices are equal with NaN equal to NaN,
+// which DeepEqual never reports.
+func sameNaNs(a, b any) bool {
+	x, ok1 := a.([]float32)
+	y, ok2 := b.([]float32)
+	if !ok1 || !ok2 || len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if x[i] != y[i] && !(x[i] != x[i] && y[i] != y[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAppendJSON(t *testing.T) {
+	for _, tt := range []struct {
+		col  Column
+		want string
+	}{
+		{Column{Type: TypeBool, Elem: KindInt, Ints: []int64{1, 0}}, "[true,false]"},
+		{Column{Type: TypeUint64, Elem: KindInt, Ints: []int64{-1}}, "[18446744073709551615]"},
+		{Column{Type: TypeInt16, Elem: KindInt, Ints: []int64{-3}}, "[-3]"},
+		{Column{Type: TypeForeignRow, Elem: KindInt, Ints: []int64{4, 0}, ElemNulls: Bitmap{0b10}}, "[4,null]"},
+		{Column{Type: TypeFloat32, Elem: KindFloat, Floats: []float64{float64(float32(0.1)), 1e-7, math.NaN()}}, "[0.1,1e-7,null]"},
+		{Column{Type: TypeFloat64, Elem: KindFloat, Floats: []float64{1e21, math.Inf(-1), 2.5}}, "[1e+21,null,2.5]"},
+		{Column{Type: TypeString, Elem: KindString, Strings: []string{`a"b`, "<"}}, `["a\"b","\u003c"]`},
+	} {
+		tt.col.Kind = KindArray
+		tt.col.Offsets = []int{0, tt.col.elemCount()}
+		if got := string(tt.col.AppendJSON(nil, 0)); got != tt.want {
+			t.Errorf("AppendJSON of %s = %s, want %s", tt.col.Type, got, tt.want)
+		}
+	}
+}
+
+func TestBatches(t *testing.T) {
+	s := NewBatches(&Batch{Len: 2}, &Batch{Len: 3})
+	for pass := range 2 {
+		b := s.NewBatch()
+		var starts []int
+		for n := s.ReadBatch(b, 1); n > 0; n = s.ReadBatch(b, 1) {
+			starts = append(starts, b.Start)
+		}
+		if !reflect.DeepEqual(starts, []int{0, 2}) {
+			t.Errorf("pass %d batch starts = %v, want [0 2]", pass, starts)
+		}
+		s.Rewind()
+	}
+}
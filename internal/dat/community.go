@@ -1,5 +1,12 @@
 package dat
 
+import (
+	"log/slog"
+	"slices"
+
+	"github.com/jchantrell/exiledb/internal/poe"
+)
+
 const CommunitySchemaURL = "https://github.com/poe-tool-dev/dat-schema/releases/download/latest/schema.min.json"
 
 type TableColumn struct {
@@ -14,6 +21,15 @@ type TableColumn struct {
 	File        *string          `json:"file"`       // File extension for asset files
 	Files       []string         `json:"files"`      // Multiple file extensions
 	Interval    bool             `json:"interval"`   // Whether this is an interval field
+
+	// fullIndex is the column's position in the full table when ForPatch
+	// dropped columns before it, so FieldName keeps naming an unnamed column
+	// after that position. Zero otherwise.
+	fullIndex int
+
+	// absent marks a column MaskForPatch kept that the patch's files do not
+	// have: it takes no space in a row and always decodes as null.
+	absent bool
 }
 
 type ColumnReference struct {
@@ -36,6 +52,16 @@ type TableSchema struct {
 	Tags     []string      `json:"tags"`     // Metadata tags
 }
 
+// SchemaEnumeration is a named list of values that enumrow columns index
+// into. Indexing is the row index of the first enumerator, 0 or 1; null
+// enumerators are indices the schema has no name for.
+type SchemaEnumeration struct {
+	ValidFor    ValidFor  `json:"validFor"`
+	Name        string    `json:"name"`
+	Indexing    int       `json:"indexing"`
+	Enumerators []*string `json:"enumerators"`
+}
+
 type SchemaMetadata struct {
 	Version   int `json:"version"`   // Schema version number
 	CreatedAt int `json:"createdAt"` // Unix timestamp when schema was created
@@ -43,7 +69,8 @@ type SchemaMetadata struct {
 
 type CommunitySchema struct {
 	SchemaMetadata
-	Tables []TableSchema `json:"tables"` // Table definitions
+	Tables       []TableSchema       `json:"tables"`       // Table definitions
+	Enumerations []SchemaEnumeration `json:"enumerations"` // Targets of enumrow columns
 }
 
 func (cs *CommunitySchema) GetValidTables(gameVersion int) []TableSchema {
@@ -56,6 +83,82 @@ func (cs *CommunitySchema) GetValidTables(gameVersion int) []TableSchema {
 	return validTables
 }
 
+func (cs *CommunitySchema) GetValidEnumerations(gameVersion int) []SchemaEnumeration {
+	var valid []SchemaEnumeration
+	for _, enum := range cs.Enumerations {
+		if enum.ValidFor.IsValidForGame(gameVersion) {
+			valid = append(valid, enum)
+		}
+	}
+	return valid
+}
+
+// ForPatch returns the table as laid out in patch: columns the schema marks
+// as removed by then, whose Until is at or before patch, are left out.
+// Unnamed columns after a dropped one keep the Unknown<n> name of their
+// position in the full table, so a column is named the same in every patch
+// it exists in. An empty patch, or an Until that is not a version, keeps
+// the column.
+func (t *TableSchema) ForPatch(patch string) TableSchema {
+	resolved := *t
+	if patch == "" {
+		return resolved
+	}
+
+	resolved.Columns = make([]TableColumn, 0, len(t.Columns))
+	dropped := false
+	for i, column := range t.Columns {
+		if t.removedBy(patch, i) {
+			dropped = true
+			continue
+		}
+		if dropped {
+			column.fullIndex = i
+		}
+		resolved.Columns = append(resolved.Columns, column)
+	}
+	return resolved
+}
+
+// MaskForPatch returns the full table, decoding files as patch lays them
+// out: the columns ForPatch leaves out are kept, so batches have every
+// column of the full table, but they are read as absent from the file and
+// are always null. A table holding several patches is planned from the full
+// table and decodes each patch's files with its mask.
+func (t *TableSchema) MaskForPatch(patch string) TableSchema {
+	resolved := *t
+	resolved.Columns = slices.Clone(t.Columns)
+	for i := range resolved.Columns {
+		if patch != "" && t.removedBy(patch, i) {
+			resolved.Columns[i].absent = true
+		}
+	}
+	return resolved
+}
+
+// removedBy reports whether the schema marks column i as removed by patch.
+func (t *TableSchema) removedBy(patch string, i int) bool {
+	column := &t.Columns[i]
+	if column.Until == nil {
+		return false
+	}
+	cmp, err := poe.CompareVersions(patch, *column.Until)
+	if err != nil {
+		slog.Debug("Ignoring column until that is not a version", "table", t.Name, "column", FieldName(column, i), "until", *column.Until)
+		return false
+	}
+	return cmp >= 0
+}
+
+// TablesForPatch resolves each table with ForPatch.
+func TablesForPatch(tables []TableSchema, patch string) []TableSchema {
+	resolved := make([]TableSchema, len(tables))
+	for i := range tables {
+		resolved[i] = tables[i].ForPatch(patch)
+	}
+	return resolved
+}
+
 func (vf ValidFor) IsValidForGame(gameVersion int) bool {
 	if gameVersion >= 4 {
 		return (vf & ValidForPoE2) != 0
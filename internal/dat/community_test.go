@@ -0,0 +1,87 @@
+package dat
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTableForPatchDropsRemovedColumns(t *testing.T) {
+	name := func(s string) *string { return &s }
+	table := TableSchema{
+		Name: "Mods",
+		Columns: []TableColumn{
+			{Name: name("Id"), Type: TypeString},
+			{Name: name("Old"), Type: TypeInt32, Until: name("3.25")},
+			{Type: TypeInt32},
+			{Name: name("Level"), Type: TypeInt32},
+		},
+	}
+
+	for _, tt := range []struct {
+		patch string
+		want  []string
+		size  int
+	}{
+		{patch: "", want: []string{"Id", "Old", "Unknown2", "Level"}, size: 20},
+		{patch: "3.24.1.5", want: []string{"Id", "Old", "Unknown2", "Level"}, size: 20},
+		{patch: "3.25.0.0", want: []string{"Id", "Unknown2", "Level"}, size: 16},
+		{patch: "4.1.0.3", want: []string{"Id", "Unknown2", "Level"}, size: 16},
+	} {
+		resolved := table.ForPatch(tt.patch)
+		if got := FieldNames(&resolved); !slices.Equal(got, tt.want) {
+			t.Errorf("ForPatch(%q) fields = %v, want %v", tt.patch, got, tt.want)
+		}
+		if got := calculateRowSize(&resolved); got != tt.size {
+			t.Errorf("ForPatch(%q) row size = %d, want %d", tt.patch, got, tt.size)
+		}
+	}
+	if len(table.Columns) != 4 {
+		t.Error("ForPatch modified the full table")
+	}
+}
+
+func TestTableMaskForPatch(t *testing.T) {
+	name := func(s string) *string { return &s }
+	table := TableSchema{
+		Name: "Mods",
+		Columns: []TableColumn{
+			{Name: name("Old"), Type: TypeInt32, Until: name("3.25")},
+			{Name: name("Range"), Type: TypeInt32, Interval: true, Until: name("3.25")},
+			{Name: name("Level"), Type: TypeInt32},
+		},
+	}
+
+	masked := table.MaskForPatch("3.25.0.0")
+	if got, want := FieldNames(&masked), FieldNames(&table); !slices.Equal(got, want) {
+		t.Errorf("MaskForPatch fields = %v, want %v", got, want)
+	}
+	if got := calculateRowSize(&masked); got != 4 {
+		t.Errorf("MaskForPatch row size = %d, want 4", got)
+	}
+	if table.Columns[0].absent {
+		t.Error("MaskForPatch modified the full table")
+	}
+
+	b := newDatBuilder()
+	b.rows = 2
+	b.field(4, 10)
+	b.field(4, 20)
+	r, err := NewRowReader(b.bytes(), &masked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := r.NewBatch()
+	if n := r.ReadBatch(batch, 2); n != 2 {
+		t.Fatalf("ReadBatch = %d rows, want 2", n)
+	}
+	for k, level := range []int64{10, 20} {
+		for slot := range 3 {
+			if !batch.Columns[slot].IsNull(k) {
+				t.Errorf("row %d column %s is not null", k, batch.Columns[slot].Field)
+			}
+		}
+		if got := batch.Columns[3]; got.IsNull(k) || got.Ints[k] != level {
+			t.Errorf("row %d Level = %v, want %d", k, got.Ints[k], level)
+		}
+	}
+}
@@ -11,7 +11,49 @@ import (
 	"unicode/utf16"
 )
 
+// Parse decodes every row of a DAT file up front. Prefer NewRowReader when
+// rows are consumed once, in order: it holds one row at a time instead of
+// the whole table.
 func Parse(ctx context.Context, data []byte, schema *TableSchema) (*ParsedTable, error) {
+	reader, err := NewRowReader(data, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]ParsedRow, 0, reader.Len())
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		row, ok := reader.Next()
+		if !ok {
+			break
+		}
+		rows = append(rows, row)
+	}
+
+	return &ParsedTable{
+		Schema: schema,
+		Rows:   rows,
+	}, nil
+}
+
+// RowReader decodes a DAT file's rows one at a time, in index order. The
+// file's structure is validated up front by NewRowReader; decoding a row
+// never fails, fields that cannot be read are left out of its Fields.
+type RowReader struct {
+	schema  *TableSchema
+	decoder *decoder
+	fixed   []byte
+	rowSize int
+	count   int
+	next    int
+}
+
+func NewRowReader(data []byte, schema *TableSchema) (*RowReader, error) {
 	if schema == nil {
 		return nil, fmt.Errorf("schema cannot be nil")
 	}
@@ -51,27 +93,33 @@ func Parse(ctx context.Context, data []byte, schema *TableSchema) (*ParsedTable,
 			expectedFixedSize, datFile.RowCount, rowSize, len(datFile.FixedData))
 	}
 
-	d := &decoder{
-		dynamic: datFile.DynamicData,
-	}
+	return &RowReader{
+		schema:  schema,
+		decoder: &decoder{dynamic: datFile.DynamicData},
+		fixed:   datFile.FixedData,
+		rowSize: rowSize,
+		count:   datFile.RowCount,
+	}, nil
+}
 
-	rows := make([]ParsedRow, datFile.RowCount)
+// Len returns the total number of rows in the file.
+func (r *RowReader) Len() int {
+	return r.count
+}
 
-	for i := 0; i < datFile.RowCount; i++ {
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		default:
-		}
+// Rewind moves the reader back to the first row.
+func (r *RowReader) Rewind() {
+	r.next = 0
+}
 
-		rowData := datFile.FixedData[i*rowSize : (i+1)*rowSize]
-		rows[i] = d.parseRow(i, rowData, schema)
+// Next decodes the next row. It returns false once every row has been read.
+func (r *RowReader) Next() (ParsedRow, bool) {
+	if r.next >= r.count {
+		return ParsedRow{}, false
 	}
-
-	return &ParsedTable{
-		Schema: schema,
-		Rows:   rows,
-	}, nil
+	i := r.next
+	r.next++
+	return r.decoder.parseRow(i, r.fixed[i*r.rowSize:(i+1)*r.rowSize], r.schema), true
 }
 
 func parseDATStructure(data []byte) (*DatFile, error) {
@@ -98,6 +146,9 @@ func parseDATStructure(data []byte) (*DatFile, error) {
 // fieldSize is the single owner of per-column fixed-data width; row size and
 // field offsets must agree byte-for-byte, so both derive from it.
 func fieldSize(column *TableColumn) int {
+	if column.absent {
+		return 0
+	}
 	if column.Array {
 		return TypeArray.Size()
 	}
@@ -147,6 +198,9 @@ func (d *decoder) parseRow(index int, rowData []byte, schema *TableSchema) Parse
 	offset := 0
 
 	for i, column := range schema.Columns {
+		if column.absent {
+			continue
+		}
 		name := FieldName(&column, i)
 		size := fieldSize(&column)
 
@@ -196,6 +250,9 @@ func (d *decoder) parseRow(index int, rowData []byte, schema *TableSchema) Parse
 
 func FieldName(column *TableColumn, index int) string {
 	if column.Name == nil {
+		if column.fullIndex > 0 {
+			index = column.fullIndex
+		}
 		return "Unknown" + strconv.Itoa(index)
 	}
 	return *column.Name
@@ -226,9 +283,28 @@ func (d *decoder) readScalarField(data []byte, column *TableColumn) (interface{}
 }
 
 func (d *decoder) readArrayField(data []byte, column *TableColumn) (interface{}, error) {
+	elements, count, err := d.arrayElements(data, column)
+	if err != nil {
+		return nil, err
+	}
+
+	c := fieldTypes[column.Type].codec
+	if c.slice == nil {
+		if count > 0 {
+			return nil, fmt.Errorf("array: unsupported element type %s", column.Type)
+		}
+		return []interface{}{}, nil
+	}
+	return c.slice(d, elements, count)
+}
+
+// arrayElements reads an array field's header and returns the dynamic data
+// its elements start at and their count. Empty and null arrays have a zero
+// count.
+func (d *decoder) arrayElements(data []byte, column *TableColumn) ([]byte, uint64, error) {
 	headerSize := TypeArray.Size()
 	if len(data) < headerSize {
-		return nil, fmt.Errorf("array field: insufficient data (need %d bytes)", headerSize)
+		return nil, 0, fmt.Errorf("array field: insufficient data (need %d bytes)", headerSize)
 	}
 
 	count := uint64(binary.LittleEndian.Uint32(data[0:4]))
@@ -239,37 +315,23 @@ func (d *decoder) readArrayField(data []byte, column *TableColumn) (interface{},
 		name = *column.Name
 	}
 	if count > uint64(DefaultMaxArrayCount) {
-		return nil, fmt.Errorf("field %s: array count %d exceeds maximum %d", name, count, DefaultMaxArrayCount)
+		return nil, 0, fmt.Errorf("field %s: array count %d exceeds maximum %d", name, count, DefaultMaxArrayCount)
 	}
 	if count > uint64(DefaultArraySizeWarningThreshold) {
 		slog.Debug("Large array detected", "field", name, "count", count)
 	}
 
-	return d.readArray(offset, count, column.Type)
-}
-
-func (d *decoder) readArray(offset, count uint64, elementType FieldType) (interface{}, error) {
-	c := fieldTypes[elementType].codec
-
 	if offset == 0 || count == 0 ||
 		offset == uint64(NullRowSentinel) || offset == LongIDNullSentinel {
-		if c.slice == nil {
-			return []interface{}{}, nil
-		}
-		return c.slice(d, nil, 0)
+		return nil, 0, nil
 	}
-
 	if offset < MinOffsetForArraysAndStrings {
-		return nil, fmt.Errorf("array: offset %d too small (minimum %d)", offset, MinOffsetForArraysAndStrings)
+		return nil, 0, fmt.Errorf("array: offset %d too small (minimum %d)", offset, MinOffsetForArraysAndStrings)
 	}
 	if offset >= uint64(len(d.dynamic)) {
-		return nil, fmt.Errorf("array: offset %d exceeds dynamic data size %d", offset, len(d.dynamic))
-	}
-	if c.slice == nil {
-		return nil, fmt.Errorf("array: unsupported element type %s", elementType)
+		return nil, 0, fmt.Errorf("array: offset %d exceeds dynamic data size %d", offset, len(d.dynamic))
 	}
-
-	return c.slice(d, d.dynamic[offset:], count)
+	return d.dynamic[offset:], count, nil
 }
 
 func (d *decoder) readString(offset uint64) (string, error) {
@@ -323,12 +385,16 @@ func (d *decoder) readStringSlice(data []byte, count uint64) ([]string, error) {
 }
 
 // codec is the single owner of how a FieldType is decoded: its scalar form,
-// its array-element form, and the element size used for both decoding and
-// bounds checking. Types with a nil slice func (longid) decode to an untyped
-// empty slice when empty and error otherwise.
+// its array-element form, its typed column and array-element forms for
+// batches, and the element size used for both decoding and bounds checking.
+// Types with nil slice and elems funcs (longid) decode to an empty array
+// when empty and error otherwise.
 type codec struct {
 	scalar func(d *decoder, data []byte) (interface{}, error)
 	slice  func(d *decoder, data []byte, count uint64) (interface{}, error)
+	kind   ColumnKind
+	column func(d *decoder, data []byte, col *Column, row int) error
+	elems  func(d *decoder, data []byte, count uint64, col *Column) error
 }
 
 // fieldTypes is the single source of truth for every FieldType: its
@@ -339,27 +405,26 @@ var fieldTypes = map[FieldType]struct {
 	size  int
 	codec codec
 }{
-	TypeBool:       {1, fixedCodec(1, func(b []byte) bool { return b[0] != 0 })},
-	TypeInt16:      {2, fixedCodec(2, func(b []byte) int16 { return int16(binary.LittleEndian.Uint16(b)) })},
-	TypeUint16:     {2, fixedCodec(2, binary.LittleEndian.Uint16)},
-	TypeInt32:      {4, fixedCodec(4, func(b []byte) int32 { return int32(binary.LittleEndian.Uint32(b)) })},
-	TypeUint32:     {4, fixedCodec(4, binary.LittleEndian.Uint32)},
-	TypeInt64:      {8, fixedCodec(8, func(b []byte) int64 { return int64(binary.LittleEndian.Uint64(b)) })},
-	TypeUint64:     {8, fixedCodec(8, binary.LittleEndian.Uint64)},
-	TypeFloat32:    {4, fixedCodec(4, func(b []byte) float32 { return math.Float32frombits(binary.LittleEndian.Uint32(b)) })},
-	TypeFloat64:    {8, fixedCodec(8, func(b []byte) float64 { return math.Float64frombits(binary.LittleEndian.Uint64(b)) })},
+	TypeBool:       {1, boolCodec},
+	TypeInt16:      {2, intCodec(2, func(b []byte) int16 { return int16(binary.LittleEndian.Uint16(b)) })},
+	TypeUint16:     {2, intCodec(2, binary.LittleEndian.Uint16)},
+	TypeInt32:      {4, intCodec(4, func(b []byte) int32 { return int32(binary.LittleEndian.Uint32(b)) })},
+	TypeUint32:     {4, intCodec(4, binary.LittleEndian.Uint32)},
+	TypeInt64:      {8, intCodec(8, func(b []byte) int64 { return int64(binary.LittleEndian.Uint64(b)) })},
+	TypeUint64:     {8, intCodec(8, binary.LittleEndian.Uint64)},
+	TypeFloat32:    {4, floatCodec(4, func(b []byte) float32 { return math.Float32frombits(binary.LittleEndian.Uint32(b)) })},
+	TypeFloat64:    {8, floatCodec(8, func(b []byte) float64 { return math.Float64frombits(binary.LittleEndian.Uint64(b)) })},
 	TypeString:     {8, stringCodec},
 	TypeRow:        {8, refCodec(TypeRow, 8)},
 	TypeForeignRow: {16, refCodec(TypeForeignRow, 16)},
 	TypeEnumRow:    {4, refCodec(TypeEnumRow, 4)},
-	TypeLongID:     {16, codec{scalar: decodeLongID}},
+	TypeLongID:     {16, codec{scalar: decodeLongID, kind: KindInt, column: longIDColumn}},
 	TypeArray:      {16, codec{}},
 }
 
 func readSlice[T any](data []byte, count uint64, size int, decode func([]byte) T) ([]T, error) {
-	totalSize := int(count) * size
-	if totalSize > len(data) {
-		return nil, fmt.Errorf("array: data exceeds available data (need %d bytes, have %d)", totalSize, len(data))
+	if err := checkElements(data, count, size); err != nil {
+		return nil, err
 	}
 
 	result := make([]T, count)
@@ -369,6 +434,16 @@ func readSlice[T any](data []byte, count uint64, size int, decode func([]byte) T
 	return result, nil
 }
 
+// checkElements reports an error unless data holds count elements of size
+// bytes.
+func checkElements(data []byte, count uint64, size int) error {
+	totalSize := int(count) * size
+	if totalSize > len(data) {
+		return fmt.Errorf("array: data exceeds available data (need %d bytes, have %d)", totalSize, len(data))
+	}
+	return nil
+}
+
 func anySlice[T any](s []T, err error) (interface{}, error) {
 	if err != nil {
 		return nil, err
@@ -387,7 +462,27 @@ func fixedCodec[T any](size int, decode func([]byte) T) codec {
 	}
 }
 
+var boolCodec = withColumn(fixedCodec(1, func(b []byte) bool { return b[0] != 0 }), KindInt, boolColumn, boolElems)
+
+func intCodec[T int16 | uint16 | int32 | uint32 | int64 | uint64](size int, decode func([]byte) T) codec {
+	return withColumn(fixedCodec(size, decode), KindInt, intColumn(decode), intElems(size, decode))
+}
+
+func floatCodec[T float32 | float64](size int, decode func([]byte) T) codec {
+	return withColumn(fixedCodec(size, decode), KindFloat, floatColumn(decode), floatElems(size, decode))
+}
+
+func withColumn(c codec, kind ColumnKind, column func(*decoder, []byte, *Column, int) error, elems func(*decoder, []byte, uint64, *Column) error) codec {
+	c.kind = kind
+	c.column = column
+	c.elems = elems
+	return c
+}
+
 var stringCodec = codec{
+	kind:   KindString,
+	column: stringColumn,
+	elems:  stringElems,
 	scalar: func(d *decoder, data []byte) (interface{}, error) {
 		return d.readString(uint64(binary.LittleEndian.Uint32(data)))
 	},
@@ -398,6 +493,9 @@ var stringCodec = codec{
 
 func refCodec(ft FieldType, stride int) codec {
 	return codec{
+		kind:   KindInt,
+		column: refColumn,
+		elems:  refElems(ft, stride),
 		scalar: func(_ *decoder, data []byte) (interface{}, error) {
 			value := binary.LittleEndian.Uint32(data)
 			if value == NullRowSentinel {
@@ -406,21 +504,24 @@ func refCodec(ft FieldType, stride int) codec {
 			return &value, nil
 		},
 		slice: func(_ *decoder, data []byte, count uint64) (interface{}, error) {
-			elementSize := stride
-			if ft == TypeForeignRow || ft == TypeEnumRow {
-				elementSize = ElementSize64BitForeignRow
-			}
-
-			totalSize := int(count) * elementSize
-			if totalSize > len(data) {
-				return nil, fmt.Errorf("array: data exceeds available data (need %d bytes, have %d)", totalSize, len(data))
+			elementSize := refElementSize(ft, stride)
+			if err := checkElements(data, count, elementSize); err != nil {
+				return nil, err
 			}
-
-			return anySlice(readSlice(data[:totalSize], count, stride, decodeRowRef))
+			return anySlice(readSlice(data[:int(count)*elementSize], count, stride, decodeRowRef))
 		},
 	}
 }
 
+// refElementSize is the space each element of a reference array takes,
+// which for foreign and enum rows is wider than the stride they are read at.
+func refElementSize(ft FieldType, stride int) int {
+	if ft == TypeForeignRow || ft == TypeEnumRow {
+		return ElementSize64BitForeignRow
+	}
+	return stride
+}
+
 func decodeRowRef(data []byte) *uint32 {
 	value := binary.LittleEndian.Uint32(data)
 	if value == NullRowSentinel {
@@ -430,14 +531,22 @@ func decodeRowRef(data []byte) *uint32 {
 }
 
 func decodeLongID(_ *decoder, data []byte) (interface{}, error) {
-	value := binary.LittleEndian.Uint64(data[0:8])
+	value, null, err := readLongID(data)
+	if err != nil || null {
+		return nil, err
+	}
+	return &value, nil
+}
+
+func readLongID(data []byte) (value uint64, null bool, err error) {
+	value = binary.LittleEndian.Uint64(data[0:8])
 
 	high := binary.LittleEndian.Uint64(data[8:16])
 	if value == LongIDNullSentinel && high == LongIDNullSentinel {
-		return nil, nil
+		return 0, true, nil
 	}
 	if high != 0 {
-		return nil, fmt.Errorf("unexpected value in high half of LongID: %016x %016x", value, high)
+		return 0, false, fmt.Errorf("unexpected value in high half of LongID: %016x %016x", value, high)
 	}
-	return &value, nil
+	return value, false, nil
 }
@@ -16,7 +16,7 @@ const (
 
 	TypeRow        FieldType = "row"        // row index (references column in same table)
 	TypeForeignRow FieldType = "foreignrow" // row index (references column in foreign table)
-	TypeEnumRow    FieldType = "enumrow"    // row index (references foreign table with no columns)
+	TypeEnumRow    FieldType = "enumrow"    // row index (references a schema enumeration)
 	TypeLongID     FieldType = "longid"     // 64-bit row reference (foreign table)
 
 	TypeArray FieldType = "array" // column is an array of unknown type
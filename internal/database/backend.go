@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"strings"
+)
+
+// Backend is the SQL engine a Database loads into. Planning, the catalog and
+// incremental extraction are shared; a backend supplies what differs between
+// engines: connecting, column types and constraints, placeholders, bulk
+// loading, and the foreign-key check that follows a load.
+type Backend interface {
+	// Name identifies the backend in logs and errors.
+	Name() string
+
+	// Open connects to target, a file path or URL, and prepares the
+	// session for loading.
+	Open(target string, options *DatabaseOptions) (*sql.DB, error)
+
+	// Rebind rewrites a query's ? placeholders into the driver's syntax.
+	Rebind(query string) string
+
+	// ColumnType maps a planned column type (INTEGER, REAL or TEXT) to the
+	// engine's type.
+	ColumnType(sqlType string) string
+
+	// DeclaresForeignKeys reports whether tables get FOREIGN KEY clauses.
+	// Loads never enforce them, so an engine that cannot switch
+	// enforcement off leaves them out.
+	DeclaresForeignKeys() bool
+
+	// JSONArray returns a query aggregating value over the rows of from, a
+	// FROM clause with its WHERE, into a JSON array ordered by order. No
+	// rows aggregate to an empty array.
+	JSONArray(value, from, order string) string
+
+	// DropTable returns the statement dropping table, and any view over it
+	// the engine would otherwise refuse to leave dangling.
+	DropTable(table string) string
+
+	// TableNames lists every table in the connected database or schema.
+	TableNames(ctx context.Context, db *sql.DB) ([]string, error)
+
+	// BulkInsert starts loading rows of the named columns into table
+	// within tx. Rows may not be written until Close.
+	BulkInsert(ctx context.Context, tx *sql.Tx, table string, columns []string) (BulkWriter, error)
+
+	// ConcurrentBulkInserts reports whether several loaders may be open on
+	// one transaction at once. Otherwise only one is open at a time.
+	ConcurrentBulkInserts() bool
+
+	// CheckForeignKeys returns the rows of the plans' main and junction
+	// tables whose references have no target row. References into tables
+	// missing from existing are not checked.
+	CheckForeignKeys(ctx context.Context, db *sql.DB, plans []*TablePlan, existing map[string]bool) ([]ForeignKeyViolation, error)
+}
+
+// BulkWriter loads rows into one table.
+type BulkWriter interface {
+	// Write queues one row, its values in column order.
+	Write(ctx context.Context, values []any) error
+
+	// Close finishes the load. It is safe to call again after it returns.
+	Close(ctx context.Context) error
+}
+
+// backendFor picks the backend for a --database value: postgres:// and
+// postgresql:// URLs load into PostgreSQL, anything else is a SQLite file.
+func backendFor(target string) Backend {
+	if isPostgresURL(target) {
+		return postgresBackend{}
+	}
+	return sqliteBackend{}
+}
+
+func isPostgresURL(target string) bool {
+	return strings.HasPrefix(target, "postgres://") || strings.HasPrefix(target, "postgresql://")
+}
+
+// Redacted returns target with any password in a database URL masked, for
+// logs and error messages.
+func Redacted(target string) string {
+	if !isPostgresURL(target) {
+		return target
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return "postgres://…"
+	}
+	return u.Redacted()
+}
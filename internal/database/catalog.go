@@ -0,0 +1,467 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/jchantrell/exiledb/internal/dat"
+)
+
+// catalogDDL creates the tables recording what each extraction wrote, so
+// later runs can extend the database in place and readers can tell where a
+// database came from. Their names start with an underscore, which keeps them
+// out of UserTables and apart from game data.
+//
+// _tables and _columns describe each table as the schema defined it,
+// _table_languages each (patch, language) inserted and the dat file it came
+// from, and _meta the most recent extract.
+var catalogDDL = []string{
+	`CREATE TABLE IF NOT EXISTS _tables (
+    name TEXT PRIMARY KEY,
+    schema_name TEXT NOT NULL,
+    signature TEXT NOT NULL,
+    multi_patch INTEGER NOT NULL,
+    tags TEXT
+)`,
+	`CREATE TABLE IF NOT EXISTS _table_languages (
+    table_name TEXT NOT NULL,
+    patch TEXT NOT NULL,
+    language TEXT NOT NULL,
+    path TEXT,
+    sha256 TEXT,
+    PRIMARY KEY (table_name, patch, language)
+)`,
+	`CREATE TABLE IF NOT EXISTS _columns (
+    table_name TEXT NOT NULL,
+    name TEXT NOT NULL,
+    position INTEGER NOT NULL,
+    field TEXT NOT NULL,
+    type TEXT NOT NULL,
+    is_array INTEGER NOT NULL,
+    is_interval INTEGER NOT NULL,
+    is_localized INTEGER NOT NULL,
+    is_unique INTEGER NOT NULL,
+    description TEXT,
+    ref_table TEXT,
+    ref_column TEXT,
+    junction_table TEXT,
+    file TEXT,
+    files TEXT,
+    until TEXT,
+    PRIMARY KEY (table_name, name)
+)`,
+	`CREATE TABLE IF NOT EXISTS _meta (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+)`,
+}
+
+// TableRecord is the catalog entry for one extracted table. Signature is the
+// hash of the DDL the table was created with: a table whose current plan
+// hashes differently has a different layout and cannot be extended in place.
+// Languages maps each patch present in the table to its inserted languages.
+type TableRecord struct {
+	Name       string
+	SchemaName string
+	Signature  string
+	MultiPatch bool
+	Languages  map[string]map[string]bool
+}
+
+// Has reports whether the (patch, language) pair has been inserted.
+func (r *TableRecord) Has(patch, language string) bool {
+	return r.Languages[patch][language]
+}
+
+// SQLName returns the table's name in the database.
+func (p *TablePlan) SQLName() string {
+	return p.sqlName
+}
+
+// MultiPatch reports whether the plan scopes rows by _patch.
+func (p *TablePlan) MultiPatch() bool {
+	return p.patched
+}
+
+// Enumerations returns the lookup tables the plan's enumrow columns
+// reference, which WriteEnumerations fills.
+func (p *TablePlan) Enumerations() []string {
+	var names []string
+	for _, col := range p.columns {
+		if col.refEnum && !slices.Contains(names, col.refTable) {
+			names = append(names, col.refTable)
+		}
+	}
+	for _, junction := range p.junctions {
+		if junction.refEnum && !slices.Contains(names, junction.refTable) {
+			names = append(names, junction.refTable)
+		}
+	}
+	return names
+}
+
+// SchemaName returns the community schema name the plan was built from.
+func (p *TablePlan) SchemaName() string {
+	return p.schemaName
+}
+
+// Signature identifies the plan's layout: the main table plus its junction
+// tables. Two plans with equal signatures produce identical DDL. It hashes
+// the SQLite DDL whatever the backend, so signatures are comparable across
+// databases.
+func (p *TablePlan) Signature() string {
+	var ddl []string
+	for _, req := range generateAllDDL([]*TablePlan{p}, sqliteBackend{}) {
+		ddl = append(ddl, req.DDL)
+	}
+	return signature(ddl...)
+}
+
+// Enumeration reports whether the record is a lookup table WriteEnumerations
+// created, rather than a data table.
+func (r *TableRecord) Enumeration() bool {
+	return r.Signature == enumSignature(r.Name, r.MultiPatch)
+}
+
+func signature(ddl ...string) string {
+	h := sha256.New()
+	for _, d := range ddl {
+		h.Write([]byte(d))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// LoadCatalog creates the catalog tables if needed and returns every
+// recorded table keyed by SQL name.
+func LoadCatalog(ctx context.Context, db *Database) (map[string]*TableRecord, error) {
+	if db.db == nil {
+		return nil, fmt.Errorf("database connection is closed")
+	}
+
+	for _, ddl := range catalogDDL {
+		if _, err := db.db.ExecContext(ctx, ddl); err != nil {
+			return nil, fmt.Errorf("creating catalog: %w", err)
+		}
+	}
+
+	rows, err := db.db.QueryContext(ctx, "SELECT name, schema_name, signature, multi_patch FROM _tables")
+	if err != nil {
+		return nil, fmt.Errorf("reading table catalog: %w", err)
+	}
+	records := make(map[string]*TableRecord)
+	for rows.Next() {
+		r := &TableRecord{Languages: make(map[string]map[string]bool)}
+		if err := rows.Scan(&r.Name, &r.SchemaName, &r.Signature, &r.MultiPatch); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scanning table catalog: %w", err)
+		}
+		records[r.Name] = r
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	langs, err := db.db.QueryContext(ctx, "SELECT table_name, patch, language FROM _table_languages")
+	if err != nil {
+		return nil, fmt.Errorf("reading language catalog: %w", err)
+	}
+	defer langs.Close()
+	for langs.Next() {
+		var table, patch, language string
+		if err := langs.Scan(&table, &patch, &language); err != nil {
+			return nil, fmt.Errorf("scanning language catalog: %w", err)
+		}
+		r, ok := records[table]
+		if !ok {
+			continue
+		}
+		if r.Languages[patch] == nil {
+			r.Languages[patch] = make(map[string]bool)
+		}
+		r.Languages[patch][language] = true
+	}
+	return records, langs.Err()
+}
+
+// DropTables removes each plan's main and junction tables, its view, and
+// their catalog entries, in one transaction.
+func DropTables(ctx context.Context, db *Database, plans []*TablePlan) error {
+	if len(plans) == 0 {
+		return nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning drop transaction: %w", err)
+	}
+	defer tx.Rollback() // Safe to call even after commit
+
+	for _, plan := range plans {
+		if _, err := tx.ExecContext(ctx, "DROP VIEW IF EXISTS "+quoteSQLIdentifier(ViewName(plan.sqlName))); err != nil {
+			return fmt.Errorf("dropping %s: %w", ViewName(plan.sqlName), err)
+		}
+		// The table may have been created with junction tables the plan no
+		// longer has; the catalog records those.
+		junctions, err := recordedJunctions(ctx, db, tx, plan.sqlName)
+		if err != nil {
+			return err
+		}
+		for _, junction := range plan.junctions {
+			if !slices.Contains(junctions, junction.tableName) {
+				junctions = append(junctions, junction.tableName)
+			}
+		}
+		for _, junction := range junctions {
+			if _, err := tx.ExecContext(ctx, db.backend.DropTable(junction)); err != nil {
+				return fmt.Errorf("dropping %s: %w", junction, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, db.backend.DropTable(plan.sqlName)); err != nil {
+			return fmt.Errorf("dropping %s: %w", plan.sqlName, err)
+		}
+		if err := forgetTable(ctx, db, tx, plan.sqlName); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing drop transaction: %w", err)
+	}
+	return nil
+}
+
+// recordedJunctions returns the junction tables the catalog records for
+// table.
+func recordedJunctions(ctx context.Context, db *Database, tx *sql.Tx, table string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, db.rebind("SELECT junction_table FROM _columns WHERE table_name = ? AND junction_table IS NOT NULL"), table)
+	if err != nil {
+		return nil, fmt.Errorf("reading junction tables of %s: %w", table, err)
+	}
+	defer rows.Close()
+	var junctions []string
+	for rows.Next() {
+		var junction string
+		if err := rows.Scan(&junction); err != nil {
+			return nil, fmt.Errorf("scanning junction tables of %s: %w", table, err)
+		}
+		junctions = append(junctions, junction)
+	}
+	return junctions, rows.Err()
+}
+
+// DeleteLanguages removes the rows one patch's languages contributed to a
+// table and its junction tables, and forgets them in the catalog, leaving
+// every other (patch, language) unit in place. Single-patch tables hold only
+// one patch, so there the patch only scopes the catalog entries.
+func DeleteLanguages(ctx context.Context, db *Database, plan *TablePlan, patch string, languages []string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning delete transaction: %w", err)
+	}
+	defer tx.Rollback() // Safe to call even after commit
+
+	for _, language := range languages {
+		for _, table := range plan.tableNames() {
+			query := fmt.Sprintf("DELETE FROM %s WHERE %s = ?", quoteSQLIdentifier(table), colLanguage)
+			args := []any{language}
+			if plan.patched {
+				query += fmt.Sprintf(" AND %s = ?", colPatch)
+				args = append(args, patch)
+			}
+			if _, err := tx.ExecContext(ctx, db.rebind(query), args...); err != nil {
+				return fmt.Errorf("deleting %s rows from %s: %w", language, table, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, db.rebind("DELETE FROM _table_languages WHERE table_name = ? AND patch = ? AND language = ?"), plan.sqlName, patch, language); err != nil {
+			return fmt.Errorf("removing catalog language for %s: %w", plan.sqlName, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing delete transaction: %w", err)
+	}
+	return nil
+}
+
+func recordTable(ctx context.Context, db *Database, tx *sql.Tx, plan *TablePlan) error {
+	if err := forgetTable(ctx, db, tx, plan.sqlName); err != nil {
+		return err
+	}
+	tags, err := json.Marshal(plan.tags)
+	if err != nil {
+		return fmt.Errorf("encoding tags of %s: %w", plan.sqlName, err)
+	}
+	_, err = tx.ExecContext(ctx, db.rebind("INSERT INTO _tables (name, schema_name, signature, multi_patch, tags) VALUES (?, ?, ?, ?, ?)"),
+		plan.sqlName, plan.schemaName, plan.Signature(), boolInt(plan.patched), string(tags))
+	if err != nil {
+		return fmt.Errorf("recording table %s: %w", plan.sqlName, err)
+	}
+
+	insert := db.rebind(`INSERT INTO _columns (table_name, name, position, field, type, is_array, is_interval, is_localized, is_unique,
+    description, ref_table, ref_column, junction_table, file, files, until) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	record := func(name, field string, position int, column *dat.TableColumn, refTable, refColumn, junction string) error {
+		var files any
+		if len(column.Files) > 0 {
+			b, err := json.Marshal(column.Files)
+			if err != nil {
+				return err
+			}
+			files = string(b)
+		}
+		_, err := tx.ExecContext(ctx, insert,
+			plan.sqlName, name, position, field, string(column.Type),
+			boolInt(column.Array), boolInt(column.Interval), boolInt(column.Localized), boolInt(column.Unique),
+			column.Description, nullString(refTable), nullString(refColumn), nullString(junction),
+			column.File, files, column.Until)
+		return err
+	}
+	for _, col := range plan.columns {
+		if err := record(col.sqlName, col.field, col.position, col.column, col.refTable, col.refColumn, ""); err != nil {
+			return fmt.Errorf("recording column %s.%s: %w", plan.sqlName, col.sqlName, err)
+		}
+	}
+	for _, junction := range plan.junctions {
+		if err := record(junction.sqlName, junction.field, junction.position, junction.column, junction.refTable, junction.refColumn, junction.tableName); err != nil {
+			return fmt.Errorf("recording column %s.%s: %w", plan.sqlName, junction.sqlName, err)
+		}
+	}
+	return nil
+}
+
+// recordEnumeration records a lookup table in _tables, with no columns or
+// languages of its own.
+func recordEnumeration(ctx context.Context, db *Database, tx *sql.Tx, name, enumName string, patched bool) error {
+	if err := forgetTable(ctx, db, tx, name); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, db.rebind("INSERT INTO _tables (name, schema_name, signature, multi_patch) VALUES (?, ?, ?, ?)"),
+		name, enumName, enumSignature(name, patched), boolInt(patched))
+	if err != nil {
+		return fmt.Errorf("recording enumeration table %s: %w", name, err)
+	}
+	return nil
+}
+
+func forgetTable(ctx context.Context, db *Database, tx *sql.Tx, table string) error {
+	if _, err := tx.ExecContext(ctx, db.rebind("DELETE FROM _tables WHERE name = ?"), table); err != nil {
+		return fmt.Errorf("removing catalog entry for %s: %w", table, err)
+	}
+	if _, err := tx.ExecContext(ctx, db.rebind("DELETE FROM _table_languages WHERE table_name = ?"), table); err != nil {
+		return fmt.Errorf("removing catalog languages for %s: %w", table, err)
+	}
+	if _, err := tx.ExecContext(ctx, db.rebind("DELETE FROM _columns WHERE table_name = ?"), table); err != nil {
+		return fmt.Errorf("removing catalog columns for %s: %w", table, err)
+	}
+	return nil
+}
+
+// recordLanguage marks a (table, patch, language) unit as inserted, with the
+// dat file it came from. It runs inside the insert transaction, so the
+// catalog never claims rows that were rolled back.
+func recordLanguage(ctx context.Context, db *Database, tx *sql.Tx, table string, data *TableData) error {
+	_, err := tx.ExecContext(ctx, db.rebind(`INSERT INTO _table_languages (table_name, patch, language, path, sha256) VALUES (?, ?, ?, ?, ?)
+    ON CONFLICT (table_name, patch, language) DO UPDATE SET path = excluded.path, sha256 = excluded.sha256`),
+		table, data.Patch, data.Language, nullString(data.Path), nullString(data.SHA256))
+	if err != nil {
+		return fmt.Errorf("recording language %s for %s: %w", data.Language, table, err)
+	}
+	return nil
+}
+
+// WriteMeta replaces the given _meta entries, leaving others in place.
+func WriteMeta(ctx context.Context, db *Database, meta map[string]string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning meta transaction: %w", err)
+	}
+	defer tx.Rollback() // Safe to call even after commit
+
+	for _, key := range slices.Sorted(maps.Keys(meta)) {
+		if _, err := tx.ExecContext(ctx, db.rebind("DELETE FROM _meta WHERE key = ?"), key); err != nil {
+			return fmt.Errorf("replacing meta %s: %w", key, err)
+		}
+		if _, err := tx.ExecContext(ctx, db.rebind("INSERT INTO _meta (key, value) VALUES (?, ?)"), key, meta[key]); err != nil {
+			return fmt.Errorf("recording meta %s: %w", key, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing meta transaction: %w", err)
+	}
+	return nil
+}
+
+// Status values of the MetaStatus entry. An extract that stops between
+// writing StatusIncomplete and StatusComplete was interrupted.
+const (
+	MetaStatus       = "status"
+	StatusIncomplete = "incomplete"
+	StatusComplete   = "complete"
+)
+
+// ReadMeta returns the _meta entries. The catalog must exist, as it does
+// after LoadCatalog.
+func ReadMeta(ctx context.Context, db *Database) (map[string]string, error) {
+	meta := make(map[string]string)
+	rows, err := db.db.QueryContext(ctx, "SELECT key, value FROM _meta")
+	if err != nil {
+		return nil, fmt.Errorf("reading _meta: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("scanning _meta row: %w", err)
+		}
+		meta[key] = value
+	}
+	return meta, rows.Err()
+}
+
+// HasLanguage reports whether any of a plan's tables holds rows of one
+// (patch, language) unit, recorded in the catalog or not.
+func HasLanguage(ctx context.Context, db *Database, plan *TablePlan, patch, language string) (bool, error) {
+	for _, table := range plan.tableNames() {
+		query := fmt.Sprintf("SELECT 1 FROM %s WHERE %s = ?", quoteSQLIdentifier(table), colLanguage)
+		args := []any{language}
+		if plan.patched {
+			query += fmt.Sprintf(" AND %s = ?", colPatch)
+			args = append(args, patch)
+		}
+		var one int
+		err := db.QueryRow(ctx, db.rebind(query+" LIMIT 1"), args...).Scan(&one)
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return false, fmt.Errorf("checking %s rows in %s: %w", language, table, err)
+		}
+	}
+	return false, nil
+}
+
+// boolInt binds a flag as 0 or 1: catalog flags are INTEGER columns, which
+// PostgreSQL will not fill from a boolean.
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// nullString binds an empty string as NULL.
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,445 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jchantrell/exiledb/internal/dat"
+)
+
+// serialBackend allows one bulk load at a time, like PostgreSQL, so junction
+// tables load in passes of their own.
+type serialBackend struct{ Backend }
+
+func (serialBackend) ConcurrentBulkInserts() bool { return false }
+
+func TestLoadSQLite(t *testing.T) {
+	testLoad(t, filepath.Join(t.TempDir(), "exile.db"), false)
+}
+
+func TestLoadSQLiteSerial(t *testing.T) {
+	testLoad(t, filepath.Join(t.TempDir(), "exile.db"), true)
+}
+
+// TestLoadPostgres runs against the database in EXILEDB_TEST_POSTGRES, a
+// postgres:// URL, in a schema of its own that is dropped afterwards.
+func TestLoadPostgres(t *testing.T) {
+	target := os.Getenv("EXILEDB_TEST_POSTGRES")
+	if target == "" {
+		t.Skip("EXILEDB_TEST_POSTGRES not set")
+	}
+	schema := fmt.Sprintf("exiledb_test_%d", time.Now().UnixNano())
+	sep := "?"
+	if strings.Contains(target, "?") {
+		sep = "&"
+	}
+	t.Cleanup(func() {
+		db, err := NewDatabase(DefaultDatabaseOptions(target))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer db.Close()
+		if _, err := db.db.Exec("DROP SCHEMA " + quoteSQLIdentifier(schema) + " CASCADE"); err != nil {
+			t.Error(err)
+		}
+	})
+	testLoad(t, target+sep+"search_path="+schema, false)
+}
+
+// testLoad creates, fills, views and checks two tables: Items references
+// Tags by a scalar key and by a junction table, with one dangling reference
+// in each, and the ItemKinds enumeration, without. Serial limits the backend
+// to one bulk load at a time.
+func testLoad(t *testing.T, target string, serial bool) {
+	name := func(s string) *string { return &s }
+	ctx := context.Background()
+	db, err := NewDatabase(DefaultDatabaseOptions(target))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if serial {
+		db.backend = serialBackend{db.backend}
+	}
+
+	schemas := []dat.TableSchema{
+		{Name: "Tags", Columns: []dat.TableColumn{
+			{Name: name("Id"), Type: dat.TypeString},
+		}},
+		{Name: "Items", Columns: []dat.TableColumn{
+			{Name: name("Id"), Type: dat.TypeString},
+			{Name: name("Tag"), Type: dat.TypeForeignRow, References: &dat.ColumnReference{Table: "Tags"}},
+			{Name: name("Tags"), Type: dat.TypeForeignRow, Array: true, References: &dat.ColumnReference{Table: "Tags"}},
+			{Name: name("Weight"), Type: dat.TypeFloat32},
+			{Name: name("Kind"), Type: dat.TypeEnumRow, References: &dat.ColumnReference{Table: "ItemKinds"}},
+		}},
+	}
+	enums := []dat.SchemaEnumeration{
+		{Name: "ItemKinds", Indexing: 1, Enumerators: []*string{name("Weapon"), nil}},
+	}
+	plans, err := Plan(schemas, PlanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCatalog(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateSchemas(ctx, db, plans, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := WriteEnumerations(ctx, db, plans, enums, "3.25.0"); err != nil || n != 1 {
+		t.Fatalf("WriteEnumerations = %d, %v; want 1 table", n, err)
+	}
+
+	batches := []*dat.Batch{
+		{Len: 2, Columns: []dat.Column{
+			{Kind: dat.KindString, Strings: []string{"fire", "cold"}, Nulls: dat.Bitmap{0}},
+		}},
+		{Len: 2, Columns: []dat.Column{
+			{Kind: dat.KindString, Strings: []string{"Ruby", "Sapphire"}, Nulls: dat.Bitmap{0}},
+			{Kind: dat.KindInt, Ints: []int64{1, 9}, Nulls: dat.Bitmap{0}},
+			{Kind: dat.KindArray, Type: dat.TypeForeignRow, Elem: dat.KindInt, Ints: []int64{1, 0, 9}, Offsets: []int{0, 3, 3}, ElemNulls: dat.Bitmap{0b010}, Nulls: dat.Bitmap{0b10}},
+			{Kind: dat.KindFloat, Floats: []float64{0.5, 0}, Nulls: dat.Bitmap{0b10}},
+			{Kind: dat.KindInt, Ints: []int64{1, 2}, Nulls: dat.Bitmap{0}},
+		}},
+	}
+	for i, plan := range plans {
+		n, err := InsertTableData(ctx, db, plan, &TableData{
+			Schema:   &schemas[i],
+			Rows:     dat.NewBatches(batches[i]),
+			Language: "English",
+			Patch:    "3.25.0",
+			SHA256:   "abc123",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 2 {
+			t.Errorf("%s: inserted %d rows, want 2", plan.SQLName(), n)
+		}
+	}
+
+	var junctionRows int
+	if err := db.QueryRow(ctx, "SELECT COUNT(*) FROM items_tags_junction").Scan(&junctionRows); err != nil {
+		t.Fatal(err)
+	}
+	if junctionRows != 2 {
+		t.Errorf("items_tags_junction has %d rows, want 2", junctionRows)
+	}
+
+	var sum, refTable string
+	if err := db.QueryRow(ctx, "SELECT sha256 FROM _table_languages WHERE table_name = 'items'").Scan(&sum); err != nil || sum != "abc123" {
+		t.Errorf("_table_languages sha256 for items = %q, %v; want abc123", sum, err)
+	}
+	if err := db.QueryRow(ctx, "SELECT ref_table FROM _columns WHERE table_name = 'items' AND name = 'kind'").Scan(&refTable); err != nil || refTable != "item_kinds" {
+		t.Errorf("_columns ref_table for items.kind = %q, %v; want item_kinds", refTable, err)
+	}
+
+	catalog, err := LoadCatalog(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := catalog["items"]; r == nil || !r.Has("3.25.0", "English") || r.Signature != plans[1].Signature() || r.Enumeration() {
+		t.Errorf("catalog entry for items = %+v", r)
+	}
+	if r := catalog["item_kinds"]; r == nil || !r.Enumeration() || r.SchemaName != "ItemKinds" {
+		t.Errorf("catalog entry for item_kinds = %+v", r)
+	}
+
+	for language, want := range map[string]bool{"English": true, "French": false} {
+		if found, err := HasLanguage(ctx, db, plans[1], "3.25.0", language); err != nil || found != want {
+			t.Errorf("HasLanguage(items, %s) = %v, %v; want %v", language, found, err, want)
+		}
+	}
+
+	tables, err := db.UserTables(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 4 || !tables["items_tags_junction"] || !tables["item_kinds"] {
+		t.Errorf("UserTables = %v, want tags, items, items_tags_junction and item_kinds", tables)
+	}
+
+	if n, err := CreateViews(ctx, db, plans); err != nil || n != 2 {
+		t.Fatalf("CreateViews = %d, %v; want 2 views", n, err)
+	}
+	var tagID, tags, tagIDs, kind string
+	if err := db.QueryRow(ctx, "SELECT tag_id, tags, tags_id, kind_value FROM items_resolved WHERE _index = 0").Scan(&tagID, &tags, &tagIDs, &kind); err != nil {
+		t.Fatal(err)
+	}
+	// PostgreSQL spaces its JSON arrays out.
+	tags, tagIDs = strings.ReplaceAll(tags, " ", ""), strings.ReplaceAll(tagIDs, " ", "")
+	if tagID != "cold" || tags != "[1,9]" || tagIDs != `["cold",null]` || kind != "Weapon" {
+		t.Errorf("items_resolved row 0 = %q, %s, %s, %q; want cold, [1,9], [\"cold\",null], Weapon", tagID, tags, tagIDs, kind)
+	}
+
+	violations, err := db.CheckForeignKeys(ctx, plans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]int)
+	for _, v := range violations {
+		if v.Parent != "tags" {
+			t.Errorf("violation %+v, want parent tags", v)
+		}
+		found[v.Table]++
+	}
+	if len(violations) != 2 || found["items"] != 1 || found["items_tags_junction"] != 1 {
+		t.Errorf("CheckForeignKeys = %+v, want one in items and one in items_tags_junction", violations)
+	}
+}
+
+// TestLoadCatalog records one single-patch and one multi-patch table, each
+// with several (patch, language) units, and reads them back.
+func TestLoadCatalog(t *testing.T) {
+	name := func(s string) *string { return &s }
+	ctx := context.Background()
+	db, err := NewDatabase(DefaultDatabaseOptions(filepath.Join(t.TempDir(), "exile.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	catalog, err := LoadCatalog(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(catalog) != 0 {
+		t.Fatalf("catalog of a new database = %v, want empty", catalog)
+	}
+
+	schema := dat.TableSchema{Name: "Mods", Columns: []dat.TableColumn{{Name: name("Id"), Type: dat.TypeString}}}
+	single, err := Plan([]dat.TableSchema{schema}, PlanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema.Name = "Stats"
+	multi, err := Plan([]dat.TableSchema{schema}, PlanOptions{MultiPatch: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plans := append(single, multi...)
+	if _, err := CreateSchemas(ctx, db, plans, nil); err != nil {
+		t.Fatal(err)
+	}
+	units := []struct {
+		plan            *TablePlan
+		patch, language string
+	}{
+		{single[0], "3.25.0", "English"},
+		{single[0], "3.25.0", "French"},
+		{multi[0], "3.24.0", "English"},
+		{multi[0], "3.25.0", "English"},
+	}
+	for _, u := range units {
+		if _, err := InsertTableData(ctx, db, u.plan, &TableData{
+			Schema: &schema,
+			Rows: dat.NewBatches(&dat.Batch{Len: 1, Columns: []dat.Column{
+				{Kind: dat.KindString, Strings: []string{"a"}, Nulls: dat.Bitmap{0}},
+			}}),
+			Language: u.language,
+			Patch:    u.patch,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	catalog, err = LoadCatalog(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(catalog) != 2 {
+		t.Fatalf("catalog = %v, want mods and stats", catalog)
+	}
+	mods, stats := catalog["mods"], catalog["stats"]
+	if mods == nil || mods.SchemaName != "Mods" || mods.MultiPatch || mods.Signature != single[0].Signature() {
+		t.Errorf("catalog entry for mods = %+v", mods)
+	}
+	if stats == nil || !stats.MultiPatch || stats.Signature != multi[0].Signature() {
+		t.Errorf("catalog entry for stats = %+v", stats)
+	}
+	for _, u := range units {
+		if r := catalog[u.plan.SQLName()]; r == nil || !r.Has(u.patch, u.language) {
+			t.Errorf("catalog entry for %s lacks %s %s", u.plan.SQLName(), u.patch, u.language)
+		}
+	}
+	if mods.Has("3.24.0", "English") || stats.Has("3.24.0", "French") || len(mods.Languages) != 1 || len(stats.Languages) != 2 {
+		t.Errorf("catalog languages = %v and %v, want only the inserted units", mods.Languages, stats.Languages)
+	}
+
+	if err := DeleteLanguages(ctx, db, single[0], "3.25.0", []string{"French"}); err != nil {
+		t.Fatal(err)
+	}
+	catalog, err = LoadCatalog(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := catalog["mods"]; r.Has("3.25.0", "French") || !r.Has("3.25.0", "English") {
+		t.Errorf("after deleting French, mods languages = %v", r.Languages)
+	}
+}
+
+// TestDropTablesRecordedJunctions replaces a table whose array reference
+// column the new plan no longer has, and checks its junction table goes too.
+func TestDropTablesRecordedJunctions(t *testing.T) {
+	name := func(s string) *string { return &s }
+	ctx := context.Background()
+	db, err := NewDatabase(DefaultDatabaseOptions(filepath.Join(t.TempDir(), "exile.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := LoadCatalog(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	old, err := Plan([]dat.TableSchema{{Name: "Mods", Columns: []dat.TableColumn{
+		{Name: name("Id"), Type: dat.TypeString},
+		{Name: name("Tags"), Type: dat.TypeForeignRow, Array: true, References: &dat.ColumnReference{Table: "Tags"}},
+	}}}, PlanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateSchemas(ctx, db, old, nil); err != nil {
+		t.Fatal(err)
+	}
+	current, err := Plan([]dat.TableSchema{{Name: "Mods", Columns: []dat.TableColumn{
+		{Name: name("Id"), Type: dat.TypeString},
+	}}}, PlanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DropTables(ctx, db, current); err != nil {
+		t.Fatal(err)
+	}
+	tables, err := db.UserTables(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 0 {
+		t.Errorf("after DropTables, UserTables = %v, want none", tables)
+	}
+	var columns int
+	if err := db.QueryRow(ctx, "SELECT COUNT(*) FROM _columns").Scan(&columns); err != nil || columns != 0 {
+		t.Errorf("after DropTables, _columns holds %d rows, %v; want none", columns, err)
+	}
+}
+
+// TestMultiPatchScoping loads two patches into multi-patch tables and checks
+// that rows, junction rows, deletes and foreign keys are scoped by _patch.
+func TestMultiPatchScoping(t *testing.T) {
+	name := func(s string) *string { return &s }
+	ctx := context.Background()
+	db, err := NewDatabase(DefaultDatabaseOptions(filepath.Join(t.TempDir(), "exile.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	schemas := []dat.TableSchema{
+		{Name: "Tags", Columns: []dat.TableColumn{
+			{Name: name("Id"), Type: dat.TypeString},
+		}},
+		{Name: "Items", Columns: []dat.TableColumn{
+			{Name: name("Tag"), Type: dat.TypeForeignRow, References: &dat.ColumnReference{Table: "Tags"}},
+			{Name: name("Tags"), Type: dat.TypeForeignRow, Array: true, References: &dat.ColumnReference{Table: "Tags"}},
+		}},
+	}
+	plans, err := Plan(schemas, PlanOptions{MultiPatch: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCatalog(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateSchemas(ctx, db, plans, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// 3.24.0 has two tags, 3.25.0 one; in both, the item references tag 1,
+	// which only resolves in 3.24.0.
+	for _, patch := range []struct {
+		name string
+		tags []string
+	}{
+		{"3.24.0", []string{"fire", "cold"}},
+		{"3.25.0", []string{"fire"}},
+	} {
+		batches := []*dat.Batch{
+			{Len: len(patch.tags), Columns: []dat.Column{
+				{Kind: dat.KindString, Strings: patch.tags, Nulls: dat.Bitmap{0}},
+			}},
+			{Len: 1, Columns: []dat.Column{
+				{Kind: dat.KindInt, Ints: []int64{1}, Nulls: dat.Bitmap{0}},
+				{Kind: dat.KindArray, Type: dat.TypeForeignRow, Elem: dat.KindInt, Ints: []int64{1}, Offsets: []int{0, 1}, Nulls: dat.Bitmap{0}},
+			}},
+		}
+		for i, plan := range plans {
+			if _, err := InsertTableData(ctx, db, plan, &TableData{
+				Schema:   &schemas[i],
+				Rows:     dat.NewBatches(batches[i]),
+				Language: "English",
+				Patch:    patch.name,
+			}); err != nil {
+				t.Fatalf("inserting %s of %s: %v", plan.SQLName(), patch.name, err)
+			}
+		}
+	}
+
+	count := func(query string, args ...any) int {
+		t.Helper()
+		var n int
+		if err := db.QueryRow(ctx, query, args...).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	for _, tt := range []struct {
+		query string
+		want  int
+	}{
+		{"SELECT COUNT(*) FROM tags WHERE _patch = '3.24.0'", 2},
+		{"SELECT COUNT(*) FROM tags WHERE _patch = '3.25.0'", 1},
+		{"SELECT COUNT(*) FROM items_tags_junction WHERE _patch = '3.24.0'", 1},
+		{"SELECT COUNT(*) FROM items_tags_junction WHERE _patch = '3.25.0'", 1},
+	} {
+		if got := count(tt.query); got != tt.want {
+			t.Errorf("%s = %d, want %d", tt.query, got, tt.want)
+		}
+	}
+
+	violations, err := db.CheckForeignKeys(ctx, plans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]int)
+	for _, v := range violations {
+		found[v.Table]++
+	}
+	if len(violations) != 2 || found["items"] != 1 || found["items_tags_junction"] != 1 {
+		t.Errorf("CheckForeignKeys = %+v, want the 3.25.0 rows of items and items_tags_junction", violations)
+	}
+
+	if err := DeleteLanguages(ctx, db, plans[1], "3.25.0", []string{"English"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := count("SELECT COUNT(*) FROM items WHERE _patch = '3.24.0'"); got != 1 {
+		t.Errorf("after deleting 3.25.0, items holds %d rows of 3.24.0, want 1", got)
+	}
+	if got := count("SELECT COUNT(*) FROM items_tags_junction WHERE _patch = '3.25.0'"); got != 0 {
+		t.Errorf("after deleting 3.25.0, items_tags_junction holds %d rows of it, want 0", got)
+	}
+	for patch, want := range map[string]bool{"3.24.0": true, "3.25.0": false} {
+		if found, err := HasLanguage(ctx, db, plans[1], patch, "English"); err != nil || found != want {
+			t.Errorf("HasLanguage(items, %s) = %v, %v; want %v", patch, found, err, want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/jchantrell/exiledb/internal/dat"
+	"github.com/jchantrell/exiledb/internal/poe"
+)
+
+// WriteEnumerations materializes the enumerations the plans' enumrow columns
+// reference as lookup tables of _index and value, named like tables
+// (ModDomains -> mod_domains). _index counts from the enumeration's
+// indexing, so it matches the values stored in the referencing columns, and
+// unnamed enumerators keep their index with a null value. Lookup tables are
+// not per language; in multi-patch plans they carry _patch and keep each
+// patch's values, otherwise every write replaces their rows. They are
+// recorded in _tables like data tables, and one written in the other mode,
+// or not recorded, is dropped and recreated: planIncremental only lets such
+// a table through with replace. It returns the number of lookup tables
+// written.
+func WriteEnumerations(ctx context.Context, db *Database, plans []*TablePlan, enums []dat.SchemaEnumeration, patch string) (int, error) {
+	wanted := make(map[string]bool) // referenced lookup table -> multi-patch
+	for _, plan := range plans {
+		for _, name := range plan.Enumerations() {
+			wanted[name] = plan.patched
+		}
+	}
+	if len(wanted) == 0 {
+		return 0, nil
+	}
+
+	catalog, err := LoadCatalog(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	existing, err := db.UserTables(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("beginning enumeration transaction: %w", err)
+	}
+	defer tx.Rollback() // Safe to call even after commit
+
+	written := 0
+	for i := range enums {
+		enum := &enums[i]
+		name := poe.ToSnakeCase(enum.Name)
+		patched, ok := wanted[name]
+		if !ok {
+			continue
+		}
+		delete(wanted, name)
+		record := catalog[name]
+		if record != nil && !record.Enumeration() {
+			slog.Warn("Skipping enumeration named like an extracted table", "enumeration", enum.Name, "table", name)
+			continue
+		}
+		if err := validateIdentifier(name); err != nil {
+			return 0, fmt.Errorf("enumeration %s: %w", enum.Name, err)
+		}
+
+		if (record == nil && existing[name]) || (record != nil && record.MultiPatch != patched) {
+			slog.Info("Replacing enumeration table", "table", name)
+			if _, err := tx.ExecContext(ctx, db.backend.DropTable(name)); err != nil {
+				return 0, fmt.Errorf("dropping enumeration table %s: %w", name, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, generateEnumDDL(name, patched, db.backend)); err != nil {
+			return 0, fmt.Errorf("creating enumeration table %s: %w", name, err)
+		}
+		if err := recordEnumeration(ctx, db, tx, name, enum.Name, patched); err != nil {
+			return 0, err
+		}
+
+		query := "DELETE FROM " + quoteSQLIdentifier(name)
+		var args []any
+		if patched {
+			query += " WHERE " + colPatch + " = ?"
+			args = append(args, patch)
+		}
+		if _, err := tx.ExecContext(ctx, db.rebind(query), args...); err != nil {
+			return 0, fmt.Errorf("clearing enumeration table %s: %w", name, err)
+		}
+
+		if err := insertEnumerators(ctx, db, tx, name, enum, patched, patch); err != nil {
+			return 0, err
+		}
+		written++
+	}
+
+	for name := range wanted {
+		slog.Debug("Referenced enumeration not in schema", "table", name)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("committing enumeration transaction: %w", err)
+	}
+	return written, nil
+}
+
+// insertEnumerators loads enum's enumerators into its table, closing the
+// writer before returning so the next enumeration can open its own.
+func insertEnumerators(ctx context.Context, db *Database, tx *sql.Tx, name string, enum *dat.SchemaEnumeration, patched bool, patch string) error {
+	columns := []string{colIndex, colValue}
+	if patched {
+		columns = append([]string{colPatch}, columns...)
+	}
+	writer, err := db.backend.BulkInsert(ctx, tx, name, columns)
+	if err != nil {
+		return fmt.Errorf("preparing insert for enumeration table %s: %w", name, err)
+	}
+	defer writer.Close(ctx) // Safe after the explicit Close below
+
+	for j, enumerator := range enum.Enumerators {
+		var value any
+		if enumerator != nil {
+			value = *enumerator
+		}
+		values := []any{enum.Indexing + j, value}
+		if patched {
+			values = append([]any{patch}, values...)
+		}
+		if err := writer.Write(ctx, values); err != nil {
+			return fmt.Errorf("inserting %s[%d]: %w", name, enum.Indexing+j, err)
+		}
+	}
+	if err := writer.Close(ctx); err != nil {
+		return fmt.Errorf("inserting rows for enumeration table %s: %w", name, err)
+	}
+	return nil
+}
+
+// enumSignature identifies a lookup table's layout in the catalog, as
+// TablePlan.Signature does a data table's.
+func enumSignature(name string, patched bool) string {
+	return signature(generateEnumDDL(name, patched, sqliteBackend{}))
+}
+
+func generateEnumDDL(name string, patched bool, backend Backend) string {
+	var columns, key []string
+	if patched {
+		columns = append(columns, colPatch+" "+backend.ColumnType("TEXT")+" NOT NULL")
+		key = append(key, colPatch)
+	}
+	columns = append(columns,
+		colIndex+" "+backend.ColumnType("INTEGER")+" NOT NULL",
+		colValue+" "+backend.ColumnType("TEXT"),
+		fmt.Sprintf("PRIMARY KEY (%s)", keyList(key, colIndex)),
+	)
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n    %s\n)",
+		quoteSQLIdentifier(name), strings.Join(columns, ",\n    "))
+}
@@ -3,108 +3,113 @@ package database
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
-	"log/slog"
-	"reflect"
-	"strings"
 
 	"github.com/jchantrell/exiledb/internal/dat"
 )
 
+// insertBatchSize is how many rows are decoded at a time before insertion.
+const insertBatchSize = 1024
+
+// BatchSource decodes a table's rows into a reusable columnar batch;
+// dat.RowReader is the streaming implementation.
+type BatchSource interface {
+	NewBatch() *dat.Batch
+	ReadBatch(b *dat.Batch, max int) int
+
+	// Rewind starts reading again from the first row.
+	Rewind()
+}
+
 type TableData struct {
 	Schema *dat.TableSchema
 
-	Rows []dat.ParsedRow
+	Rows BatchSource
 
 	Language string
+
+	// Patch is recorded in the catalog for every table, and written to each
+	// row's _patch column when the plan is multi-patch.
+	Patch string
+
+	// Path and SHA256 identify the dat file the rows were read from, for
+	// the catalog.
+	Path   string
+	SHA256 string
 }
 
 type colBinding struct {
 	sqlName string
-	field   string                 // parser field name ("Unknown3" or *col.Name)
-	process func(any) (any, error) // bound per column type/references at plan time
+	slot    int // the field's column in a dat.Batch
 }
 
 type junctionBinding struct {
 	sqlName   string
-	field     string // parser field name
-	insertSQL string
+	slot      int
+	tableName string
 }
 
 type insertPlan struct {
-	tableName string
-	insertSQL string
-	cols      []colBinding
-	junctions []junctionBinding
+	tableName       string
+	patched         bool
+	columns         []string
+	cols            []colBinding
+	junctionColumns []string
+	junctions       []junctionBinding
 }
 
 func buildInsertPlan(plan *TablePlan) *insertPlan {
-	quotedColumns := []string{quoteSQLIdentifier(colIndex), quoteSQLIdentifier(colLanguage)}
-	placeholders := []string{"?", "?"}
+	var columns []string
+	if plan.patched {
+		columns = append(columns, colPatch)
+	}
+	columns = append(columns, colIndex, colLanguage)
 
 	cols := make([]colBinding, 0, len(plan.columns))
 	for _, col := range plan.columns {
 		cols = append(cols, colBinding{
 			sqlName: col.sqlName,
-			field:   col.field,
-			process: valueProcessor(col.column),
+			slot:    col.slot,
 		})
-		quotedColumns = append(quotedColumns, quoteSQLIdentifier(col.sqlName))
-		placeholders = append(placeholders, "?")
+		columns = append(columns, col.sqlName)
 	}
 
 	junctions := make([]junctionBinding, 0, len(plan.junctions))
 	for _, junction := range plan.junctions {
 		junctions = append(junctions, junctionBinding{
-			sqlName: junction.sqlName,
-			field:   junction.field,
-			insertSQL: fmt.Sprintf("INSERT INTO %s (%s, %s, %s, %s) VALUES (?, ?, ?, ?)",
-				quoteSQLIdentifier(junction.tableName),
-				quoteSQLIdentifier(colLanguage),
-				quoteSQLIdentifier(colParentIndex),
-				quoteSQLIdentifier(colArrayIndex),
-				quoteSQLIdentifier(colValue)),
+			sqlName:   junction.sqlName,
+			slot:      junction.slot,
+			tableName: junction.tableName,
 		})
 	}
 
 	return &insertPlan{
-		tableName: plan.sqlName,
-		insertSQL: fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
-			quoteSQLIdentifier(plan.sqlName),
-			strings.Join(quotedColumns, ", "),
-			strings.Join(placeholders, ", ")),
-		cols:      cols,
-		junctions: junctions,
+		tableName:       plan.sqlName,
+		patched:         plan.patched,
+		columns:         columns,
+		cols:            cols,
+		junctionColumns: append(plan.scopeColumns(), colParentIndex, colArrayIndex, colValue),
+		junctions:       junctions,
 	}
 }
 
-func valueProcessor(column *dat.TableColumn) func(any) (any, error) {
-	switch {
-	case column.Array && column.References == nil:
-		return processArrayValue
-	case column.References != nil:
-		return processReferenceValue
-	default:
-		fieldType := column.Type
-		return func(value any) (any, error) {
-			return processScalarValue(value, fieldType)
-		}
-	}
-}
-
-func InsertTableData(ctx context.Context, db *Database, plan *TablePlan, tableData *TableData) error {
+// InsertTableData streams every row from tableData.Rows into the table in one
+// transaction and returns the number of rows inserted. Rows are decoded in
+// columnar batches and bound straight from the typed columns. Junction rows
+// are written as their batch is read, or, when the backend only allows one
+// bulk load at a time, in a further pass over the rows for each junction
+// table once the main table has loaded.
+func InsertTableData(ctx context.Context, db *Database, plan *TablePlan, tableData *TableData) (int, error) {
 	if tableData == nil {
-		return fmt.Errorf("table data cannot be nil")
+		return 0, fmt.Errorf("table data cannot be nil")
 	}
 
 	if tableData.Schema == nil {
-		return fmt.Errorf("table schema cannot be nil")
+		return 0, fmt.Errorf("table schema cannot be nil")
 	}
 
-	if len(tableData.Rows) == 0 {
-		slog.Debug("No rows to insert", "table", tableData.Schema.Name)
-		return nil
+	if tableData.Rows == nil {
+		return 0, fmt.Errorf("table rows cannot be nil")
 	}
 
 	insert := plan.insert
@@ -112,181 +117,198 @@ func InsertTableData(ctx context.Context, db *Database, plan *TablePlan, tableDa
 
 	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("starting transaction: %w", err)
+		return 0, fmt.Errorf("starting transaction: %w", err)
 	}
 	defer tx.Rollback() // Safe to call even after commit
 
-	stmt, err := tx.PrepareContext(ctx, insert.insertSQL)
+	writer, err := db.backend.BulkInsert(ctx, tx, tableName, insert.columns)
 	if err != nil {
-		return fmt.Errorf("preparing insert statement for %s: %w", tableName, err)
+		return 0, fmt.Errorf("preparing insert for %s: %w", tableName, err)
 	}
-	defer stmt.Close()
+	defer writer.Close(ctx) // Safe after the explicit Close below
 
-	junctionStmts := make([]*sql.Stmt, len(insert.junctions))
-	for i, junction := range insert.junctions {
-		junctionStmt, err := tx.PrepareContext(ctx, junction.insertSQL)
-		if err != nil {
-			return fmt.Errorf("preparing junction table statement for %s.%s: %w", tableName, junction.sqlName, err)
+	var junctions []*junctionWriter
+	defer func() {
+		for _, jw := range junctions {
+			jw.writer.Close(ctx) // Safe after the explicit Close below
+		}
+	}()
+	concurrent := db.backend.ConcurrentBulkInserts()
+	if concurrent {
+		for i := range insert.junctions {
+			jw, err := newJunctionWriter(ctx, db, tx, insert, &insert.junctions[i], tableData)
+			if err != nil {
+				return 0, err
+			}
+			junctions = append(junctions, jw)
 		}
-		defer junctionStmt.Close()
-		junctionStmts[i] = junctionStmt
 	}
 
-	for _, row := range tableData.Rows {
-		if err := insertRow(ctx, insert, stmt, junctionStmts, tableData, &row); err != nil {
-			return fmt.Errorf("inserting row %d for table %s: %w", row.Index, tableName, err)
+	batch := tableData.Rows.NewBatch()
+	values := make([]any, 0, len(insert.columns))
+	inserted := 0
+	for n := tableData.Rows.ReadBatch(batch, insertBatchSize); n > 0; n = tableData.Rows.ReadBatch(batch, insertBatchSize) {
+		for row := range n {
+			if err := insertRow(ctx, insert, writer, tableData, batch, row, values); err != nil {
+				return 0, fmt.Errorf("inserting row %d for table %s: %w", batch.Start+row, tableName, err)
+			}
 		}
+		for _, jw := range junctions {
+			if err := jw.writeBatch(ctx, batch, n); err != nil {
+				return 0, err
+			}
+		}
+		inserted += n
 	}
-
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("committing transaction for %s: %w", tableName, err)
+	if err := writer.Close(ctx); err != nil {
+		return 0, fmt.Errorf("inserting rows for table %s: %w", tableName, err)
 	}
-
-	return nil
-}
-
-func insertRow(ctx context.Context, plan *insertPlan, stmt *sql.Stmt, junctionStmts []*sql.Stmt, tableData *TableData, row *dat.ParsedRow) error {
-	values := make([]any, 0, len(plan.cols)+2)
-	values = append(values, row.Index, tableData.Language)
-
-	for _, col := range plan.cols {
-		raw, exists := row.Fields[col.field]
-		if !exists {
-			values = append(values, nil) // NULL for missing columns
-			continue
+	for _, jw := range junctions {
+		if err := jw.close(ctx); err != nil {
+			return 0, err
 		}
+	}
 
-		processed, err := col.process(raw)
-		if err != nil {
-			return fmt.Errorf("processing value for column %s: %w", col.sqlName, err)
+	if !concurrent {
+		for i := range insert.junctions {
+			if err := insertJunctionTable(ctx, db, tx, insert, &insert.junctions[i], tableData, batch); err != nil {
+				return 0, err
+			}
 		}
-		values = append(values, processed)
 	}
 
-	if _, err := stmt.ExecContext(ctx, values...); err != nil {
-		return err
+	if err := recordLanguage(ctx, db, tx, tableName, tableData); err != nil {
+		return 0, err
 	}
 
-	for i := range plan.junctions {
-		if err := insertJunctionRows(ctx, junctionStmts[i], &plan.junctions[i], tableData, row); err != nil {
-			return err
-		}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("committing transaction for %s: %w", tableName, err)
 	}
 
-	return nil
+	return inserted, nil
 }
 
-func insertJunctionRows(ctx context.Context, stmt *sql.Stmt, junction *junctionBinding, tableData *TableData, row *dat.ParsedRow) error {
-	value, exists := row.Fields[junction.field]
-	if !exists {
-		return nil // No data for this array column
+func insertRow(ctx context.Context, plan *insertPlan, writer BulkWriter, tableData *TableData, batch *dat.Batch, row int, values []any) error {
+	if plan.patched {
+		values = append(values, tableData.Patch)
 	}
+	values = append(values, batch.Start+row, tableData.Language)
 
-	arrayValues, err := convertToSlice(value)
-	if err != nil {
-		return fmt.Errorf("converting array value for column %s: %w", junction.sqlName, err)
-	}
-
-	for arrayIndex, arrayValue := range arrayValues {
-		processed, err := processReferenceValue(arrayValue)
+	for _, col := range plan.cols {
+		value, err := columnValue(&batch.Columns[col.slot], row)
 		if err != nil {
-			return fmt.Errorf("processing array element at index %d: %w", arrayIndex, err)
+			return fmt.Errorf("processing value for column %s: %w", col.sqlName, err)
 		}
+		values = append(values, value)
+	}
 
-		if processed == nil {
-			continue // Skip null references
-		}
+	return writer.Write(ctx, values)
+}
 
-		if _, err := stmt.ExecContext(ctx, tableData.Language, row.Index, arrayIndex, processed); err != nil {
-			return fmt.Errorf("inserting junction row for %s[%d]: %w", junction.sqlName, arrayIndex, err)
-		}
+// columnValue binds one typed column value: integers as int64, floats as
+// float64, and non-reference arrays as JSON text. Nulls bind as NULL.
+func columnValue(c *dat.Column, row int) (any, error) {
+	if c.IsNull(row) {
+		return nil, nil
+	}
+	switch c.Kind {
+	case dat.KindInt:
+		return c.Ints[row], nil
+	case dat.KindFloat:
+		return c.Floats[row], nil
+	case dat.KindString:
+		return c.Strings[row], nil
+	case dat.KindArray:
+		return string(c.AppendJSON(nil, row)), nil
 	}
+	return nil, fmt.Errorf("unsupported column kind %d", c.Kind)
+}
 
-	return nil
+// junctionWriter loads one array column's elements into its junction table.
+type junctionWriter struct {
+	plan     *insertPlan
+	junction *junctionBinding
+	writer   BulkWriter
+	args     []any // the scope columns, followed by a row's values
+	scope    int
 }
 
-func processArrayValue(value any) (any, error) {
-	jsonBytes, err := json.Marshal(value)
+func newJunctionWriter(ctx context.Context, db *Database, tx *sql.Tx, plan *insertPlan, junction *junctionBinding, tableData *TableData) (*junctionWriter, error) {
+	writer, err := db.backend.BulkInsert(ctx, tx, junction.tableName, plan.junctionColumns)
 	if err != nil {
-		return nil, fmt.Errorf("serializing array value to JSON: %w", err)
+		return nil, fmt.Errorf("preparing junction table insert for %s.%s: %w", plan.tableName, junction.sqlName, err)
 	}
-	return string(jsonBytes), nil
-}
 
-// processReferenceValue normalizes foreign key reference values. The parser
-// emits row references as *uint32 with nil for null sentinels; junction array
-// elements arrive already dereferenced by convertToSlice.
-func processReferenceValue(value any) (any, error) {
-	switch v := value.(type) {
-	case *uint32:
-		if v == nil {
-			return nil, nil // NULL reference
-		}
-		return int64(*v), nil // Convert to signed integer for SQLite
-	case uint32:
-		return int64(v), nil
+	args := make([]any, 0, len(plan.junctionColumns))
+	if plan.patched {
+		args = append(args, tableData.Patch)
 	}
-
-	return value, nil
+	args = append(args, tableData.Language)
+
+	return &junctionWriter{
+		plan:     plan,
+		junction: junction,
+		writer:   writer,
+		args:     args,
+		scope:    len(args),
+	}, nil
 }
 
-func processScalarValue(value any, fieldType dat.FieldType) (any, error) {
-	if fieldType == dat.TypeBool {
-		if boolVal, ok := value.(bool); ok {
-			if boolVal {
-				return int64(1), nil
-			}
-			return int64(0), nil
+// writeBatch writes the non-null elements of the array in each of the
+// batch's first n rows.
+func (w *junctionWriter) writeBatch(ctx context.Context, batch *dat.Batch, n int) error {
+	c := &batch.Columns[w.junction.slot]
+	for row := range n {
+		if c.IsNull(row) {
+			continue // No data for this array column
 		}
-	}
+		parent := batch.Start + row
 
-	switch fieldType {
-	case dat.TypeInt16, dat.TypeInt32, dat.TypeInt64:
-		switch v := value.(type) {
-		case int16:
-			return int64(v), nil
-		case int32:
-			return int64(v), nil
-		case int64:
-			return v, nil
-		}
-	case dat.TypeUint16, dat.TypeUint32, dat.TypeUint64:
-		switch v := value.(type) {
-		case uint16:
-			return int64(v), nil
-		case uint32:
-			return int64(v), nil
-		case uint64:
-			return int64(v), nil
-		}
-	case dat.TypeFloat32, dat.TypeFloat64:
-		switch v := value.(type) {
-		case float32:
-			return float64(v), nil
-		case float64:
-			return v, nil
+		start, end := c.Elems(row)
+		for j := start; j < end; j++ {
+			if c.ElemIsNull(j) {
+				continue // Skip null references
+			}
+			var value any
+			switch c.Elem {
+			case dat.KindInt:
+				value = c.Ints[j]
+			case dat.KindFloat:
+				value = c.Floats[j]
+			case dat.KindString:
+				value = c.Strings[j]
+			default:
+				return fmt.Errorf("unsupported element kind %d in column %s", c.Elem, w.junction.sqlName)
+			}
+			if err := w.writer.Write(ctx, append(w.args[:w.scope], parent, j-start, value)); err != nil {
+				return fmt.Errorf("inserting junction row for %s[%d] of row %d: %w", w.junction.sqlName, j-start, parent, err)
+			}
 		}
 	}
+	return nil
+}
 
-	return value, nil
+func (w *junctionWriter) close(ctx context.Context) error {
+	if err := w.writer.Close(ctx); err != nil {
+		return fmt.Errorf("inserting junction rows for %s.%s: %w", w.plan.tableName, w.junction.sqlName, err)
+	}
+	return nil
 }
 
-func convertToSlice(value any) ([]any, error) {
-	rv := reflect.ValueOf(value)
-	if rv.Kind() != reflect.Slice {
-		return nil, fmt.Errorf("unsupported array type: %T", value)
+// insertJunctionTable loads one junction table in a pass of its own over the
+// rows, reusing batch.
+func insertJunctionTable(ctx context.Context, db *Database, tx *sql.Tx, plan *insertPlan, junction *junctionBinding, tableData *TableData, batch *dat.Batch) error {
+	jw, err := newJunctionWriter(ctx, db, tx, plan, junction, tableData)
+	if err != nil {
+		return err
 	}
+	defer jw.writer.Close(ctx) // Safe after the explicit Close below
 
-	result := make([]any, rv.Len())
-	for i := range result {
-		elem := rv.Index(i)
-		if elem.Kind() == reflect.Pointer {
-			if elem.IsNil() {
-				continue
-			}
-			elem = elem.Elem()
+	tableData.Rows.Rewind()
+	for n := tableData.Rows.ReadBatch(batch, insertBatchSize); n > 0; n = tableData.Rows.ReadBatch(batch, insertBatchSize) {
+		if err := jw.writeBatch(ctx, batch, n); err != nil {
+			return err
 		}
-		result[i] = elem.Interface()
 	}
-	return result, nil
+	return jw.close(ctx)
 }
@@ -3,6 +3,8 @@ package database
 import (
 	"fmt"
 	"log/slog"
+	"slices"
+	"strings"
 
 	"github.com/jchantrell/exiledb/internal/dat"
 	"github.com/jchantrell/exiledb/internal/poe"
@@ -11,42 +13,69 @@ import (
 const (
 	colIndex       = "_index"
 	colLanguage    = "_language"
+	colPatch       = "_patch"
 	colParentIndex = "_parent_index"
 	colArrayIndex  = "_array_index"
 	colValue       = "value"
 )
 
+// Names of the columns every main table carries besides the schema's own,
+// for writers that lay out rows outside SQLite. PatchColumn is only present
+// in multi-patch plans.
+const (
+	PatchColumn    = colPatch
+	IndexColumn    = colIndex
+	LanguageColumn = colLanguage
+)
+
 type planColumn struct {
 	sqlName   string
 	field     string
+	slot      int // index of the field in a decoded dat.Batch
 	sqlType   string
 	refTable  string // empty unless the column is a scalar foreign key
 	refColumn string
+	refEnum   bool // refTable is an enumeration lookup table
 	column    *dat.TableColumn
+	position  int // index of column in the schema
 }
 
 type planJunction struct {
 	tableName string
 	sqlName   string
 	field     string
+	slot      int
 	refTable  string
 	refColumn string
+	refEnum   bool
+	column    *dat.TableColumn
+	position  int
 }
 
 type TablePlan struct {
 	sqlName    string
 	schemaName string
+	tags       []string
+	patched    bool
 	columns    []planColumn
 	junctions  []planJunction
 	insert     *insertPlan
 }
 
+// PlanOptions controls the shape shared by every planned table.
+type PlanOptions struct {
+	// MultiPatch adds a _patch column to main and junction tables so one
+	// database can hold several patches side by side. Primary keys and
+	// foreign keys are then scoped by patch as well as language.
+	MultiPatch bool
+}
+
 // Plan computes the SQL plan for each table exactly once. The result feeds
 // both DDL creation and row insertion, so neither path re-derives it.
-func Plan(schemas []dat.TableSchema) ([]*TablePlan, error) {
+func Plan(schemas []dat.TableSchema, opts PlanOptions) ([]*TablePlan, error) {
 	plans := make([]*TablePlan, 0, len(schemas))
 	for i := range schemas {
-		plan, err := newTablePlan(&schemas[i])
+		plan, err := newTablePlan(&schemas[i], opts)
 		if err != nil {
 			return nil, err
 		}
@@ -55,7 +84,7 @@ func Plan(schemas []dat.TableSchema) ([]*TablePlan, error) {
 	return plans, nil
 }
 
-func newTablePlan(schema *dat.TableSchema) (*TablePlan, error) {
+func newTablePlan(schema *dat.TableSchema, opts PlanOptions) (*TablePlan, error) {
 	if schema == nil {
 		return nil, fmt.Errorf("table schema cannot be nil")
 	}
@@ -68,10 +97,18 @@ func newTablePlan(schema *dat.TableSchema) (*TablePlan, error) {
 		return nil, fmt.Errorf("table %s: %w", schema.Name, err)
 	}
 
-	plan := &TablePlan{sqlName: tableName, schemaName: schema.Name}
+	plan := &TablePlan{sqlName: tableName, schemaName: schema.Name, tags: schema.Tags, patched: opts.MultiPatch}
 
+	// slot tracks each field's position in a decoded dat.Batch, which has
+	// one column per field and two per interval.
+	nextSlot := 0
 	for i := range schema.Columns {
 		column := &schema.Columns[i]
+		slot := nextSlot
+		nextSlot++
+		if column.Interval && !column.Array {
+			nextSlot++
+		}
 		field := dat.FieldName(column, i)
 		sqlName := poe.ToSnakeCase(field)
 		if err := validateIdentifier(sqlName); err != nil {
@@ -98,8 +135,12 @@ func newTablePlan(schema *dat.TableSchema) (*TablePlan, error) {
 				tableName: junctionName,
 				sqlName:   sqlName,
 				field:     field,
+				slot:      slot,
 				refTable:  refTable,
 				refColumn: refColumn,
+				refEnum:   column.Type == dat.TypeEnumRow,
+				column:    column,
+				position:  i,
 			})
 			continue
 		}
@@ -113,25 +154,29 @@ func newTablePlan(schema *dat.TableSchema) (*TablePlan, error) {
 				return nil, fmt.Errorf("table %s column %d (%s): %w", schema.Name, i, sqlName, err)
 			}
 			minField, maxField := dat.IntervalFieldNames(column, i)
-			for _, f := range []string{minField, maxField} {
+			for j, f := range []string{minField, maxField} {
 				intervalName := poe.ToSnakeCase(f)
 				if err := validateIdentifier(intervalName); err != nil {
 					return nil, fmt.Errorf("table %s column %d: %w", schema.Name, i, err)
 				}
 				plan.columns = append(plan.columns, planColumn{
-					sqlName: intervalName,
-					field:   f,
-					sqlType: sqlType,
-					column:  column,
+					sqlName:  intervalName,
+					field:    f,
+					slot:     slot + j,
+					sqlType:  sqlType,
+					column:   column,
+					position: i,
 				})
 			}
 			continue
 		}
 
 		col := planColumn{
-			sqlName: sqlName,
-			field:   field,
-			column:  column,
+			sqlName:  sqlName,
+			field:    field,
+			slot:     slot,
+			column:   column,
+			position: i,
 		}
 
 		if column.Array {
@@ -148,6 +193,7 @@ func newTablePlan(schema *dat.TableSchema) (*TablePlan, error) {
 				if err != nil {
 					return nil, fmt.Errorf("table %s column %d (%s): %w", schema.Name, i, sqlName, err)
 				}
+				col.refEnum = column.Type == dat.TypeEnumRow
 			}
 		}
 
@@ -159,6 +205,91 @@ func newTablePlan(schema *dat.TableSchema) (*TablePlan, error) {
 	return plan, nil
 }
 
+// Field is one schema column of a plan as single-file writers lay it out:
+// named like the SQLite column, with arrays kept on the row, including those
+// SQLite moves into junction tables.
+type Field struct {
+	Name string
+	Slot int // the field's column in a dat.Batch
+
+	// SQLType is the column's type, or for arrays the type of each element.
+	SQLType string
+	Array   bool
+
+	// RefTable and RefColumn name the referenced column of a foreign key,
+	// scalar or array.
+	RefTable  string
+	RefColumn string
+}
+
+// Fields lists the plan's schema columns in schema order.
+func (p *TablePlan) Fields() []Field {
+	fields := make([]Field, 0, len(p.columns)+len(p.junctions))
+	for _, col := range p.columns {
+		f := Field{
+			Name:      col.sqlName,
+			Slot:      col.slot,
+			SQLType:   col.sqlType,
+			Array:     col.column.Array,
+			RefTable:  col.refTable,
+			RefColumn: col.refColumn,
+		}
+		if f.Array {
+			f.SQLType, _ = mapDATTypeToSQL(col.column.Type)
+		}
+		fields = append(fields, f)
+	}
+	for _, junction := range p.junctions {
+		sqlType, _ := mapDATTypeToSQL(junction.column.Type)
+		fields = append(fields, Field{
+			Name:      junction.sqlName,
+			Slot:      junction.slot,
+			SQLType:   sqlType,
+			Array:     true,
+			RefTable:  junction.refTable,
+			RefColumn: junction.refColumn,
+		})
+	}
+	slices.SortFunc(fields, func(a, b Field) int { return a.Slot - b.Slot })
+	return fields
+}
+
+// tableNames lists the plan's main table followed by its junction tables.
+func (p *TablePlan) tableNames() []string {
+	names := []string{p.sqlName}
+	for _, junction := range p.junctions {
+		names = append(names, junction.tableName)
+	}
+	return names
+}
+
+// scopeColumns are the key columns every row and reference is scoped by:
+// the language, and in multi-patch databases the patch before it.
+func (p *TablePlan) scopeColumns() []string {
+	if p.patched {
+		return []string{colPatch, colLanguage}
+	}
+	return []string{colLanguage}
+}
+
+// refScope returns the key columns a reference is scoped by: scopeColumns,
+// except that enumeration lookup tables are not per language.
+func (p *TablePlan) refScope(enum bool) []string {
+	if !enum {
+		return p.scopeColumns()
+	}
+	if p.patched {
+		return []string{colPatch}
+	}
+	return nil
+}
+
+// keyList appends column, already quoted as needed, to scope as a key
+// column list.
+func keyList(scope []string, column string) string {
+	return strings.Join(append(slices.Clone(scope), column), ", ")
+}
+
 func referenceTarget(ref *dat.ColumnReference) (table, column string, err error) {
 	if ref == nil {
 		return "", "", fmt.Errorf("nil reference")
@@ -0,0 +1,210 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// postgresBackend loads into a PostgreSQL database over a postgres:// URL.
+// Tables are created in the first schema of the URL's search_path
+// parameter, created if missing, or the server's default schema otherwise.
+//
+// PostgreSQL cannot switch foreign-key enforcement off for a session, so no
+// FOREIGN KEY clauses are declared; CheckForeignKeys finds violations with
+// anti-joins derived from the plans instead.
+type postgresBackend struct{}
+
+func (postgresBackend) Name() string { return "postgres" }
+
+func (postgresBackend) Open(target string, options *DatabaseOptions) (*sql.DB, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("parsing database URL %s: %w", Redacted(target), err)
+	}
+
+	db, err := sql.Open("postgres", target)
+	if err != nil {
+		return nil, fmt.Errorf("opening database %s: %w", u.Redacted(), err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("testing database connection: %w", err)
+	}
+
+	schema, _, _ := strings.Cut(u.Query().Get("search_path"), ",")
+	if schema = strings.TrimSpace(schema); schema != "" {
+		if _, err := db.Exec("CREATE SCHEMA IF NOT EXISTS " + quoteSQLIdentifier(schema)); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("creating schema %s: %w", schema, err)
+		}
+	}
+
+	return db, nil
+}
+
+// Rebind numbers placeholders $1, $2, ... Queries passed here never contain
+// a literal question mark.
+func (postgresBackend) Rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	for i := 0; i < len(query); i++ {
+		if query[i] != '?' {
+			b.WriteByte(query[i])
+			continue
+		}
+		n++
+		b.WriteByte('$')
+		b.WriteString(strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+// ColumnType widens integers to BIGINT: dat files hold unsigned 32-bit and
+// 64-bit values that overflow PostgreSQL's INTEGER.
+func (postgresBackend) ColumnType(sqlType string) string {
+	switch sqlType {
+	case "INTEGER":
+		return "BIGINT"
+	case "REAL":
+		return "DOUBLE PRECISION"
+	}
+	return sqlType
+}
+
+func (postgresBackend) DeclaresForeignKeys() bool { return false }
+
+func (postgresBackend) JSONArray(value, from, order string) string {
+	return fmt.Sprintf("SELECT COALESCE(json_agg(%s ORDER BY %s), '[]'::json)%s", value, order, from)
+}
+
+// DropTable cascades: PostgreSQL refuses to drop a table other tables'
+// _resolved views select from. Those views are recreated by the next
+// CreateViews.
+func (postgresBackend) DropTable(table string) string {
+	return "DROP TABLE IF EXISTS " + quoteSQLIdentifier(table) + " CASCADE"
+}
+
+func (postgresBackend) TableNames(ctx context.Context, db *sql.DB) ([]string, error) {
+	return queryNames(ctx, db, "SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() AND table_type = 'BASE TABLE'")
+}
+
+// BulkInsert loads rows with COPY FROM STDIN. Rows are streamed to the
+// server as they are written and the load completes on Close.
+func (postgresBackend) BulkInsert(ctx context.Context, tx *sql.Tx, table string, columns []string) (BulkWriter, error) {
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(table, columns...))
+	if err != nil {
+		return nil, err
+	}
+	return &copyWriter{stmt: stmt}, nil
+}
+
+// ConcurrentBulkInserts is false: a connection runs one COPY at a time.
+func (postgresBackend) ConcurrentBulkInserts() bool { return false }
+
+type copyWriter struct {
+	stmt   *sql.Stmt
+	closed bool
+}
+
+func (w *copyWriter) Write(ctx context.Context, values []any) error {
+	_, err := w.stmt.ExecContext(ctx, values...)
+	return err
+}
+
+func (w *copyWriter) Close(ctx context.Context) error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	// An Exec without arguments ends the COPY and reports any error from
+	// the rows before it.
+	_, err := w.stmt.ExecContext(ctx)
+	if closeErr := w.stmt.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (postgresBackend) CheckForeignKeys(ctx context.Context, db *sql.DB, plans []*TablePlan, existing map[string]bool) ([]ForeignKeyViolation, error) {
+	var violations []ForeignKeyViolation
+	for _, plan := range plans {
+		for _, check := range plan.foreignKeyChecks() {
+			if !existing[check.table] || !existing[check.parent] {
+				continue
+			}
+			rowIDs, err := queryRowIDs(ctx, db, check.query)
+			if err != nil {
+				return nil, fmt.Errorf("checking references from %s to %s: %w", check.table, check.parent, err)
+			}
+			for _, id := range rowIDs {
+				violations = append(violations, ForeignKeyViolation{Table: check.table, RowID: id, Parent: check.parent})
+			}
+		}
+	}
+	return violations, nil
+}
+
+// foreignKeyCheck is a query selecting the rows of table whose reference
+// into parent has no target row. The row ID is the row's _index, or for a
+// junction row its parent's.
+type foreignKeyCheck struct {
+	table  string
+	parent string
+	query  string
+}
+
+// foreignKeyChecks mirrors the FOREIGN KEY clauses generateTableDDL and
+// generateJunctionTableDDL declare, minus the junction-to-parent key, which
+// inserts satisfy by construction.
+func (p *TablePlan) foreignKeyChecks() []foreignKeyCheck {
+	check := func(table, rowID, column, parent, parentColumn string, enum bool) foreignKeyCheck {
+		conditions := []string{fmt.Sprintf("p.%s = c.%s", quoteSQLIdentifier(parentColumn), quoteSQLIdentifier(column))}
+		for _, scope := range p.refScope(enum) {
+			conditions = append(conditions, fmt.Sprintf("p.%[1]s = c.%[1]s", scope))
+		}
+		return foreignKeyCheck{
+			table:  table,
+			parent: parent,
+			query: fmt.Sprintf("SELECT c.%s FROM %s c WHERE c.%s IS NOT NULL AND NOT EXISTS (SELECT 1 FROM %s p WHERE %s)",
+				rowID, quoteSQLIdentifier(table), quoteSQLIdentifier(column),
+				quoteSQLIdentifier(parent), strings.Join(conditions, " AND ")),
+		}
+	}
+
+	var checks []foreignKeyCheck
+	for _, col := range p.columns {
+		if col.refTable != "" {
+			checks = append(checks, check(p.sqlName, colIndex, col.sqlName, col.refTable, col.refColumn, col.refEnum))
+		}
+	}
+	for _, junction := range p.junctions {
+		checks = append(checks, check(junction.tableName, colParentIndex, colValue, junction.refTable, junction.refColumn, junction.refEnum))
+	}
+	return checks
+}
+
+func queryRowIDs(ctx context.Context, db *sql.DB, query string) ([]int64, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"regexp"
 	"strings"
@@ -9,24 +10,34 @@ import (
 
 type SchemaProgressCallback func(current int, total int, description string)
 
-func generateTableDDL(plan *TablePlan) string {
-	columns := []string{
-		colIndex + " INTEGER",
-		colLanguage + " TEXT NOT NULL",
+// generateTableDDL creates a plan's main table with the backend's column
+// types. Keys are scoped by language, and patch in multi-patch plans.
+func generateTableDDL(plan *TablePlan, backend Backend) string {
+	integer, text := backend.ColumnType("INTEGER"), backend.ColumnType("TEXT")
+
+	var columns []string
+	if plan.patched {
+		columns = append(columns, colPatch+" "+text+" NOT NULL")
 	}
+	columns = append(columns,
+		colIndex+" "+integer,
+		colLanguage+" "+text+" NOT NULL",
+	)
 	var foreignKeys []string
+	scope := strings.Join(plan.scopeColumns(), ", ")
 
 	for _, col := range plan.columns {
-		columns = append(columns, fmt.Sprintf("%s %s", quoteSQLIdentifier(col.sqlName), col.sqlType))
+		columns = append(columns, fmt.Sprintf("%s %s", quoteSQLIdentifier(col.sqlName), backend.ColumnType(col.sqlType)))
 
-		if col.refTable != "" {
-			foreignKeys = append(foreignKeys, fmt.Sprintf("FOREIGN KEY (%s, %s) REFERENCES %s(%s, %s)",
-				colLanguage, quoteSQLIdentifier(col.sqlName),
-				quoteSQLIdentifier(col.refTable), colLanguage, quoteSQLIdentifier(col.refColumn)))
+		if col.refTable != "" && backend.DeclaresForeignKeys() {
+			refScope := plan.refScope(col.refEnum)
+			foreignKeys = append(foreignKeys, fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s(%s)",
+				keyList(refScope, quoteSQLIdentifier(col.sqlName)),
+				quoteSQLIdentifier(col.refTable), keyList(refScope, quoteSQLIdentifier(col.refColumn))))
 		}
 	}
 
-	columns = append(columns, fmt.Sprintf("PRIMARY KEY (%s, %s)", colLanguage, colIndex))
+	columns = append(columns, fmt.Sprintf("PRIMARY KEY (%s, %s)", scope, colIndex))
 	columns = append(columns, foreignKeys...)
 
 	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n    %s\n)",
@@ -34,22 +45,33 @@ func generateTableDDL(plan *TablePlan) string {
 		strings.Join(columns, ",\n    "))
 }
 
-func generateJunctionTableDDL(plan *TablePlan, junction *planJunction) string {
-	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[1]s (
-    %[2]s TEXT NOT NULL,
-    %[3]s INTEGER NOT NULL,
-    %[4]s INTEGER NOT NULL,
-    %[5]s INTEGER,
-    FOREIGN KEY (%[2]s, %[3]s)
-      REFERENCES %[6]s(%[2]s, %[7]s),
-    FOREIGN KEY (%[2]s, %[5]s)
-      REFERENCES %[8]s(%[2]s, %[9]s),
-    UNIQUE(%[2]s, %[3]s, %[4]s)
-)`,
+func generateJunctionTableDDL(plan *TablePlan, junction *planJunction, backend Backend) string {
+	integer, text := backend.ColumnType("INTEGER"), backend.ColumnType("TEXT")
+	scope := strings.Join(plan.scopeColumns(), ", ")
+	refScope := plan.refScope(junction.refEnum)
+
+	var columns []string
+	if plan.patched {
+		columns = append(columns, colPatch+" "+text+" NOT NULL")
+	}
+	columns = append(columns,
+		colLanguage+" "+text+" NOT NULL",
+		colParentIndex+" "+integer+" NOT NULL",
+		colArrayIndex+" "+integer+" NOT NULL",
+		colValue+" "+integer,
+	)
+	if backend.DeclaresForeignKeys() {
+		columns = append(columns,
+			fmt.Sprintf("FOREIGN KEY (%[1]s, %[2]s)\n      REFERENCES %[3]s(%[1]s, %[4]s)",
+				scope, colParentIndex, quoteSQLIdentifier(plan.sqlName), colIndex),
+			fmt.Sprintf("FOREIGN KEY (%s)\n      REFERENCES %s(%s)",
+				keyList(refScope, colValue), quoteSQLIdentifier(junction.refTable), keyList(refScope, quoteSQLIdentifier(junction.refColumn))))
+	}
+	columns = append(columns, fmt.Sprintf("UNIQUE(%s, %s, %s)", scope, colParentIndex, colArrayIndex))
+
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n    %s\n)",
 		quoteSQLIdentifier(junction.tableName),
-		colLanguage, colParentIndex, colArrayIndex, colValue,
-		quoteSQLIdentifier(plan.sqlName), colIndex,
-		quoteSQLIdentifier(junction.refTable), quoteSQLIdentifier(junction.refColumn))
+		strings.Join(columns, ",\n    "))
 }
 
 type DDLRequest struct {
@@ -59,34 +81,42 @@ type DDLRequest struct {
 }
 
 // CreateSchemas creates every table's DDL in one transaction and returns the
-// number of tables created (main plus junction). Foreign keys are never
-// enforced during load (see DatabaseOptions), so junction tables need not be
-// ordered after their parents.
+// number of tables created (main plus junction). Each main table is recorded
+// in the catalog in the same transaction. Foreign keys are never enforced
+// during load (see DatabaseOptions), so junction tables need not be ordered
+// after their parents.
 func CreateSchemas(ctx context.Context, db *Database, plans []*TablePlan, progressCallback SchemaProgressCallback) (int, error) {
 	if len(plans) == 0 {
 		return 0, nil
 	}
 
-	requests := generateAllDDL(plans)
-	if err := executeDDL(ctx, db, requests, progressCallback); err != nil {
+	requests := generateAllDDL(plans, db.backend)
+	if err := executeDDL(ctx, db, requests, progressCallback, func(tx *sql.Tx) error {
+		for _, plan := range plans {
+			if err := recordTable(ctx, db, tx, plan); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
 		return 0, fmt.Errorf("executing DDL: %w", err)
 	}
 
 	return len(requests), nil
 }
 
-func generateAllDDL(plans []*TablePlan) []DDLRequest {
+func generateAllDDL(plans []*TablePlan, backend Backend) []DDLRequest {
 	var requests []DDLRequest
 	for _, plan := range plans {
 		requests = append(requests, DDLRequest{
-			DDL:         generateTableDDL(plan),
+			DDL:         generateTableDDL(plan, backend),
 			TableName:   plan.sqlName,
 			Description: plan.schemaName,
 		})
 		for i := range plan.junctions {
 			junction := &plan.junctions[i]
 			requests = append(requests, DDLRequest{
-				DDL:         generateJunctionTableDDL(plan, junction),
+				DDL:         generateJunctionTableDDL(plan, junction, backend),
 				TableName:   junction.tableName,
 				Description: fmt.Sprintf("%s.%s", plan.schemaName, junction.field),
 			})
@@ -95,7 +125,7 @@ func generateAllDDL(plans []*TablePlan) []DDLRequest {
 	return requests
 }
 
-func executeDDL(ctx context.Context, db *Database, requests []DDLRequest, progressCallback SchemaProgressCallback) error {
+func executeDDL(ctx context.Context, db *Database, requests []DDLRequest, progressCallback SchemaProgressCallback, record func(*sql.Tx) error) error {
 	if len(requests) == 0 {
 		return nil
 	}
@@ -115,6 +145,10 @@ func executeDDL(ctx context.Context, db *Database, requests []DDLRequest, progre
 		}
 	}
 
+	if err := record(tx); err != nil {
+		return err
+	}
+
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("committing DDL transaction: %w", err)
 	}
@@ -0,0 +1,188 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteBackend loads into a SQLite file. Foreign keys are declared but the
+// connection runs with enforcement off.
+type sqliteBackend struct{}
+
+func (sqliteBackend) Name() string { return "sqlite" }
+
+func (sqliteBackend) Open(target string, options *DatabaseOptions) (*sql.DB, error) {
+	if err := ensureDirectory(target); err != nil {
+		return nil, fmt.Errorf("creating database directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", buildConnectionString(target, options))
+	if err != nil {
+		return nil, fmt.Errorf("opening database %s: %w", target, err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("testing database connection: %w", err)
+	}
+
+	// These pragmas are not DSN parameters in mattn/go-sqlite3, so they must
+	// be executed explicitly.
+	for _, pragma := range []string{
+		"PRAGMA temp_store = MEMORY",
+		"PRAGMA mmap_size = 268435456", // 256MB
+	} {
+		if _, err := db.Exec(pragma); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("applying %s: %w", pragma, err)
+		}
+	}
+
+	// Verify the DSN pragmas actually took effect; a silently ignored
+	// parameter (the bug this guards against) is a misconfiguration, not a
+	// degraded mode.
+	if options.WALMode {
+		var mode string
+		if err := db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil || !strings.EqualFold(mode, "wal") {
+			db.Close()
+			return nil, fmt.Errorf("WAL mode requested but journal_mode is %q (err: %v)", mode, err)
+		}
+	}
+
+	return db, nil
+}
+
+func (sqliteBackend) Rebind(query string) string { return query }
+
+func (sqliteBackend) ColumnType(sqlType string) string { return sqlType }
+
+func (sqliteBackend) DeclaresForeignKeys() bool { return true }
+
+// JSONArray orders the rows in a subquery: json_group_array only accepts
+// ORDER BY from SQLite 3.44, and views must open in older clients too.
+func (sqliteBackend) JSONArray(value, from, order string) string {
+	return fmt.Sprintf("SELECT json_group_array(v) FROM (SELECT %s AS v%s ORDER BY %s)", value, from, order)
+}
+
+func (sqliteBackend) DropTable(table string) string {
+	return "DROP TABLE IF EXISTS " + quoteSQLIdentifier(table)
+}
+
+func (sqliteBackend) TableNames(ctx context.Context, db *sql.DB) ([]string, error) {
+	return queryNames(ctx, db, "SELECT name FROM sqlite_master WHERE type='table'")
+}
+
+func (sqliteBackend) BulkInsert(ctx context.Context, tx *sql.Tx, table string, columns []string) (BulkWriter, error) {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = quoteSQLIdentifier(column)
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		quoteSQLIdentifier(table),
+		strings.Join(quoted, ", "),
+		strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "))
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteWriter{stmt: stmt}, nil
+}
+
+// ConcurrentBulkInserts is true: each loader is a prepared statement, and
+// statements on one transaction may be interleaved.
+func (sqliteBackend) ConcurrentBulkInserts() bool { return true }
+
+// sqliteWriter inserts each row with a prepared statement; inside one
+// transaction that is as fast as SQLite loads.
+type sqliteWriter struct {
+	stmt *sql.Stmt
+}
+
+func (w *sqliteWriter) Write(ctx context.Context, values []any) error {
+	_, err := w.stmt.ExecContext(ctx, values...)
+	return err
+}
+
+func (w *sqliteWriter) Close(ctx context.Context) error {
+	return w.stmt.Close()
+}
+
+// CheckForeignKeys runs PRAGMA foreign_key_check over each table, which
+// checks the declared FOREIGN KEY clauses.
+func (sqliteBackend) CheckForeignKeys(ctx context.Context, db *sql.DB, plans []*TablePlan, existing map[string]bool) ([]ForeignKeyViolation, error) {
+	var violations []ForeignKeyViolation
+	for _, plan := range plans {
+		for _, table := range plan.tableNames() {
+			if !existing[table] {
+				continue
+			}
+			found, err := sqliteForeignKeyCheck(ctx, db, table, existing)
+			if err != nil {
+				return nil, err
+			}
+			violations = append(violations, found...)
+		}
+	}
+	return violations, nil
+}
+
+func sqliteForeignKeyCheck(ctx context.Context, db *sql.DB, table string, existing map[string]bool) ([]ForeignKeyViolation, error) {
+	rows, err := db.QueryContext(ctx, "PRAGMA foreign_key_check("+quoteSQLIdentifier(table)+")")
+	if err != nil {
+		return nil, fmt.Errorf("running foreign_key_check on %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var violations []ForeignKeyViolation
+	for rows.Next() {
+		var v ForeignKeyViolation
+		var rowid sql.NullInt64
+		var fkid int64
+		if err := rows.Scan(&v.Table, &rowid, &v.Parent, &fkid); err != nil {
+			return nil, fmt.Errorf("scanning foreign_key_check row: %w", err)
+		}
+		if !existing[v.Parent] {
+			continue
+		}
+		v.RowID = rowid.Int64
+		violations = append(violations, v)
+	}
+	return violations, rows.Err()
+}
+
+// buildConnectionString constructs the SQLite DSN. mattn/go-sqlite3 only
+// recognizes underscore-prefixed parameters; anything else is silently
+// dropped by the driver.
+func buildConnectionString(path string, options *DatabaseOptions) string {
+	params := []string{
+		"_foreign_keys=off", // FK clauses are documentation; see DatabaseOptions
+		"_synchronous=NORMAL",
+		"_cache_size=10000",
+	}
+
+	if options.WALMode {
+		params = append(params, "_journal_mode=WAL")
+	}
+
+	if options.BusyTimeout > 0 {
+		params = append(params, fmt.Sprintf("_busy_timeout=%d", int(options.BusyTimeout.Milliseconds())))
+	}
+
+	return path + "?" + strings.Join(params, "&")
+}
+
+func ensureDirectory(dbPath string) error {
+	dir := filepath.Dir(dbPath)
+	if dir == "." || dir == "" {
+		return nil // Current directory, no need to create
+	}
+
+	return os.MkdirAll(dir, 0755)
+}
@@ -0,0 +1,187 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// viewSuffix names the view CreateViews adds over each table.
+const viewSuffix = "_resolved"
+
+// labelColumns are the referenced-table columns a view pulls in for each
+// reference, in output order, when the referenced table has them.
+var labelColumns = []string{"id", "name"}
+
+// ViewName returns the name of the view CreateViews creates for a table.
+func ViewName(table string) string {
+	return table + viewSuffix
+}
+
+// CreateViews replaces the <table>_resolved view of every plan. A view
+// selects all of the table's columns and adds, for each scalar foreign key,
+// the referenced row's Id and Name as <column>_id and <column>_name through
+// a LEFT JOIN, or for an enumeration its value as <column>_value. Each
+// junction array becomes a JSON array of the referenced indices under the
+// field's name, plus JSON arrays of the same labels, in array order.
+//
+// plans also serve as the lookup for referenced tables: references into a
+// table that is not among plans, not in the database, or scoped differently
+// by _patch stay unresolved. Views are derived data, so callers recreate
+// them after each load.
+func CreateViews(ctx context.Context, db *Database, plans []*TablePlan) (int, error) {
+	if len(plans) == 0 {
+		return 0, nil
+	}
+
+	tables, err := db.UserTables(ctx)
+	if err != nil {
+		return 0, err
+	}
+	lookup := make(map[string]*TablePlan, len(plans))
+	for _, plan := range plans {
+		if tables[plan.sqlName] {
+			lookup[plan.sqlName] = plan
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("beginning view transaction: %w", err)
+	}
+	defer tx.Rollback() // Safe to call even after commit
+
+	created := 0
+	for _, plan := range plans {
+		if lookup[plan.sqlName] == nil {
+			continue
+		}
+		name := quoteSQLIdentifier(ViewName(plan.sqlName))
+		if _, err := tx.ExecContext(ctx, "DROP VIEW IF EXISTS "+name); err != nil {
+			return 0, fmt.Errorf("dropping view %s: %w", ViewName(plan.sqlName), err)
+		}
+		if _, err := tx.ExecContext(ctx, generateViewDDL(plan, lookup, tables, db.backend)); err != nil {
+			return 0, fmt.Errorf("creating view %s: %w", ViewName(plan.sqlName), err)
+		}
+		created++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("committing view transaction: %w", err)
+	}
+	return created, nil
+}
+
+// generateViewDDL builds a plan's view. The table is aliased t, and the
+// table behind its n-th scalar reference r<n>.
+func generateViewDDL(plan *TablePlan, lookup map[string]*TablePlan, existing map[string]bool, backend Backend) string {
+	taken := map[string]bool{colIndex: true, colLanguage: true, colPatch: true}
+	for _, col := range plan.columns {
+		taken[col.sqlName] = true
+	}
+	// alias reserves an output column name, refusing names the table or an
+	// earlier reference already uses.
+	alias := func(name string) (string, bool) {
+		if taken[name] {
+			return "", false
+		}
+		taken[name] = true
+		return quoteSQLIdentifier(name), true
+	}
+
+	scope := plan.scopeColumns()
+	joinOn := func(ref, refColumn, from, column string, enum bool) string {
+		conditions := []string{fmt.Sprintf("%s.%s = %s.%s", ref, quoteSQLIdentifier(refColumn), from, quoteSQLIdentifier(column))}
+		for _, s := range plan.refScope(enum) {
+			conditions = append(conditions, fmt.Sprintf("%[1]s.%[3]s = %[2]s.%[3]s", ref, from, s))
+		}
+		return strings.Join(conditions, " AND ")
+	}
+
+	selects := []string{"t.*"}
+	var joins []string
+	for _, col := range plan.columns {
+		if col.refTable == "" {
+			continue
+		}
+		labels, ok := plan.targetLabels(col.refTable, col.refEnum, lookup, existing)
+		if !ok {
+			continue
+		}
+		ref := fmt.Sprintf("r%d", len(joins)+1)
+		var columns []string
+		for _, label := range labels {
+			if name, ok := alias(col.sqlName + "_" + label); ok {
+				columns = append(columns, fmt.Sprintf("%s.%s AS %s", ref, quoteSQLIdentifier(label), name))
+			}
+		}
+		if len(columns) == 0 {
+			continue
+		}
+		selects = append(selects, columns...)
+		joins = append(joins, fmt.Sprintf("LEFT JOIN %s %s ON %s",
+			quoteSQLIdentifier(col.refTable), ref, joinOn(ref, col.refColumn, "t", col.sqlName, col.refEnum)))
+	}
+
+	for _, junction := range plan.junctions {
+		parent := []string{fmt.Sprintf("j.%s = t.%s", colParentIndex, colIndex)}
+		for _, s := range scope {
+			parent = append(parent, fmt.Sprintf("j.%[1]s = t.%[1]s", s))
+		}
+		where := " WHERE " + strings.Join(parent, " AND ")
+		order := "j." + colArrayIndex
+
+		from := " FROM " + quoteSQLIdentifier(junction.tableName) + " j"
+		if name, ok := alias(junction.sqlName); ok {
+			selects = append(selects, fmt.Sprintf("(%s) AS %s", backend.JSONArray("j."+colValue, from+where, order), name))
+		}
+
+		labels, ok := plan.targetLabels(junction.refTable, junction.refEnum, lookup, existing)
+		if !ok {
+			continue
+		}
+		from += fmt.Sprintf(" LEFT JOIN %s r ON %s", quoteSQLIdentifier(junction.refTable), joinOn("r", junction.refColumn, "j", colValue, junction.refEnum))
+		for _, label := range labels {
+			if name, ok := alias(junction.sqlName + "_" + label); ok {
+				selects = append(selects, fmt.Sprintf("(%s) AS %s", backend.JSONArray("r."+quoteSQLIdentifier(label), from+where, order), name))
+			}
+		}
+	}
+
+	ddl := fmt.Sprintf("CREATE VIEW %s AS\nSELECT\n    %s\nFROM %s t",
+		quoteSQLIdentifier(ViewName(plan.sqlName)), strings.Join(selects, ",\n    "), quoteSQLIdentifier(plan.sqlName))
+	for _, join := range joins {
+		ddl += "\n" + join
+	}
+	return ddl
+}
+
+// targetLabels returns the label columns a reference into table can pull
+// in, and whether the view joins it at all. An enumeration's label is its
+// value; a table's are its labelColumns, provided its rows are scoped like
+// the plan's.
+func (p *TablePlan) targetLabels(table string, enum bool, lookup map[string]*TablePlan, existing map[string]bool) ([]string, bool) {
+	if enum {
+		return []string{colValue}, existing[table]
+	}
+	target := lookup[table]
+	if target == nil || target.patched != p.patched {
+		return nil, false
+	}
+	return target.labelColumns(), true
+}
+
+// labelColumns returns which of labelColumns the plan's table has as text
+// columns.
+func (p *TablePlan) labelColumns() []string {
+	var labels []string
+	for _, label := range labelColumns {
+		for _, col := range p.columns {
+			if col.sqlName == label && col.sqlType == "TEXT" {
+				labels = append(labels, label)
+				break
+			}
+		}
+	}
+	return labels
+}
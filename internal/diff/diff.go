@@ -0,0 +1,191 @@
+// Package diff compares two decodings of the same dat table and reports which
+// rows were added, removed or changed, column by column.
+package diff
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/jchantrell/exiledb/internal/dat"
+)
+
+// Change is one column whose value differs between the two versions.
+type Change struct {
+	Column string `json:"column"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+// Row identifies a row present in only one version, with its values.
+type Row struct {
+	Key    string         `json:"key"`
+	Index  int            `json:"index"`
+	Fields map[string]any `json:"fields"`
+}
+
+// RowChange is a row present in both versions whose values differ.
+type RowChange struct {
+	Key         string   `json:"key"`
+	BeforeIndex int      `json:"before_index"`
+	AfterIndex  int      `json:"after_index"`
+	Changes     []Change `json:"changes"`
+}
+
+// TableDiff is the row-level difference of one table in one language. Rows
+// are matched on KeyColumn when the table has a usable one, otherwise on
+// their row index (KeyColumn is then empty).
+type TableDiff struct {
+	Table     string      `json:"table"`
+	Language  string      `json:"language"`
+	KeyColumn string      `json:"key_column,omitempty"`
+	Added     []Row       `json:"added"`
+	Removed   []Row       `json:"removed"`
+	Changed   []RowChange `json:"changed"`
+}
+
+// Empty reports whether the two versions were identical.
+func (d *TableDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Compare diffs two parsed versions of the table described by schema. Either
+// side may be nil when the table does not exist in that version.
+func Compare(schema *dat.TableSchema, language string, before, after []dat.ParsedRow) *TableDiff {
+	columns := dat.FieldNames(schema)
+	keyColumn := keyColumn(schema, before, after)
+
+	d := &TableDiff{
+		Table:     schema.Name,
+		Language:  language,
+		KeyColumn: keyColumn,
+		Added:     []Row{},
+		Removed:   []Row{},
+		Changed:   []RowChange{},
+	}
+
+	beforeByKey := make(map[string]*dat.ParsedRow, len(before))
+	for i := range before {
+		beforeByKey[rowKey(&before[i], keyColumn)] = &before[i]
+	}
+	afterKeys := make(map[string]bool, len(after))
+
+	for i := range after {
+		row := &after[i]
+		key := rowKey(row, keyColumn)
+		afterKeys[key] = true
+
+		old, ok := beforeByKey[key]
+		if !ok {
+			d.Added = append(d.Added, newRow(key, row, columns))
+			continue
+		}
+
+		var changes []Change
+		for _, column := range columns {
+			b, a := Normalize(old.Fields[column]), Normalize(row.Fields[column])
+			if !reflect.DeepEqual(b, a) {
+				changes = append(changes, Change{Column: column, Before: b, After: a})
+			}
+		}
+		if len(changes) > 0 {
+			d.Changed = append(d.Changed, RowChange{
+				Key:         key,
+				BeforeIndex: old.Index,
+				AfterIndex:  row.Index,
+				Changes:     changes,
+			})
+		}
+	}
+
+	for i := range before {
+		key := rowKey(&before[i], keyColumn)
+		if !afterKeys[key] {
+			d.Removed = append(d.Removed, newRow(key, &before[i], columns))
+		}
+	}
+
+	return d
+}
+
+// Normalize turns parser values into plain comparable, JSON-friendly values:
+// row references arrive as pointers (nil for the null sentinel), including
+// inside arrays.
+func Normalize(value any) any {
+	if value == nil {
+		return nil
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return nil
+		}
+		return rv.Elem().Interface()
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() != reflect.Pointer {
+			return value
+		}
+		out := make([]any, rv.Len())
+		for i := range out {
+			out[i] = Normalize(rv.Index(i).Interface())
+		}
+		return out
+	}
+	return value
+}
+
+// keyColumn picks the column rows are matched on: Id when present, else the
+// first unique string column. A candidate whose values repeat or are empty
+// in either version cannot identify rows and is rejected, falling back to
+// row indices.
+func keyColumn(schema *dat.TableSchema, versions ...[]dat.ParsedRow) string {
+	var candidates []string
+	for i := range schema.Columns {
+		column := &schema.Columns[i]
+		if column.Array || column.Type != dat.TypeString || column.Name == nil {
+			continue
+		}
+		if *column.Name == "Id" {
+			candidates = append([]string{*column.Name}, candidates...)
+		} else if column.Unique {
+			candidates = append(candidates, *column.Name)
+		}
+	}
+
+	for _, candidate := range candidates {
+		if uniqueValues(candidate, versions) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+func uniqueValues(column string, versions [][]dat.ParsedRow) bool {
+	for _, rows := range versions {
+		seen := make(map[string]bool, len(rows))
+		for i := range rows {
+			value, ok := rows[i].Fields[column].(string)
+			if !ok || value == "" || seen[value] {
+				return false
+			}
+			seen[value] = true
+		}
+	}
+	return true
+}
+
+func rowKey(row *dat.ParsedRow, keyColumn string) string {
+	if keyColumn == "" {
+		return "#" + strconv.Itoa(row.Index)
+	}
+	return fmt.Sprint(row.Fields[keyColumn])
+}
+
+func newRow(key string, row *dat.ParsedRow, columns []string) Row {
+	fields := make(map[string]any, len(columns))
+	for _, column := range columns {
+		fields[column] = Normalize(row.Fields[column])
+	}
+	return Row{Key: key, Index: row.Index, Fields: fields}
+}
@@ -0,0 +1,85 @@
+package diff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jchantrell/exiledb/internal/dat"
+)
+
+func TestCompare(t *testing.T) {
+	name := func(s string) *string { return &s }
+	schema := &dat.TableSchema{
+		Name: "Mods",
+		Columns: []dat.TableColumn{
+			{Name: name("Id"), Type: dat.TypeString, Unique: true},
+			{Name: name("Level"), Type: dat.TypeInt32},
+			{Name: name("Stat"), Type: dat.TypeForeignRow},
+		},
+	}
+	row := func(index int, id string, level int32, stat *uint32) dat.ParsedRow {
+		return dat.ParsedRow{Index: index, Fields: map[string]any{"Id": id, "Level": level, "Stat": stat}}
+	}
+
+	stat := uint32(4)
+	before := []dat.ParsedRow{
+		row(0, "Kept", 1, &stat),
+		row(1, "Gone", 2, nil),
+		row(2, "Moved", 3, nil),
+	}
+	after := []dat.ParsedRow{
+		row(0, "Moved", 3, nil),
+		row(1, "Kept", 5, nil),
+		row(2, "New", 1, nil),
+	}
+
+	d := Compare(schema, "English", before, after)
+	if d.KeyColumn != "Id" {
+		t.Fatalf("KeyColumn = %q, want Id", d.KeyColumn)
+	}
+	if len(d.Added) != 1 || d.Added[0].Key != "New" {
+		t.Errorf("Added = %+v, want [New]", d.Added)
+	}
+	if len(d.Removed) != 1 || d.Removed[0].Key != "Gone" {
+		t.Errorf("Removed = %+v, want [Gone]", d.Removed)
+	}
+	if len(d.Changed) != 1 || d.Changed[0].Key != "Kept" {
+		t.Fatalf("Changed = %+v, want [Kept]", d.Changed)
+	}
+	want := []Change{
+		{Column: "Level", Before: int32(1), After: int32(5)},
+		{Column: "Stat", Before: uint32(4), After: nil},
+	}
+	if got := d.Changed[0].Changes; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Changes = %+v, want %+v", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, "text", []*TableDiff{d}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "      Level: 1 -> 5\n") {
+		t.Errorf("text output missing change line:\n%s", buf.String())
+	}
+}
+
+func TestCompareFallsBackToIndex(t *testing.T) {
+	name := func(s string) *string { return &s }
+	schema := &dat.TableSchema{
+		Name:    "Tags",
+		Columns: []dat.TableColumn{{Name: name("Id"), Type: dat.TypeString}},
+	}
+	rows := []dat.ParsedRow{
+		{Index: 0, Fields: map[string]any{"Id": "dup"}},
+		{Index: 1, Fields: map[string]any{"Id": "dup"}},
+	}
+
+	d := Compare(schema, "English", rows, rows[:1])
+	if d.KeyColumn != "" {
+		t.Errorf("KeyColumn = %q, want index matching", d.KeyColumn)
+	}
+	if len(d.Removed) != 1 || d.Removed[0].Key != "#1" {
+		t.Errorf("Removed = %+v, want [#1]", d.Removed)
+	}
+}
@@ -0,0 +1,126 @@
+package diff
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Formats are the output formats Write accepts.
+var Formats = []string{"text", "json", "markdown"}
+
+// Write renders diffs to w in the named format.
+func Write(w io.Writer, format string, diffs []*TableDiff) error {
+	bw := bufio.NewWriter(w)
+	var err error
+	switch format {
+	case "text":
+		writeText(bw, diffs)
+	case "json":
+		err = writeJSON(bw, diffs)
+	case "markdown":
+		writeMarkdown(bw, diffs)
+	default:
+		return fmt.Errorf("unsupported diff format %q (supported: %s)", format, strings.Join(Formats, ", "))
+	}
+	if err != nil {
+		return fmt.Errorf("writing diff: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("writing diff: %w", err)
+	}
+	return nil
+}
+
+func summary(d *TableDiff) string {
+	return fmt.Sprintf("%d added, %d removed, %d changed", len(d.Added), len(d.Removed), len(d.Changed))
+}
+
+func writeText(w io.Writer, diffs []*TableDiff) {
+	for _, d := range diffs {
+		if d.Empty() {
+			fmt.Fprintf(w, "%s (%s): no changes\n", d.Table, d.Language)
+			continue
+		}
+		fmt.Fprintf(w, "%s (%s): %s\n", d.Table, d.Language, summary(d))
+		for _, row := range d.Added {
+			fmt.Fprintf(w, "  + %s\n", row.Key)
+		}
+		for _, row := range d.Removed {
+			fmt.Fprintf(w, "  - %s\n", row.Key)
+		}
+		for _, row := range d.Changed {
+			fmt.Fprintf(w, "  ~ %s\n", row.Key)
+			for _, c := range row.Changes {
+				fmt.Fprintf(w, "      %s: %s -> %s\n", c.Column, formatValue(c.Before), formatValue(c.After))
+			}
+		}
+	}
+}
+
+func writeJSON(w io.Writer, diffs []*TableDiff) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if diffs == nil {
+		diffs = []*TableDiff{}
+	}
+	return enc.Encode(diffs)
+}
+
+func writeMarkdown(w io.Writer, diffs []*TableDiff) {
+	for i, d := range diffs {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "## %s (%s)\n\n", d.Table, d.Language)
+		if d.Empty() {
+			fmt.Fprintln(w, "No changes.")
+			continue
+		}
+
+		matched := "row index"
+		if d.KeyColumn != "" {
+			matched = "`" + d.KeyColumn + "`"
+		}
+		fmt.Fprintf(w, "%s. Rows matched on %s.\n", summary(d), matched)
+
+		if len(d.Added) > 0 {
+			fmt.Fprintf(w, "\n### Added\n\n")
+			for _, row := range d.Added {
+				fmt.Fprintf(w, "- `%s`\n", row.Key)
+			}
+		}
+		if len(d.Removed) > 0 {
+			fmt.Fprintf(w, "\n### Removed\n\n")
+			for _, row := range d.Removed {
+				fmt.Fprintf(w, "- `%s`\n", row.Key)
+			}
+		}
+		if len(d.Changed) > 0 {
+			fmt.Fprintf(w, "\n### Changed\n\n| Row | Column | Before | After |\n| --- | --- | --- | --- |\n")
+			for _, row := range d.Changed {
+				for _, c := range row.Changes {
+					fmt.Fprintf(w, "| `%s` | %s | %s | %s |\n", markdownCell(row.Key), c.Column,
+						markdownCell(formatValue(c.Before)), markdownCell(formatValue(c.After)))
+				}
+			}
+		}
+	}
+}
+
+// formatValue renders a normalized value as JSON so strings, nulls and
+// arrays stay distinguishable in text output.
+func formatValue(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
@@ -66,7 +66,7 @@ type datStat struct {
 // that leave every size identical.
 func WriteDatStats(ctx context.Context, cfg *config.Config, w io.Writer) error {
 	gameVersion := 0
-	if cfg.GgpkPath == "" {
+	if !cfg.LocalSource() {
 		var err error
 		gameVersion, err = poe.ParseGameVersion(cfg.Patch)
 		if err != nil {
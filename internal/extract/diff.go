@@ -0,0 +1,128 @@
+package extract
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/jchantrell/exiledb/internal/bundle"
+	"github.com/jchantrell/exiledb/internal/cdn"
+	"github.com/jchantrell/exiledb/internal/config"
+	"github.com/jchantrell/exiledb/internal/dat"
+	"github.com/jchantrell/exiledb/internal/diff"
+	"github.com/jchantrell/exiledb/internal/poe"
+)
+
+type tableLanguage struct {
+	table    string
+	language string
+}
+
+// DiffPatches parses the configured tables of two patches with the same
+// schema and compares them row by row, once per configured language. Tables
+// missing from both patches are left out; a table missing from one side
+// shows every row as added or removed.
+func DiffPatches(ctx context.Context, cfg *config.Config, from, to string) ([]*diff.TableDiff, error) {
+	if len(cfg.Tables) == 0 {
+		return nil, fmt.Errorf("no tables selected: use --tables")
+	}
+
+	fromVersion, err := poe.ParseGameVersion(from)
+	if err != nil {
+		return nil, fmt.Errorf("parsing --from version: %w", err)
+	}
+	toVersion, err := poe.ParseGameVersion(to)
+	if err != nil {
+		return nil, fmt.Errorf("parsing --to version: %w", err)
+	}
+	if fromVersion != toVersion {
+		return nil, fmt.Errorf("cannot diff patches of different games (%s and %s)", from, to)
+	}
+
+	if err := checkCached(cfg, true, from, to); err != nil {
+		return nil, err
+	}
+
+	schema, err := loadCommunitySchema(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("loading community schema: %w", err)
+	}
+	tables, err := filterTables(schema.GetValidTables(toVersion), cfg.Tables)
+	if err != nil {
+		return nil, err
+	}
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("none of the selected tables exist in the schema")
+	}
+
+	before, err := parsePatchTables(ctx, cfg, from, fromVersion, tables)
+	if err != nil {
+		return nil, fmt.Errorf("reading patch %s: %w", from, err)
+	}
+	after, err := parsePatchTables(ctx, cfg, to, toVersion, tables)
+	if err != nil {
+		return nil, fmt.Errorf("reading patch %s: %w", to, err)
+	}
+
+	var diffs []*diff.TableDiff
+	for i := range tables {
+		for _, language := range cfg.Languages {
+			key := tableLanguage{tables[i].Name, language}
+			b, inBefore := before[key]
+			a, inAfter := after[key]
+			if !inBefore && !inAfter {
+				slog.Warn("Table not found in either patch", "table", tables[i].Name, "language", language)
+				continue
+			}
+			diffs = append(diffs, diff.Compare(&tables[i], language, b, a))
+		}
+	}
+	return diffs, nil
+}
+
+// parsePatchTables reads and parses every (table, language) dat file of one
+// patch, each with the columns that patch has, downloading the bundles that
+// hold them. Files the patch does not have are absent from the result.
+func parsePatchTables(ctx context.Context, cfg *config.Config, patch string, gameVersion int, tables []dat.TableSchema) (map[tableLanguage][]dat.ParsedRow, error) {
+	patchCfg := *cfg
+	patchCfg.Patch = patch
+	patchCfg.GgpkPath = ""
+	patchCfg.GameDir = ""
+
+	src, err := resolveSource(ctx, &patchCfg, gameVersion, false)
+	if err != nil {
+		return nil, err
+	}
+	manager, err := bundle.NewBundleManager(src.bundleSource)
+	if err != nil {
+		src.bundleSource.Close()
+		return nil, fmt.Errorf("creating bundle manager: %w", err)
+	}
+	defer manager.Close()
+
+	bundles := bundlesForFiles(manager.Index(), datFilePaths(patch, tables, cfg.Languages))
+	if err := cdn.DownloadBundles(ctx, src.cache, patch, gameVersion, bundles, false, func(int, int, string) {}); err != nil {
+		return nil, fmt.Errorf("downloading bundles: %w", err)
+	}
+
+	parsed := make(map[tableLanguage][]dat.ParsedRow)
+	for i := range tables {
+		for _, language := range cfg.Languages {
+			path, ok := resolveDatPath(patch, tables[i].Name, language, manager.FileExists)
+			if !ok {
+				continue
+			}
+			data, err := manager.GetFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("reading %s: %w", path, err)
+			}
+			layout := tables[i].ForPatch(patch)
+			table, err := dat.Parse(ctx, data, &layout)
+			if err != nil {
+				return nil, fmt.Errorf("parsing %s: %w", path, err)
+			}
+			parsed[tableLanguage{tables[i].Name, language}] = table.Rows
+		}
+	}
+	return parsed, nil
+}
@@ -8,6 +8,8 @@ import (
 	"os"
 	"path/filepath"
 	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/jchantrell/exiledb/internal/bundle"
@@ -17,15 +19,52 @@ import (
 	"github.com/jchantrell/exiledb/internal/dat"
 	"github.com/jchantrell/exiledb/internal/database"
 	"github.com/jchantrell/exiledb/internal/export"
+	"github.com/jchantrell/exiledb/internal/output"
 	"github.com/jchantrell/exiledb/internal/poe"
+	"github.com/jchantrell/exiledb/internal/version"
 )
 
 type Options struct {
 	ForceDownload bool
 
+	// Replace re-extracts selected tables that already exist in the
+	// database instead of refusing to touch them.
+	Replace bool
+
+	// Resume skips the (table, language) units a previous extract of the
+	// same patch completed, and redoes units it left half written, so an
+	// interrupted extract continues where it stopped.
+	Resume bool
+
+	// MultiPatch writes rows scoped by a _patch column, so repeated extracts
+	// of different patches accumulate in one database.
+	MultiPatch bool
+
+	// Format is where tables are written: FormatSQLite (the default) loads
+	// them into the database, any of output.Formats writes one file per
+	// table and language under OutDir instead.
+	Format string
+	OutDir string
+
+	// WithReferences adds the tables the selected tables reference, and
+	// those they reference, up to this many references away; AllReferences
+	// follows every chain to its end.
+	WithReferences int
+
+	// Views rebuilds a <table>_resolved view over every table in the
+	// database that resolves its references to Id and Name columns.
+	Views bool
+
 	Progress func() func(done, total int, label string)
 }
 
+// FormatSQLite is the default Format, loading tables into cfg.Database.
+const FormatSQLite = "sqlite"
+
+func (o Options) toFiles() bool {
+	return o.Format != "" && o.Format != FormatSQLite
+}
+
 func (o Options) phase() func(done, total int, label string) {
 	if o.Progress == nil {
 		return func(int, int, string) {}
@@ -38,35 +77,83 @@ func (o Options) phase() func(done, total int, label string) {
 func Run(ctx context.Context, cfg *config.Config, opts Options) (*Stats, error) {
 	stats := &Stats{StartTime: time.Now()}
 
-	db, err := database.NewDatabase(database.DefaultDatabaseOptions(cfg.Database))
-	if err != nil {
-		return nil, fmt.Errorf("creating database: %w", err)
+	if opts.toFiles() {
+		if !slices.Contains(output.Formats, opts.Format) {
+			return nil, fmt.Errorf("unsupported format %q (supported: %s, %s)", opts.Format, FormatSQLite, strings.Join(output.Formats, ", "))
+		}
+		if opts.OutDir == "" {
+			return nil, fmt.Errorf("an output directory is required for format %s", opts.Format)
+		}
+		if opts.Views {
+			return nil, fmt.Errorf("views require a database; they cannot be written with format %s", opts.Format)
+		}
+		if opts.Resume {
+			return nil, fmt.Errorf("resume requires a database; files are rewritten by every run")
+		}
 	}
-	defer db.Close()
-
-	hasTables, err := db.HasUserTables(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("checking database tables: %w", err)
+	if opts.Resume && opts.Replace {
+		return nil, fmt.Errorf("resume and replace cannot be combined")
+	}
+	if opts.ForceDownload && cfg.Offline {
+		return nil, fmt.Errorf("force downloads again and cannot be combined with offline")
+	}
+	var patches []string
+	if !cfg.LocalSource() {
+		patches = []string{cfg.Patch}
+	}
+	if err := checkCached(cfg, len(cfg.Tables) > 0, patches...); err != nil {
+		return nil, err
 	}
-	if hasTables {
-		return nil, fmt.Errorf("database already contains tables")
+
+	var (
+		db  *database.Database
+		err error
+	)
+	if !opts.toFiles() {
+		db, err = database.NewDatabase(database.DefaultDatabaseOptions(cfg.Database))
+		if err != nil {
+			return nil, fmt.Errorf("creating database: %w", err)
+		}
+		defer db.Close()
 	}
 
 	gameVersion := 0
-	if cfg.GgpkPath == "" || len(cfg.Tables) > 0 {
+	if !cfg.LocalSource() || len(cfg.Tables) > 0 {
 		gameVersion, err = poe.ParseGameVersion(cfg.Patch)
 		if err != nil {
 			return nil, fmt.Errorf("parsing game version: %w", err)
 		}
 	}
 
-	var resolvedTables []dat.TableSchema
+	var (
+		validTables, resolvedTables []dat.TableSchema
+		enumerations                []dat.SchemaEnumeration
+		schemaMeta                  dat.SchemaMetadata
+	)
 	if len(cfg.Tables) > 0 {
-		schema, err := loadCommunitySchema(ctx, cfg.SchemaPath)
+		schema, err := loadCommunitySchema(ctx, cfg)
 		if err != nil {
 			return nil, fmt.Errorf("loading community schema: %w", err)
 		}
-		resolvedTables = filterTables(schema.GetValidTables(gameVersion), cfg.Tables)
+		validTables = patchTables(schema.GetValidTables(gameVersion), cfg.Patch, opts.MultiPatch)
+		resolvedTables, _, err = selectTables(validTables, cfg.Tables, opts.WithReferences)
+		if err != nil {
+			return nil, err
+		}
+		enumerations = schema.GetValidEnumerations(gameVersion)
+		schemaMeta = schema.SchemaMetadata
+	}
+
+	var work []tableWork
+	switch {
+	case len(resolvedTables) == 0:
+	case opts.toFiles():
+		work, err = planFiles(cfg, resolvedTables, opts.MultiPatch)
+	default:
+		work, err = planIncremental(ctx, cfg, db, resolvedTables, opts)
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	manager, err := openSource(ctx, cfg, opts, gameVersion, resolvedTables)
@@ -80,11 +167,25 @@ func Run(ctx context.Context, cfg *config.Config, opts Options) (*Stats, error)
 
 	stats.processingStart = time.Now()
 
-	if len(resolvedTables) > 0 {
-		if err := insertTables(ctx, cfg, db, manager, opts, stats, resolvedTables); err != nil {
+	switch {
+	case len(resolvedTables) == 0:
+	case opts.toFiles():
+		if err := writeTableFiles(ctx, cfg, manager, opts, stats, work); err != nil {
 			return nil, err
 		}
-		reportForeignKeys(ctx, db)
+	default:
+		if err := insertTables(ctx, cfg, db, manager, opts, stats, work, enumerations); err != nil {
+			return nil, err
+		}
+		if err := writeMeta(ctx, cfg, db, opts, schemaMeta); err != nil {
+			return nil, err
+		}
+		reportForeignKeys(ctx, db, work)
+		if opts.Views {
+			if err := createViews(ctx, db, validTables, work); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	if len(cfg.Files) > 0 {
@@ -122,9 +223,21 @@ func resolveSource(ctx context.Context, cfg *config.Config, gameVersion int, for
 		return nil, err
 	}
 
+	if cfg.GameDir != "" {
+		slog.Info("Using game directory", "path", cfg.GameDir)
+		s, err := bundle.NewDirSource(cfg.GameDir, c.InstallIndexCachePath(cfg.GameDir))
+		if err != nil {
+			return nil, fmt.Errorf("opening game directory: %w", err)
+		}
+		return &source{bundleSource: s}, nil
+	}
+
 	if err := cdn.DownloadIndex(ctx, c, cfg.Patch, gameVersion, force); err != nil {
 		return nil, fmt.Errorf("downloading index file: %w", err)
 	}
+	if err := c.Touch(cfg.Patch); err != nil {
+		slog.Debug("Failed to mark cached patch as used", "patch", cfg.Patch, "error", err)
+	}
 
 	return &source{
 		bundleSource: bundle.NewCacheSource(c, cfg.Patch),
@@ -135,7 +248,7 @@ func resolveSource(ctx context.Context, cfg *config.Config, gameVersion int, for
 
 func LoadIndex(ctx context.Context, cfg *config.Config) (*bundle.Index, error) {
 	gameVersion := 0
-	if cfg.GgpkPath == "" {
+	if !cfg.LocalSource() {
 		var err error
 		gameVersion, err = poe.ParseGameVersion(cfg.Patch)
 		if err != nil {
@@ -200,104 +313,159 @@ func openSource(ctx context.Context, cfg *config.Config, opts Options, gameVersi
 	return manager, nil
 }
 
-func loadCommunitySchema(ctx context.Context, schemaPath string) (*dat.CommunitySchema, error) {
-	if schemaPath != "" {
-		slog.Info("Using local schema", "path", schemaPath)
-		file, err := os.Open(schemaPath)
-		if err != nil {
-			return nil, fmt.Errorf("opening schema file %s: %w", schemaPath, err)
-		}
-		defer file.Close()
-		return dat.ParseCommunitySchema(file)
+// checkCached reports, in offline mode, every input fetched before bundles
+// that is not cached: the schema when needSchema is set and neither --schema
+// nor a pin is given, and the index of each of patches. Listing them together spares a
+// failing run per missing input. Bundles are checked once the index says
+// which are needed.
+func checkCached(cfg *config.Config, needSchema bool, patches ...string) error {
+	if !cfg.Offline {
+		return nil
 	}
-
 	c, err := cache.New()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	if err := os.MkdirAll(c.Dir(), 0755); err != nil {
-		return nil, fmt.Errorf("creating schema cache directory: %w", err)
+	missing := &cdn.MissingError{}
+	if needSchema && cfg.SchemaPath == "" && cfg.SchemaVersion == 0 && cfg.SchemaAt == "" {
+		if _, err := os.Stat(c.SchemaPath()); err != nil {
+			missing.Add("schema (or pass --schema)", c.SchemaPath())
+		}
 	}
-	if err := cdn.Download(ctx, dat.CommunitySchemaURL, c.SchemaPath()); err != nil {
-		return nil, fmt.Errorf("downloading schema: %w", err)
+	for _, patch := range patches {
+		if _, err := os.Stat(c.IndexPath(patch)); err != nil {
+			missing.Add("index of patch "+patch, c.IndexPath(patch))
+		}
 	}
+	return missing.Err()
+}
 
-	file, err := os.Open(c.SchemaPath())
-	if err != nil {
-		return nil, fmt.Errorf("opening cached schema: %w", err)
+func insertTables(ctx context.Context, cfg *config.Config, db *database.Database, files datFiles, opts Options, stats *Stats, work []tableWork, enumerations []dat.SchemaEnumeration) error {
+	var drop, create []*database.TablePlan
+	for _, w := range work {
+		if w.drop {
+			drop = append(drop, w.plan)
+		}
+		if w.create {
+			create = append(create, w.plan)
+		}
 	}
-	defer file.Close()
-
-	return dat.ParseCommunitySchema(file)
-}
 
-func insertTables(ctx context.Context, cfg *config.Config, db *database.Database, manager *bundle.BundleManager, opts Options, stats *Stats, datSchemas []dat.TableSchema) error {
-	stats.TotalTables = len(datSchemas)
+	// Marked complete again by writeMeta; until then the database says an
+	// extract of this patch is under way.
+	if err := database.WriteMeta(ctx, db, map[string]string{
+		database.MetaStatus: database.StatusIncomplete,
+		"patch":             cfg.Patch,
+	}); err != nil {
+		return fmt.Errorf("marking extract incomplete: %w", err)
+	}
 
-	plans, err := database.Plan(datSchemas)
-	if err != nil {
-		return fmt.Errorf("planning tables: %w", err)
+	if len(drop) > 0 {
+		slog.Info("Replacing existing tables", "count", len(drop))
+		if err := database.DropTables(ctx, db, drop); err != nil {
+			return fmt.Errorf("dropping replaced tables: %w", err)
+		}
+	}
+	for _, w := range work {
+		if len(w.clear) == 0 {
+			continue
+		}
+		slog.Info("Replacing existing languages", "table", w.plan.SQLName(), "patch", cfg.Patch, "languages", w.clear)
+		if err := database.DeleteLanguages(ctx, db, w.plan, cfg.Patch, w.clear); err != nil {
+			return fmt.Errorf("deleting replaced languages: %w", err)
+		}
 	}
 
-	createdTables, err := database.CreateSchemas(ctx, db, plans, opts.phase())
+	createdTables, err := database.CreateSchemas(ctx, db, create, opts.phase())
 	if err != nil {
 		return fmt.Errorf("creating schemas: %w", err)
 	}
 	slog.Info("Creating database schemas", "count", createdTables)
+	if extended := len(work) - len(create); extended > 0 {
+		slog.Info("Extending existing tables", "count", extended)
+	}
+
+	plans := make([]*database.TablePlan, len(work))
+	for i, w := range work {
+		plans[i] = w.plan
+	}
+	enumTables, err := database.WriteEnumerations(ctx, db, plans, enumerations, cfg.Patch)
+	if err != nil {
+		return fmt.Errorf("writing enumerations: %w", err)
+	}
+	if enumTables > 0 {
+		slog.Info("Writing enumeration tables", "count", enumTables)
+	}
 
-	slog.Info("Inserting dat files", "count", len(datSchemas))
+	slog.Info("Inserting dat files", "count", len(work))
+
+	return writeTables(ctx, cfg, files, opts, stats, work, func(job *parseJob, res *parseResult) (int, error) {
+		return database.InsertTableData(ctx, db, job.work.plan, &database.TableData{
+			Schema:   job.work.schema,
+			Rows:     res.rows,
+			Language: job.language,
+			Patch:    cfg.Patch,
+			Path:     res.path,
+			SHA256:   res.sha256,
+		})
+	})
+}
+
+// writeTables streams every job's rows to write, in job order.
+func writeTables(ctx context.Context, cfg *config.Config, files datFiles, opts Options, stats *Stats, work []tableWork, write func(job *parseJob, res *parseResult) (int, error)) error {
+	stats.TotalTables = len(work)
+
+	// Bundle reads, decompression and row decoding fan out across workers;
+	// this goroutine is the only writer and takes each file's batches in
+	// table order, so writes, logging and Stats match a sequential run.
+	jobs := parseJobs(work)
+	pipeline := startParsePipeline(ctx, cfg.Patch, files, jobs)
+	defer pipeline.Close()
 
 	languagesSeen := make(map[string]bool)
 
 	insertProgress := opts.phase()
-	for i, datSchema := range datSchemas {
-		if err := ctx.Err(); err != nil {
+	for i := range jobs {
+		job := &jobs[i]
+		datSchema := job.work.schema
+		language := job.language
+
+		res, err := pipeline.next(ctx, i)
+		if err != nil {
 			return fmt.Errorf("extraction canceled: %w", err)
 		}
 
-		insertProgress(i+1, len(datSchemas), datSchema.Name)
-
-		for _, language := range cfg.Languages {
-			path, ok := resolveDatPath(cfg.Patch, datSchema.Name, language, manager.FileExists)
-			if !ok {
-				slog.Debug("File does not exist", "table", datSchema.Name, "language", language)
-				continue
-			}
+		switch {
+		case res.missing:
+			slog.Debug("File does not exist", "table", datSchema.Name, "language", language)
+		case res.fetchErr != nil:
 			languagesSeen[language] = true
-
-			slog.Debug("Processing DAT file", "path", path, "table", datSchema.Name)
-
-			datData, err := manager.GetFile(path)
-			if err != nil {
-				slog.Error("Failed to get file from bundle", "path", path, "table", datSchema.Name, "error", err)
-				continue
-			}
-
-			parsedTable, err := dat.Parse(ctx, datData, &datSchema)
+			slog.Error("Failed to get file from bundle", "path", res.path, "table", datSchema.Name, "error", res.fetchErr)
+		case res.parseErr != nil:
+			languagesSeen[language] = true
+			slog.Error("Failed to parse DAT file", "path", res.path, "table", datSchema.Name, "size_bytes", res.size, "error", res.parseErr)
+			stats.ProcessingErrors++
+		case res.rows.Len() == 0:
+			languagesSeen[language] = true
+			slog.Debug("Table has no rows", "path", res.path, "table", datSchema.Name)
+		default:
+			languagesSeen[language] = true
+			inserted, err := write(job, &res)
 			if err != nil {
-				slog.Error("Failed to parse DAT file", "path", path, "table", datSchema.Name, "size_bytes", len(datData), "error", err)
-				stats.ProcessingErrors++
-				continue
-			}
-			if len(parsedTable.Rows) == 0 {
-				slog.Debug("Table has no rows", "path", path, "table", datSchema.Name)
-				continue
-			}
-
-			tableData := &database.TableData{
-				Schema:   &datSchema,
-				Rows:     parsedTable.Rows,
-				Language: language,
-			}
-			if err := database.InsertTableData(ctx, db, plans[i], tableData); err != nil {
-				slog.Error("Failed to insert records", "table", datSchema.Name, "error", err)
+				slog.Error("Failed to write records", "table", datSchema.Name, "error", err)
 				stats.DatabaseErrors++
-				continue
+			} else {
+				stats.RowsInserted += int64(inserted)
 			}
+		}
+		if res.rows != nil {
+			res.rows.Close()
+		}
 
-			stats.RowsInserted += int64(len(parsedTable.Rows))
+		if job.last {
+			stats.ProcessedTables++
+			insertProgress(stats.ProcessedTables, len(work), datSchema.Name)
 		}
-		stats.ProcessedTables++
 	}
 
 	for _, language := range cfg.Languages {
@@ -309,8 +477,40 @@ func insertTables(ctx context.Context, cfg *config.Config, db *database.Database
 	return nil
 }
 
-func reportForeignKeys(ctx context.Context, db *database.Database) {
-	violations, err := db.CheckForeignKeys(ctx)
+// writeMeta records the extract in _meta, so a database file says where it
+// came from. Each extract overwrites the previous one's entries.
+func writeMeta(ctx context.Context, cfg *config.Config, db *database.Database, opts Options, schema dat.SchemaMetadata) error {
+	meta := map[string]string{
+		"patch":             cfg.Patch,
+		"languages":         strings.Join(cfg.Languages, ","),
+		"multi_patch":       strconv.FormatBool(opts.MultiPatch),
+		"schema_version":    strconv.Itoa(schema.Version),
+		"schema_created_at": time.Unix(int64(schema.CreatedAt), 0).UTC().Format(time.RFC3339),
+		"exiledb_version":   version.Get(),
+		"extracted_at":      time.Now().UTC().Format(time.RFC3339),
+		database.MetaStatus: database.StatusComplete,
+	}
+	switch {
+	case cfg.GgpkPath != "":
+		meta["source"] = "ggpk"
+	case cfg.GameDir != "":
+		meta["source"] = "game_dir"
+	default:
+		meta["source"] = "cdn"
+	}
+	if err := database.WriteMeta(ctx, db, meta); err != nil {
+		return fmt.Errorf("writing extract metadata: %w", err)
+	}
+	return nil
+}
+
+// reportForeignKeys logs violations in the tables this run wrote.
+func reportForeignKeys(ctx context.Context, db *database.Database, work []tableWork) {
+	plans := make([]*database.TablePlan, len(work))
+	for i, w := range work {
+		plans[i] = w.plan
+	}
+	violations, err := db.CheckForeignKeys(ctx, plans)
 	if err != nil {
 		slog.Warn("Foreign key check failed", "error", err)
 		return
@@ -341,21 +541,26 @@ func exportFiles(ctx context.Context, cfg *config.Config, manager *bundle.Bundle
 	return nil
 }
 
-func filterTables(validTables []dat.TableSchema, configuredTables []string) []dat.TableSchema {
+// filterTables returns the tables the --tables selector picks, in schema
+// order. Terms that select nothing are logged, as they are usually typos.
+func filterTables(validTables []dat.TableSchema, configuredTables []string) ([]dat.TableSchema, error) {
 	if len(configuredTables) == 0 {
-		return validTables
+		return validTables, nil
 	}
 
-	configured := make(map[string]bool, len(configuredTables))
-	for _, tableName := range configuredTables {
-		configured[poe.ToSnakeCase(tableName)] = true
+	selector, err := config.ParseTableSelector(configuredTables)
+	if err != nil {
+		return nil, err
 	}
 
 	filtered := make([]dat.TableSchema, 0)
 	for _, table := range validTables {
-		if configured[poe.ToSnakeCase(table.Name)] {
+		if selector.Match(table.Name, table.Tags) {
 			filtered = append(filtered, table)
 		}
 	}
-	return filtered
+	for _, term := range selector.Unmatched() {
+		slog.Warn("No table matches selector", "selector", term)
+	}
+	return filtered, nil
 }
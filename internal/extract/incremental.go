@@ -0,0 +1,202 @@
+package extract
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/jchantrell/exiledb/internal/config"
+	"github.com/jchantrell/exiledb/internal/dat"
+	"github.com/jchantrell/exiledb/internal/database"
+)
+
+// tableWork is one table's share of an extract: the languages to insert and
+// what must happen to the table before they can be.
+type tableWork struct {
+	schema    *dat.TableSchema
+	plan      *database.TablePlan
+	languages []string
+
+	drop   bool     // drop the existing table first (implies create)
+	create bool     // create the table's DDL
+	clear  []string // languages whose existing rows for this patch are deleted first
+}
+
+// planIncremental decides, per requested table, whether the extract creates
+// it, extends it in place, or (with replace) re-extracts part or all of it.
+// A table is extended when its recorded layout matches the current plan and
+// none of the requested (patch, language) units are present yet. Single-patch
+// tables additionally only accept the patch they were extracted from. With
+// replace, overlapping units are deleted and re-inserted, and a table whose
+// layout or patch no longer fits is dropped and recreated; so is an
+// enumeration lookup table written in the other mode. With resume,
+// recorded units are skipped instead, so an interrupted extract picks up
+// where it stopped. Every remaining overlap is reported up front, before
+// anything is written.
+//
+// Each unit is inserted and recorded in one transaction, so on resume, rows
+// of a pending unit were left by something other than a completed insert;
+// they are deleted and the unit redone. Tables are created and recorded in
+// one transaction too, so a table the catalog does not record was not made
+// by an extract; it is a conflict on resume as well, and only replace drops
+// it.
+func planIncremental(ctx context.Context, cfg *config.Config, db *database.Database, schemas []dat.TableSchema, opts Options) ([]tableWork, error) {
+	multiPatch, replace := opts.MultiPatch, opts.Replace
+	plans, err := database.Plan(schemas, database.PlanOptions{MultiPatch: multiPatch})
+	if err != nil {
+		return nil, fmt.Errorf("planning tables: %w", err)
+	}
+
+	catalog, err := database.LoadCatalog(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("loading table catalog: %w", err)
+	}
+	existing, err := db.UserTables(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("checking database tables: %w", err)
+	}
+	if opts.Resume {
+		meta, err := database.ReadMeta(ctx, db)
+		if err != nil {
+			return nil, fmt.Errorf("reading extract metadata: %w", err)
+		}
+		if meta[database.MetaStatus] == database.StatusIncomplete {
+			slog.Info("Resuming interrupted extract", "patch", meta["patch"])
+			if meta["patch"] != cfg.Patch {
+				slog.Warn("Interrupted extract was of another patch", "interrupted", meta["patch"], "patch", cfg.Patch)
+			}
+		}
+	}
+
+	var (
+		work      []tableWork
+		conflicts []string
+	)
+	for i, plan := range plans {
+		name := plan.SQLName()
+		w := tableWork{schema: &schemas[i], plan: plan, languages: cfg.Languages}
+		record, recorded := catalog[name]
+
+		reason := ""
+		switch {
+		case !recorded && !existing[name]:
+			w.create = true
+		case !recorded:
+			reason = "exists but was not recorded by a previous extract"
+		case record.MultiPatch != multiPatch:
+			reason = "was extracted in single-patch mode"
+			if record.MultiPatch {
+				reason = "was extracted in multi-patch mode"
+			}
+		case record.Signature != plan.Signature():
+			reason = "layout differs from the current schema"
+		case !multiPatch && otherPatch(record, cfg.Patch) != "":
+			reason = fmt.Sprintf("holds patch %q, not %q", otherPatch(record, cfg.Patch), cfg.Patch)
+		default:
+			var pending, present []string
+			for _, language := range cfg.Languages {
+				if record.Has(cfg.Patch, language) {
+					present = append(present, language)
+				} else {
+					pending = append(pending, language)
+				}
+			}
+			if opts.Resume {
+				if len(pending) == 0 {
+					slog.Debug("Skipping completed table", "table", name)
+					continue
+				}
+				w.languages = pending
+				if w.clear, err = partialLanguages(ctx, db, plan, cfg.Patch, pending); err != nil {
+					return nil, err
+				}
+			} else {
+				w.clear = present
+				if len(w.clear) > 0 && !replace {
+					conflicts = append(conflicts, fmt.Sprintf("%s: already contains %s for patch %q", name, strings.Join(w.clear, ", "), cfg.Patch))
+					continue
+				}
+			}
+			slog.Debug("Extending existing table", "table", name, "languages", w.languages, "replacing", w.clear)
+		}
+
+		if reason != "" {
+			if !replace {
+				conflicts = append(conflicts, fmt.Sprintf("%s: %s", name, reason))
+				continue
+			}
+			w.drop = true
+			w.create = true
+		}
+
+		work = append(work, w)
+	}
+
+	// Lookup tables are shared by every table referencing the enumeration,
+	// and WriteEnumerations drops one that does not fit; like data tables,
+	// that needs replace.
+	planned := make(map[string]bool)
+	for _, plan := range plans {
+		planned[plan.SQLName()] = true
+	}
+	for _, plan := range plans {
+		for _, name := range plan.Enumerations() {
+			if planned[name] {
+				continue
+			}
+			planned[name] = true
+			record, recorded := catalog[name]
+			reason := ""
+			switch {
+			case !recorded && existing[name]:
+				reason = "exists but was not recorded by a previous extract"
+			case !recorded || !record.Enumeration():
+			case record.MultiPatch != multiPatch:
+				reason = "was extracted in single-patch mode"
+				if record.MultiPatch {
+					reason = "was extracted in multi-patch mode"
+				}
+			}
+			if reason != "" && !replace {
+				conflicts = append(conflicts, fmt.Sprintf("%s: %s", name, reason))
+			}
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("database already contains selected tables (use --replace to re-extract them, or --resume to skip them):\n  %s",
+			strings.Join(conflicts, "\n  "))
+	}
+	return work, nil
+}
+
+// partialLanguages returns the languages among pending that already have
+// rows in a plan's tables for patch, which an interrupted insert left behind.
+func partialLanguages(ctx context.Context, db *database.Database, plan *database.TablePlan, patch string, pending []string) ([]string, error) {
+	var partial []string
+	for _, language := range pending {
+		found, err := database.HasLanguage(ctx, db, plan, patch, language)
+		if err != nil {
+			return nil, fmt.Errorf("checking %s for unrecorded rows: %w", plan.SQLName(), err)
+		}
+		if found {
+			slog.Warn("Redoing partially written language", "table", plan.SQLName(), "patch", patch, "language", language)
+			partial = append(partial, language)
+		}
+	}
+	return partial, nil
+}
+
+// otherPatch returns a patch recorded for the table other than patch, or ""
+// if there is none.
+func otherPatch(record *database.TableRecord, patch string) string {
+	for _, p := range slices.Sorted(maps.Keys(record.Languages)) {
+		if p != patch {
+			return p
+		}
+	}
+	return ""
+}
@@ -0,0 +1,323 @@
+package extract
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jchantrell/exiledb/internal/config"
+	"github.com/jchantrell/exiledb/internal/dat"
+	"github.com/jchantrell/exiledb/internal/database"
+)
+
+func modsSchema() dat.TableSchema {
+	id := "Id"
+	return dat.TableSchema{Name: "Mods", Columns: []dat.TableColumn{{Name: &id, Type: dat.TypeString}}}
+}
+
+// openTestDatabase returns a database holding Mods, extracted from patch
+// 3.25.0 in English, single-patch.
+func openTestDatabase(t *testing.T) *database.Database {
+	t.Helper()
+	ctx := context.Background()
+	db, err := database.NewDatabase(database.DefaultDatabaseOptions(filepath.Join(t.TempDir(), "exile.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	schemas := []dat.TableSchema{modsSchema()}
+	plans, err := database.Plan(schemas, database.PlanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.LoadCatalog(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.CreateSchemas(ctx, db, plans, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.InsertTableData(ctx, db, plans[0], &database.TableData{
+		Schema: &schemas[0],
+		Rows: dat.NewBatches(&dat.Batch{Len: 1, Columns: []dat.Column{
+			{Kind: dat.KindString, Strings: []string{"Strength1"}, Nulls: dat.Bitmap{0}},
+		}}),
+		Language: "English",
+		Patch:    "3.25.0",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestPlanIncremental(t *testing.T) {
+	name := func(s string) *string { return &s }
+	stats := dat.TableSchema{Name: "Stats", Columns: []dat.TableColumn{{Name: name("Id"), Type: dat.TypeString}}}
+	widerMods := dat.TableSchema{Name: "Mods", Columns: []dat.TableColumn{
+		{Name: name("Id"), Type: dat.TypeString},
+		{Name: name("Level"), Type: dat.TypeInt32},
+	}}
+
+	// want is one "table create drop languages clear" line per work item.
+	for _, tt := range []struct {
+		name      string
+		schemas   []dat.TableSchema
+		patch     string
+		languages []string
+		opts      Options
+		want      []string
+		conflict  string
+	}{
+		{
+			name:    "new table",
+			schemas: []dat.TableSchema{stats},
+			want:    []string{"stats create=true drop=false [English] []"},
+		},
+		{
+			name:      "new language",
+			languages: []string{"French"},
+			want:      []string{"mods create=false drop=false [French] []"},
+		},
+		{
+			name:     "language already present",
+			conflict: `mods: already contains English for patch "3.25.0"`,
+		},
+		{
+			name: "language already present with replace",
+			opts: Options{Replace: true},
+			want: []string{"mods create=false drop=false [English] [English]"},
+		},
+		{
+			name:     "other patch",
+			patch:    "3.26.0",
+			conflict: `mods: holds patch "3.25.0", not "3.26.0"`,
+		},
+		{
+			name:  "other patch with replace",
+			patch: "3.26.0",
+			opts:  Options{Replace: true},
+			want:  []string{"mods create=true drop=true [English] []"},
+		},
+		{
+			name:     "multi-patch into single-patch table",
+			opts:     Options{MultiPatch: true},
+			conflict: "mods: was extracted in single-patch mode",
+		},
+		{
+			name:     "layout differs",
+			schemas:  []dat.TableSchema{widerMods},
+			conflict: "mods: layout differs from the current schema",
+		},
+		{
+			name:      "resume skips completed languages",
+			languages: []string{"English", "French"},
+			opts:      Options{Resume: true},
+			want:      []string{"mods create=false drop=false [French] []"},
+		},
+		{
+			name: "resume skips completed tables",
+			opts: Options{Resume: true},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDatabase(t)
+			cfg := &config.Config{Patch: "3.25.0", Languages: []string{"English"}}
+			if tt.patch != "" {
+				cfg.Patch = tt.patch
+			}
+			if tt.languages != nil {
+				cfg.Languages = tt.languages
+			}
+			schemas := tt.schemas
+			if schemas == nil {
+				schemas = []dat.TableSchema{modsSchema()}
+			}
+
+			work, err := planIncremental(context.Background(), cfg, db, schemas, tt.opts)
+			if tt.conflict != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.conflict) {
+					t.Fatalf("planIncremental error = %v, want conflict %q", err, tt.conflict)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, w := range work {
+				got = append(got, strings.Join([]string{
+					w.plan.SQLName(),
+					"create=" + strconv.FormatBool(w.create),
+					"drop=" + strconv.FormatBool(w.drop),
+					"[" + strings.Join(w.languages, " ") + "]",
+					"[" + strings.Join(w.clear, " ") + "]",
+				}, " "))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("planIncremental work = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestPlanIncrementalUnrecordedTable covers a table the catalog does not
+// know: a conflict, on resume too, that only replace drops.
+func TestPlanIncrementalUnrecordedTable(t *testing.T) {
+	name := func(s string) *string { return &s }
+	ctx := context.Background()
+	db := openTestDatabase(t)
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("CREATE TABLE stats (_index INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{Patch: "3.25.0", Languages: []string{"English"}}
+	schemas := []dat.TableSchema{{Name: "Stats", Columns: []dat.TableColumn{{Name: name("Id"), Type: dat.TypeString}}}}
+
+	if _, err := planIncremental(ctx, cfg, db, schemas, Options{}); err == nil || !strings.Contains(err.Error(), "stats: exists but was not recorded") {
+		t.Errorf("planIncremental error = %v, want unrecorded conflict", err)
+	}
+	if _, err := planIncremental(ctx, cfg, db, schemas, Options{Resume: true}); err == nil || !strings.Contains(err.Error(), "stats: exists but was not recorded") {
+		t.Errorf("planIncremental on resume error = %v, want unrecorded conflict", err)
+	}
+	work, err := planIncremental(ctx, cfg, db, schemas, Options{Replace: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(work) != 1 || !work[0].drop || !work[0].create {
+		t.Errorf("planIncremental with replace = %+v, want stats dropped and recreated", work)
+	}
+}
+
+// TestMultiPatchRemovedColumn extracts a patch from before and one from after
+// a column's until into one multi-patch database, then re-extracts the later
+// one with Replace.
+func TestMultiPatchRemovedColumn(t *testing.T) {
+	name := func(s string) *string { return &s }
+	ctx := context.Background()
+	db, err := database.NewDatabase(database.DefaultDatabaseOptions(filepath.Join(t.TempDir(), "exile.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := database.LoadCatalog(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	schema := []dat.TableSchema{{Name: "Mods", Columns: []dat.TableColumn{
+		{Name: name("Old"), Type: dat.TypeInt32, Until: name("3.20")},
+		{Name: name("Level"), Type: dat.TypeInt32},
+	}}}
+	// Each patch's file holds the columns it has.
+	patchFiles := map[string]*fakeFiles{
+		"3.19.0": {files: map[string][]byte{datPath("Mods", "English"): int32RowsDat([]int32{7, 1}, []int32{8, 2})}},
+		"3.25.0": {files: map[string][]byte{datPath("Mods", "English"): int32RowsDat([]int32{3}, []int32{4}, []int32{5}, []int32{6})}},
+	}
+
+	extract := func(patch string, opts Options) {
+		t.Helper()
+		cfg := &config.Config{Patch: patch, Languages: []string{"English"}}
+		opts.MultiPatch = true
+		work, err := planIncremental(ctx, cfg, db, patchTables(schema, patch, true), opts)
+		if err != nil {
+			t.Fatalf("planning %s: %v", patch, err)
+		}
+		if err := insertTables(ctx, cfg, db, patchFiles[patch], opts, &Stats{}, work, nil); err != nil {
+			t.Fatalf("extracting %s: %v", patch, err)
+		}
+	}
+	check := func(patch, want string) {
+		t.Helper()
+		var got string
+		query := `SELECT group_concat(coalesce(old, 'null') || '/' || level, ' ') FROM (SELECT old, level FROM mods WHERE _patch = ? ORDER BY _index)`
+		if err := db.QueryRow(ctx, query, patch).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("patch %s rows = %s, want %s", patch, got, want)
+		}
+	}
+
+	extract("3.19.0", Options{})
+	extract("3.25.0", Options{})
+	check("3.19.0", "7/1 8/2")
+	check("3.25.0", "null/3 null/4 null/5 null/6")
+
+	extract("3.25.0", Options{Replace: true})
+	check("3.19.0", "7/1 8/2")
+	check("3.25.0", "null/3 null/4 null/5 null/6")
+}
+
+// TestEnumerationModeConflict extracts tables referencing one enumeration in
+// single-patch and then multi-patch mode, and back: the shared lookup table
+// is a conflict until replace recreates it in the new mode.
+func TestEnumerationModeConflict(t *testing.T) {
+	name := func(s string) *string { return &s }
+	ctx := context.Background()
+	db, err := database.NewDatabase(database.DefaultDatabaseOptions(filepath.Join(t.TempDir(), "exile.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	enums := []dat.SchemaEnumeration{{Name: "ModDomains", Enumerators: []*string{name("Item"), name("Flask")}}}
+	table := func(table string) []dat.TableSchema {
+		return []dat.TableSchema{{Name: table, Columns: []dat.TableColumn{
+			{Name: name("Domain"), Type: dat.TypeEnumRow, References: &dat.ColumnReference{Table: "ModDomains"}},
+		}}}
+	}
+	files := &fakeFiles{files: map[string][]byte{
+		datPath("Mods", "English"):  int32RowsDat([]int32{1}),
+		datPath("Stats", "English"): int32RowsDat([]int32{0}),
+		datPath("Tags", "English"):  int32RowsDat([]int32{1}),
+	}}
+	cfg := &config.Config{Patch: testPatch, Languages: []string{"English"}}
+	extract := func(tableName string, opts Options) error {
+		t.Helper()
+		work, err := planIncremental(ctx, cfg, db, table(tableName), opts)
+		if err != nil {
+			return err
+		}
+		if err := insertTables(ctx, cfg, db, files, opts, &Stats{}, work, enums); err != nil {
+			t.Fatalf("extracting %s: %v", tableName, err)
+		}
+		return nil
+	}
+	patchColumn := func() bool {
+		t.Helper()
+		var n int
+		err := db.QueryRow(ctx, "SELECT COUNT(*) FROM mod_domains WHERE _patch = ?", testPatch).Scan(&n)
+		return err == nil && n == 2
+	}
+
+	if err := extract("Mods", Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := extract("Stats", Options{MultiPatch: true}); err == nil || !strings.Contains(err.Error(), "mod_domains: was extracted in single-patch mode") {
+		t.Errorf("multi-patch extract after single-patch = %v, want mod_domains conflict", err)
+	}
+	if err := extract("Stats", Options{MultiPatch: true, Replace: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !patchColumn() {
+		t.Error("mod_domains was not recreated with _patch")
+	}
+
+	if err := extract("Tags", Options{}); err == nil || !strings.Contains(err.Error(), "mod_domains: was extracted in multi-patch mode") {
+		t.Errorf("single-patch extract after multi-patch = %v, want mod_domains conflict", err)
+	}
+	if err := extract("Tags", Options{Replace: true}); err != nil {
+		t.Fatal(err)
+	}
+	if patchColumn() {
+		t.Error("mod_domains was not recreated without _patch")
+	}
+}
@@ -0,0 +1,243 @@
+package extract
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/jchantrell/exiledb/internal/bundle"
+	"github.com/jchantrell/exiledb/internal/cdn"
+	"github.com/jchantrell/exiledb/internal/config"
+	"github.com/jchantrell/exiledb/internal/poe"
+)
+
+// MirrorOptions configure Mirror.
+type MirrorOptions struct {
+	// Dir is the mirror's root; a patch goes to <Dir>/<patch>/Bundles2.
+	Dir string
+
+	// Bundles are the bundle names or path.Match globs to mirror, such as
+	// Folders/data*. Empty mirrors every bundle of the index.
+	Bundles []string
+
+	ForceDownload bool
+
+	// Progress, if set, receives a fresh progress callback for each phase.
+	Progress func() func(done, total int, label string)
+}
+
+// MirrorStats summarizes a Mirror run.
+type MirrorStats struct {
+	Bundles int   // bundles in the mirror for the patch
+	Copied  int   // of those, how many were added this run
+	Size    int64 // bytes of the patch's files in the mirror
+}
+
+// Mirror downloads a patch's index and bundles through the cache and lays
+// them out under opts.Dir exactly as the CDN does, so any static file
+// server can serve the directory to --cdn-url. Files are hard linked from
+// the cache where possible and copied otherwise; files already in the
+// mirror are kept.
+func Mirror(ctx context.Context, cfg *config.Config, opts MirrorOptions) (*MirrorStats, error) {
+	if cfg.LocalSource() {
+		return nil, fmt.Errorf("mirror downloads from the CDN and cannot read --ggpk or --game-dir")
+	}
+	if opts.Dir == "" {
+		return nil, fmt.Errorf("mirror needs an output directory")
+	}
+	if opts.ForceDownload && cfg.Offline {
+		return nil, fmt.Errorf("force downloads again and cannot be combined with offline")
+	}
+	gameVersion, err := poe.ParseGameVersion(cfg.Patch)
+	if err != nil {
+		return nil, fmt.Errorf("parsing game version: %w", err)
+	}
+
+	src, err := resolveSource(ctx, cfg, gameVersion, opts.ForceDownload)
+	if err != nil {
+		return nil, err
+	}
+	defer src.bundleSource.Close()
+	index, err := bundle.LoadIndex(src.bundleSource)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := selectBundles(index.Bundles(), opts.Bundles)
+	if err != nil {
+		return nil, err
+	}
+	progress := func() func(int, int, string) { return func(int, int, string) {} }
+	if opts.Progress != nil {
+		progress = opts.Progress
+	}
+	if err := cdn.DownloadBundles(ctx, src.cache, cfg.Patch, gameVersion, names, opts.ForceDownload, progress()); err != nil {
+		return nil, err
+	}
+
+	root := filepath.Join(opts.Dir, cfg.Patch, "Bundles2")
+	slog.Info("Mirroring patch", "patch", cfg.Patch, "bundles", len(names), "destination", root)
+
+	stats := &MirrorStats{Bundles: len(names)}
+	size, _, err := mirrorFile(src.cache.IndexPath(cfg.Patch), filepath.Join(root, "_.index.bin"), opts.ForceDownload)
+	if err != nil {
+		return nil, err
+	}
+	stats.Size += size
+
+	report := progress()
+	for i, name := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		dest := filepath.Join(root, filepath.FromSlash(name)+".bundle.bin")
+		size, copied, err := mirrorFile(src.cache.BundlePath(cfg.Patch, name), dest, opts.ForceDownload)
+		if err != nil {
+			return nil, err
+		}
+		stats.Size += size
+		if copied {
+			stats.Copied++
+		}
+		report(i+1, len(names), name)
+	}
+	return stats, nil
+}
+
+// selectBundles picks the bundles whose names match terms, keeping the
+// index's order. Every term must match at least one bundle.
+func selectBundles(bundles []bundle.BundleEntry, terms []string) ([]string, error) {
+	var names []string
+	matched := make([]bool, len(terms))
+	for _, b := range bundles {
+		keep := len(terms) == 0
+		for i, term := range terms {
+			if ok, err := path.Match(term, b.Name); err != nil {
+				return nil, fmt.Errorf("invalid bundle pattern %q: %w", term, err)
+			} else if ok {
+				matched[i] = true
+				keep = true
+			}
+		}
+		if keep {
+			names = append(names, b.Name)
+		}
+	}
+
+	var unmatched []string
+	for i, ok := range matched {
+		if !ok {
+			unmatched = append(unmatched, terms[i])
+		}
+	}
+	if len(unmatched) > 0 {
+		return nil, fmt.Errorf("no bundles match %s", strings.Join(unmatched, ", "))
+	}
+	return names, nil
+}
+
+// mirrorFile places the cached file from at dest, unless dest already is
+// that file, linked by an earlier mirror, or a copy of it, and force is not
+// set. It returns the file's size and whether it was placed.
+func mirrorFile(from, dest string, force bool) (int64, bool, error) {
+	info, err := os.Stat(from)
+	if err != nil {
+		return 0, false, fmt.Errorf("reading cached file: %w", err)
+	}
+	if existing, err := os.Stat(dest); err == nil && !force {
+		current, err := sameFile(from, dest, info, existing)
+		if err != nil {
+			return 0, false, err
+		}
+		if current {
+			return info.Size(), false, nil
+		}
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, false, fmt.Errorf("checking mirror: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return 0, false, fmt.Errorf("creating mirror directory: %w", err)
+	}
+	tmp := dest + ".tmp"
+	os.Remove(tmp)
+	if err := os.Link(from, tmp); err != nil {
+		if err := copyFile(from, tmp); err != nil {
+			os.Remove(tmp)
+			return 0, false, err
+		}
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		os.Remove(tmp)
+		return 0, false, fmt.Errorf("moving %s into the mirror: %w", dest, err)
+	}
+	return info.Size(), true, nil
+}
+
+// sameFile reports whether the files at a and b, described by aInfo and
+// bInfo, are one file or hold the same bytes.
+func sameFile(a, b string, aInfo, bInfo fs.FileInfo) (bool, error) {
+	if os.SameFile(aInfo, bInfo) {
+		return true, nil
+	}
+	if aInfo.Size() != bInfo.Size() {
+		return false, nil
+	}
+
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, fmt.Errorf("reading cached file: %w", err)
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, fmt.Errorf("checking mirror: %w", err)
+	}
+	defer fb.Close()
+
+	bufA, bufB := make([]byte, 64<<10), make([]byte, 64<<10)
+	for {
+		n, errA := io.ReadFull(fa, bufA)
+		m, errB := io.ReadFull(fb, bufB)
+		if !bytes.Equal(bufA[:n], bufB[:m]) {
+			return false, nil
+		}
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			return errB == errA, nil
+		}
+		if errA != nil {
+			return false, fmt.Errorf("reading cached file: %w", errA)
+		}
+		if errB != nil {
+			return false, fmt.Errorf("checking mirror: %w", errB)
+		}
+	}
+}
+
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return fmt.Errorf("reading cached file: %w", err)
+	}
+	defer in.Close()
+	out, err := os.Create(to)
+	if err != nil {
+		return fmt.Errorf("writing mirror file: %w", err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("copying %s into the mirror: %w", from, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("writing mirror file: %w", err)
+	}
+	return nil
+}
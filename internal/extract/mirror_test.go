@@ -0,0 +1,65 @@
+package extract
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMirrorFile(t *testing.T) {
+	dir := t.TempDir()
+	from := filepath.Join(dir, "cache", "bundle")
+	if err := os.MkdirAll(filepath.Dir(from), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(from, []byte("bundle data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		existing string // dest's contents, or "link" for a link to from
+		force    bool
+		copied   bool
+	}{
+		{name: "missing", copied: true},
+		{name: "linked", existing: "link"},
+		{name: "same contents", existing: "bundle data"},
+		{name: "same size", existing: "bundle date", copied: true},
+		{name: "other size", existing: "bundle", copied: true},
+		{name: "forced", existing: "bundle data", force: true, copied: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := filepath.Join(dir, "mirror", tt.name, "bundle.bin")
+			switch tt.existing {
+			case "":
+			case "link":
+				if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Link(from, dest); err != nil {
+					t.Skipf("hard links unsupported: %v", err)
+				}
+			default:
+				if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(dest, []byte(tt.existing), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			size, copied, err := mirrorFile(from, dest, tt.force)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size != int64(len("bundle data")) || copied != tt.copied {
+				t.Errorf("mirrorFile = %d, %v; want %d, %v", size, copied, len("bundle data"), tt.copied)
+			}
+			if data, err := os.ReadFile(dest); err != nil || string(data) != "bundle data" {
+				t.Errorf("mirrored file = %q, %v", data, err)
+			}
+		})
+	}
+}
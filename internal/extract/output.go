@@ -0,0 +1,44 @@
+package extract
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/jchantrell/exiledb/internal/config"
+	"github.com/jchantrell/exiledb/internal/dat"
+	"github.com/jchantrell/exiledb/internal/database"
+	"github.com/jchantrell/exiledb/internal/output"
+)
+
+// planFiles plans every table for file output. Files carry no state between
+// runs, so there is nothing to reconcile: each written file replaces the
+// previous one.
+func planFiles(cfg *config.Config, schemas []dat.TableSchema, multiPatch bool) ([]tableWork, error) {
+	plans, err := database.Plan(schemas, database.PlanOptions{MultiPatch: multiPatch})
+	if err != nil {
+		return nil, fmt.Errorf("planning tables: %w", err)
+	}
+
+	work := make([]tableWork, len(plans))
+	for i, plan := range plans {
+		work[i] = tableWork{schema: &schemas[i], plan: plan, languages: cfg.Languages}
+	}
+	return work, nil
+}
+
+// writeTableFiles writes one file per table and language under opts.OutDir.
+func writeTableFiles(ctx context.Context, cfg *config.Config, files datFiles, opts Options, stats *Stats, work []tableWork) error {
+	slog.Info("Writing table files", "count", len(work), "format", opts.Format, "dir", opts.OutDir)
+
+	return writeTables(ctx, cfg, files, opts, stats, work, func(job *parseJob, res *parseResult) (int, error) {
+		path := output.Path(opts.OutDir, opts.Format, job.work.plan, job.language)
+		slog.Debug("Writing table file", "path", path, "table", job.work.schema.Name)
+		return output.WriteTable(opts.Format, path, &output.Table{
+			Plan:     job.work.plan,
+			Language: job.language,
+			Patch:    cfg.Patch,
+			Rows:     res.rows,
+		})
+	})
+}
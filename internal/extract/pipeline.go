@@ -0,0 +1,265 @@
+package extract
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"runtime"
+	"sync"
+
+	"github.com/jchantrell/exiledb/internal/dat"
+)
+
+// pipelineBatchSize is how many rows a worker decodes into each batch, the
+// batch size every writer reads with.
+const pipelineBatchSize = 1024
+
+// streamDepth is how many decoded batches of one file may wait for the
+// writer before its worker blocks.
+const streamDepth = 2
+
+// datFiles is where the pipeline reads dat files from: the bundle manager in
+// an extract.
+type datFiles interface {
+	FileExists(path string) bool
+	GetFile(path string) ([]byte, error)
+}
+
+// parseJob is one (table, language) dat file to fetch and decode.
+type parseJob struct {
+	work     *tableWork
+	language string
+	last     bool // final job of its table
+}
+
+// parseResult is the outcome of one parseJob. A missing file is not an
+// error: not every table exists in every language. Rows arrive on rows as
+// the worker decodes them.
+type parseResult struct {
+	path     string
+	size     int
+	sha256   string
+	rows     *batchStream
+	missing  bool
+	fetchErr error
+	parseErr error
+}
+
+func parseJobs(work []tableWork) []parseJob {
+	var jobs []parseJob
+	for i := range work {
+		for j, language := range work[i].languages {
+			jobs = append(jobs, parseJob{
+				work:     &work[i],
+				language: language,
+				last:     j == len(work[i].languages)-1,
+			})
+		}
+	}
+	return jobs
+}
+
+// parsePipeline fetches, decompresses and decodes jobs on a bounded pool of
+// workers while the caller writes results in job order. Each job's result
+// arrives on its own channel, so workers finish in any order without
+// reordering the writer. A worker sends a job's result as soon as the file
+// is validated, then decodes its rows into batches the writer reads from the
+// result while the worker fills the next, so decoding and writing overlap.
+// Jobs are only dispatched while an in-flight slot is free and the writer
+// frees a slot per result consumed; with at most streamDepth batches
+// waiting per file, that bounds how much sits in memory waiting for the
+// writer.
+type parsePipeline struct {
+	results []chan parseResult
+	slots   chan struct{}
+	stop    chan struct{}
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func startParsePipeline(ctx context.Context, patch string, files datFiles, jobs []parseJob) *parsePipeline {
+	ctx, cancel := context.WithCancel(ctx)
+	workers := runtime.GOMAXPROCS(0)
+	p := &parsePipeline{
+		results: make([]chan parseResult, len(jobs)),
+		slots:   make(chan struct{}, 2*workers),
+		stop:    make(chan struct{}),
+		cancel:  cancel,
+	}
+	for i := range p.results {
+		p.results[i] = make(chan parseResult, 1)
+	}
+
+	dispatch := make(chan int)
+	go func() {
+		defer close(dispatch)
+		for i := range jobs {
+			select {
+			case p.slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case dispatch <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	p.wg.Add(workers)
+	for range workers {
+		go func() {
+			defer p.wg.Done()
+			for i := range dispatch {
+				res, reader := parseDatFile(patch, files, &jobs[i])
+				p.results[i] <- res
+				if reader != nil {
+					res.rows.fill(reader, p.stop)
+				}
+			}
+		}()
+	}
+
+	return p
+}
+
+// next waits for job i's result and frees its in-flight slot. Results must
+// be consumed in job order, and each result's rows closed once written.
+func (p *parsePipeline) next(ctx context.Context, i int) (parseResult, error) {
+	select {
+	case res := <-p.results[i]:
+		<-p.slots
+		return res, nil
+	case <-ctx.Done():
+		return parseResult{}, ctx.Err()
+	}
+}
+
+// Close stops dispatching and decoding and waits for in-flight jobs, so no
+// worker still reads from the bundle manager once it returns.
+func (p *parsePipeline) Close() {
+	p.cancel()
+	close(p.stop)
+	p.wg.Wait()
+}
+
+// parseDatFile fetches and validates a job's file. The returned reader, nil
+// unless the result has rows, is for the worker to fill them from.
+func parseDatFile(patch string, files datFiles, job *parseJob) (parseResult, *dat.RowReader) {
+	schema := job.work.schema
+	path, ok := resolveDatPath(patch, schema.Name, job.language, files.FileExists)
+	if !ok {
+		return parseResult{missing: true}, nil
+	}
+
+	slog.Debug("Processing DAT file", "path", path, "table", schema.Name)
+
+	data, err := files.GetFile(path)
+	if err != nil {
+		return parseResult{path: path, fetchErr: err}, nil
+	}
+
+	sum := sha256.Sum256(data)
+	res := parseResult{path: path, size: len(data), sha256: hex.EncodeToString(sum[:])}
+	// A multi-patch table has every column of the full table; those patch
+	// does not have are not in its files and read as null.
+	layout := schema.MaskForPatch(patch)
+	reader, err := dat.NewRowReader(data, &layout)
+	if err != nil {
+		res.parseErr = err
+		return res, nil
+	}
+	res.rows = newBatchStream(reader)
+	return res, reader
+}
+
+// batchStream hands one file's rows from the worker decoding them to the
+// writer, a batch at a time. Batches are swapped rather than copied: the
+// writer's batch goes back to the worker to decode into next. After Rewind
+// the writer decodes the rows itself.
+type batchStream struct {
+	reader  *dat.RowReader // the worker's until rewound
+	rewound bool
+	rows    int
+	batches chan *dat.Batch
+	free    chan *dat.Batch
+	done    chan struct{}
+	close   sync.Once
+}
+
+func newBatchStream(reader *dat.RowReader) *batchStream {
+	return &batchStream{
+		reader:  reader,
+		rows:    reader.Len(),
+		batches: make(chan *dat.Batch, streamDepth),
+		// Besides those queued, one batch is being filled and one read.
+		free: make(chan *dat.Batch, streamDepth+2),
+		done: make(chan struct{}),
+	}
+}
+
+// fill decodes every row of reader into the stream, stopping early if the
+// writer closes the stream or stop is closed.
+func (s *batchStream) fill(reader *dat.RowReader, stop <-chan struct{}) {
+	defer close(s.batches)
+	for {
+		var b *dat.Batch
+		select {
+		case b = <-s.free:
+		default:
+			b = reader.NewBatch()
+		}
+		if reader.ReadBatch(b, pipelineBatchSize) == 0 {
+			return
+		}
+		select {
+		case s.batches <- b:
+		case <-s.done:
+			return
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Len returns the total number of rows in the file.
+func (s *batchStream) Len() int {
+	return s.rows
+}
+
+func (s *batchStream) NewBatch() *dat.Batch {
+	return s.reader.NewBatch()
+}
+
+// ReadBatch replaces b with the next decoded batch and returns its length, 0
+// once every row has been read. Batches hold pipelineBatchSize rows
+// whatever max is, as the worker decodes ahead of the call.
+func (s *batchStream) ReadBatch(b *dat.Batch, max int) int {
+	if s.rewound {
+		return s.reader.ReadBatch(b, max)
+	}
+	next, ok := <-s.batches
+	if !ok {
+		return 0
+	}
+	*b, *next = *next, *b
+	s.free <- next
+	return b.Len
+}
+
+// Rewind starts reading again from the first row. It waits for the worker to
+// finish with the reader, discarding any batches not yet read.
+func (s *batchStream) Rewind() {
+	for range s.batches {
+	}
+	s.reader.Rewind()
+	s.rewound = true
+}
+
+// Close releases the worker if rows are left unread. It is safe to call more
+// than once.
+func (s *batchStream) Close() {
+	s.close.Do(func() { close(s.done) })
+}
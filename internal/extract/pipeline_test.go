@@ -0,0 +1,255 @@
+package extract
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jchantrell/exiledb/internal/dat"
+	"github.com/jchantrell/exiledb/internal/poe"
+)
+
+const testPatch = "3.25.0"
+
+// fakeFiles serves dat files from memory. GetFile of a path in gates blocks
+// until its channel is closed.
+type fakeFiles struct {
+	files map[string][]byte
+	gates map[string]chan struct{}
+
+	mu    sync.Mutex
+	reads []string
+}
+
+func (f *fakeFiles) FileExists(path string) bool {
+	_, ok := f.files[path]
+	return ok
+}
+
+func (f *fakeFiles) GetFile(path string) ([]byte, error) {
+	if gate, ok := f.gates[path]; ok {
+		<-gate
+	}
+	f.mu.Lock()
+	f.reads = append(f.reads, path)
+	f.mu.Unlock()
+	return f.files[path], nil
+}
+
+func datPath(table, language string) string {
+	if language == "English" {
+		return poe.DatPath(testPatch, table, poe.DatExtension)
+	}
+	return poe.DatLangPath(testPatch, language, table, poe.DatExtension)
+}
+
+// int32Dat encodes a dat file of one i32 column.
+func int32Dat(values []int32) []byte {
+	data := binary.LittleEndian.AppendUint32(nil, uint32(len(values)))
+	for _, v := range values {
+		data = binary.LittleEndian.AppendUint32(data, uint32(v))
+	}
+	return append(data, dat.BoundaryMarker...)
+}
+
+// int32RowsDat encodes a dat file whose rows are each of i32 columns.
+func int32RowsDat(rows ...[]int32) []byte {
+	data := binary.LittleEndian.AppendUint32(nil, uint32(len(rows)))
+	for _, row := range rows {
+		for _, v := range row {
+			data = binary.LittleEndian.AppendUint32(data, uint32(v))
+		}
+	}
+	return append(data, dat.BoundaryMarker...)
+}
+
+// int32Table returns a schema of one i32 column named Value.
+func int32Table(name string) dat.TableSchema {
+	value := "Value"
+	return dat.TableSchema{Name: name, Columns: []dat.TableColumn{{Name: &value, Type: dat.TypeInt32}}}
+}
+
+// readValues reads every row of a result's single i32 column.
+func readValues(t *testing.T, res *parseResult) []int32 {
+	t.Helper()
+	var values []int32
+	b := res.rows.NewBatch()
+	for n := res.rows.ReadBatch(b, pipelineBatchSize); n > 0; n = res.rows.ReadBatch(b, pipelineBatchSize) {
+		if b.Start != len(values) {
+			t.Fatalf("batch starts at row %d, want %d", b.Start, len(values))
+		}
+		for row := range n {
+			values = append(values, int32(b.Columns[0].Ints[row]))
+		}
+	}
+	return values
+}
+
+// TestParsePipelineOrder gives jobs of very different sizes, so workers
+// finish out of order, and checks the writer still sees every job in order
+// with all of its rows.
+func TestParsePipelineOrder(t *testing.T) {
+	sizes := []int{3 * pipelineBatchSize, 1, 0, pipelineBatchSize + 7, 5, 2*pipelineBatchSize - 1}
+	files := &fakeFiles{files: map[string][]byte{
+		datPath("Broken", "English"): {1, 0, 0, 0, 9},
+	}}
+	var work []tableWork
+	want := make(map[string][]int32)
+	for i, size := range sizes {
+		schema := int32Table(fmt.Sprintf("Table%d", i))
+		for _, language := range []string{"English", "French"} {
+			values := make([]int32, size)
+			for j := range values {
+				values[j] = int32(i*100000 + j)
+			}
+			if language == "French" {
+				values = values[:size/2]
+			}
+			files.files[datPath(schema.Name, language)] = int32Dat(values)
+			want[schema.Name+"/"+language] = values
+		}
+		work = append(work, tableWork{schema: &schema, languages: []string{"English", "French"}})
+	}
+	missing := int32Table("Missing")
+	broken := int32Table("Broken")
+	work = append(work,
+		tableWork{schema: &missing, languages: []string{"English"}},
+		tableWork{schema: &broken, languages: []string{"English"}},
+	)
+
+	jobs := parseJobs(work)
+	if len(jobs) != 2*len(sizes)+2 || !jobs[1].last || jobs[0].last {
+		t.Fatalf("parseJobs = %d jobs, want %d with the last of each table marked", len(jobs), 2*len(sizes)+2)
+	}
+
+	ctx := context.Background()
+	p := startParsePipeline(ctx, testPatch, files, jobs)
+	defer p.Close()
+	for i := range jobs {
+		job := &jobs[i]
+		res, err := p.next(ctx, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key := job.work.schema.Name + "/" + job.language
+		switch job.work.schema.Name {
+		case "Missing":
+			if !res.missing {
+				t.Errorf("%s: result = %+v, want missing", key, res)
+			}
+			continue
+		case "Broken":
+			if res.parseErr == nil {
+				t.Errorf("%s: result = %+v, want a parse error", key, res)
+			}
+			continue
+		}
+		if res.parseErr != nil || res.fetchErr != nil || res.path != datPath(job.work.schema.Name, job.language) {
+			t.Fatalf("%s: result = %+v", key, res)
+		}
+		if res.rows.Len() != len(want[key]) {
+			t.Errorf("%s: Len = %d, want %d", key, res.rows.Len(), len(want[key]))
+		}
+		got := readValues(t, &res)
+		if len(got) != len(want[key]) {
+			t.Fatalf("%s: read %d rows, want %d", key, len(got), len(want[key]))
+		}
+		for j := range got {
+			if got[j] != want[key][j] {
+				t.Fatalf("%s: row %d = %d, want %d", key, j, got[j], want[key][j])
+			}
+		}
+		res.rows.Close()
+	}
+}
+
+// TestParsePipelineCancel cancels the writer while it waits for a job and
+// leaves decoded rows unread, then checks Close returns without leaving
+// workers blocked, and that jobs past the in-flight bound were never
+// fetched.
+func TestParsePipelineCancel(t *testing.T) {
+	files := &fakeFiles{files: map[string][]byte{}, gates: map[string]chan struct{}{}}
+	var work []tableWork
+	for i := range 200 {
+		schema := int32Table(fmt.Sprintf("Table%d", i))
+		files.files[datPath(schema.Name, "English")] = int32Dat(make([]int32, (streamDepth+2)*pipelineBatchSize))
+		work = append(work, tableWork{schema: &schema, languages: []string{"English"}})
+	}
+	gate := make(chan struct{})
+	files.gates[datPath("Table1", "English")] = gate
+	jobs := parseJobs(work)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := startParsePipeline(ctx, testPatch, files, jobs)
+
+	// Job 0's rows are left unread, so its worker blocks on a full stream.
+	if _, err := p.next(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error)
+	go func() {
+		_, err := p.next(ctx, 1)
+		errs <- err
+	}()
+	cancel()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("next after cancel = %v, want context.Canceled", err)
+	}
+	close(gate)
+
+	closed := make(chan struct{})
+	go func() {
+		p.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Close did not return")
+	}
+
+	files.mu.Lock()
+	defer files.mu.Unlock()
+	if limit := 1 + cap(p.slots); len(files.reads) > limit {
+		t.Errorf("%d files fetched, want at most %d in flight", len(files.reads), limit)
+	}
+}
+
+// TestBatchStreamRewind rewinds a stream partway through and checks every
+// row is read again, now decoded by the reader.
+func TestBatchStreamRewind(t *testing.T) {
+	values := make([]int32, 3*pipelineBatchSize+5)
+	for i := range values {
+		values[i] = int32(i)
+	}
+	schema := int32Table("Table")
+	reader, err := dat.NewRowReader(int32Dat(values), &schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := newBatchStream(reader)
+	defer stream.Close()
+	go stream.fill(reader, nil)
+
+	for pass := range 3 {
+		if pass == 0 {
+			b := stream.NewBatch()
+			if n := stream.ReadBatch(b, pipelineBatchSize); n != pipelineBatchSize || b.Start != 0 {
+				t.Fatalf("first batch = %d rows from %d", n, b.Start)
+			}
+		}
+		stream.Rewind()
+		got := readValues(t, &parseResult{rows: stream})
+		if len(got) != len(values) {
+			t.Fatalf("pass %d: read %d rows after Rewind, want %d", pass, len(got), len(values))
+		}
+		for i := range got {
+			if got[i] != values[i] {
+				t.Fatalf("pass %d: row %d = %d, want %d", pass, i, got[i], values[i])
+			}
+		}
+	}
+}
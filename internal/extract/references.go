@@ -0,0 +1,124 @@
+package extract
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/jchantrell/exiledb/internal/config"
+	"github.com/jchantrell/exiledb/internal/dat"
+	"github.com/jchantrell/exiledb/internal/poe"
+)
+
+// AllReferences is the Options.WithReferences depth that follows references
+// until no new table is reached.
+const AllReferences = -1
+
+// SelectedTable is one table an extract selects: a table --tables picked, or
+// one a picked table references, directly or through others.
+type SelectedTable struct {
+	Name string
+
+	// Via is the table and column whose reference pulled the table in, as
+	// Mods.StatsKey1, and Depth the number of references followed from a
+	// picked table. Both are zero for tables --tables picked.
+	Via   string
+	Depth int
+}
+
+// SelectTables resolves the tables an extract with opts would write, in
+// schema order, without downloading anything beyond the schema.
+func SelectTables(ctx context.Context, cfg *config.Config, opts Options) ([]SelectedTable, error) {
+	if len(cfg.Tables) == 0 {
+		return nil, fmt.Errorf("no tables selected: use --tables")
+	}
+	gameVersion, err := poe.ParseGameVersion(cfg.Patch)
+	if err != nil {
+		return nil, fmt.Errorf("parsing game version: %w", err)
+	}
+	schema, err := loadCommunitySchema(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("loading community schema: %w", err)
+	}
+	_, selected, err := selectTables(patchTables(schema.GetValidTables(gameVersion), cfg.Patch, opts.MultiPatch), cfg.Tables, opts.WithReferences)
+	return selected, err
+}
+
+// patchTables resolves the tables to extract for patch. Columns the schema
+// marks as removed by patch are not in its files, so a single-patch table
+// leaves them out. A multi-patch table keeps every column, so each patch
+// extracted into it plans the same layout; the pipeline decodes each file
+// with its patch's columns and writes null for the rest.
+func patchTables(tables []dat.TableSchema, patch string, multiPatch bool) []dat.TableSchema {
+	if multiPatch {
+		return tables
+	}
+	return dat.TablesForPatch(tables, patch)
+}
+
+// selectTables applies the --tables selector and then follows references
+// from the tables it picks up to depth, 0 meaning not at all.
+func selectTables(validTables []dat.TableSchema, configuredTables []string, depth int) ([]dat.TableSchema, []SelectedTable, error) {
+	tables, err := filterTables(validTables, configuredTables)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byName := make(map[string]int, len(validTables))
+	for i := range validTables {
+		byName[poe.ToSnakeCase(validTables[i].Name)] = i
+	}
+	found := make(map[int]SelectedTable, len(tables))
+	queue := make([]int, 0, len(tables))
+	for i := range tables {
+		index := byName[poe.ToSnakeCase(tables[i].Name)]
+		found[index] = SelectedTable{Name: tables[i].Name}
+		queue = append(queue, index)
+	}
+
+	for len(queue) > 0 {
+		index := queue[0]
+		queue = queue[1:]
+		from := found[index]
+		if depth != AllReferences && from.Depth >= depth {
+			continue
+		}
+		table := &validTables[index]
+		for i := range table.Columns {
+			column := &table.Columns[i]
+			// Enumerations are not tables; their lookup tables are written
+			// alongside whichever tables reference them.
+			if column.References == nil || column.References.Table == "" || column.Type == dat.TypeEnumRow {
+				continue
+			}
+			target, ok := byName[poe.ToSnakeCase(column.References.Table)]
+			if !ok {
+				slog.Debug("Referenced table not in schema", "table", table.Name, "references", column.References.Table)
+				continue
+			}
+			if _, ok := found[target]; ok {
+				continue
+			}
+			found[target] = SelectedTable{
+				Name:  validTables[target].Name,
+				Via:   table.Name + "." + dat.FieldName(column, i),
+				Depth: from.Depth + 1,
+			}
+			queue = append(queue, target)
+		}
+	}
+
+	if len(found) > len(tables) {
+		slog.Info("Including referenced tables", "requested", len(tables), "referenced", len(found)-len(tables))
+	}
+
+	tables = tables[:0:0]
+	selected := make([]SelectedTable, 0, len(found))
+	for i := range validTables {
+		if s, ok := found[i]; ok {
+			tables = append(tables, validTables[i])
+			selected = append(selected, s)
+		}
+	}
+	return tables, selected, nil
+}
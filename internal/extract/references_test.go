@@ -0,0 +1,134 @@
+package extract
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jchantrell/exiledb/internal/dat"
+)
+
+func TestSelectTables(t *testing.T) {
+	name := func(s string) *string { return &s }
+	ref := func(table string) *dat.ColumnReference { return &dat.ColumnReference{Table: table} }
+	// Mods and Stats reference each other, and StatFamilies itself.
+	// ModDomains is also an enumeration, which enumrow columns reference.
+	schema := []dat.TableSchema{
+		{Name: "Mods", Columns: []dat.TableColumn{
+			{Name: name("Stat"), Type: dat.TypeForeignRow, References: ref("Stats")},
+			{Name: name("Domain"), Type: dat.TypeEnumRow, References: ref("ModDomains")},
+			{Name: name("Tags"), Type: dat.TypeForeignRow, Array: true, References: ref("Tags")},
+			{Name: name("Gone"), Type: dat.TypeForeignRow, References: ref("Removed")},
+		}},
+		{Name: "Stats", Columns: []dat.TableColumn{
+			{Name: name("Mod"), Type: dat.TypeForeignRow, References: ref("Mods")},
+			{Name: name("Family"), Type: dat.TypeRow, References: ref("StatFamilies")},
+		}},
+		{Name: "Tags", Columns: []dat.TableColumn{
+			{Name: name("Id"), Type: dat.TypeString},
+		}},
+		{Name: "StatFamilies", Columns: []dat.TableColumn{
+			{Name: name("Parent"), Type: dat.TypeRow, References: ref("StatFamilies")},
+			{Type: dat.TypeForeignRow, References: ref("Icons")},
+		}},
+		{Name: "Icons", Columns: []dat.TableColumn{
+			{Name: name("Path"), Type: dat.TypeString},
+		}},
+		{Name: "ModDomains", Columns: []dat.TableColumn{
+			{Name: name("Id"), Type: dat.TypeString},
+		}},
+		{Name: "Unrelated", Columns: []dat.TableColumn{
+			{Name: name("Mod"), Type: dat.TypeForeignRow, References: ref("Mods")},
+		}},
+	}
+
+	picked := func(name string) SelectedTable { return SelectedTable{Name: name} }
+	tests := []struct {
+		name   string
+		tables []string
+		depth  int
+		want   []SelectedTable
+	}{
+		{
+			name:   "no references",
+			tables: []string{"Mods"},
+			depth:  0,
+			want:   []SelectedTable{picked("Mods")},
+		},
+		{
+			name:   "direct references",
+			tables: []string{"Mods"},
+			depth:  1,
+			want: []SelectedTable{
+				picked("Mods"),
+				{Name: "Stats", Via: "Mods.Stat", Depth: 1},
+				{Name: "Tags", Via: "Mods.Tags", Depth: 1},
+			},
+		},
+		{
+			name:   "depth two",
+			tables: []string{"Mods"},
+			depth:  2,
+			want: []SelectedTable{
+				picked("Mods"),
+				{Name: "Stats", Via: "Mods.Stat", Depth: 1},
+				{Name: "Tags", Via: "Mods.Tags", Depth: 1},
+				{Name: "StatFamilies", Via: "Stats.Family", Depth: 2},
+			},
+		},
+		{
+			name:   "all references",
+			tables: []string{"Mods"},
+			depth:  AllReferences,
+			want: []SelectedTable{
+				picked("Mods"),
+				{Name: "Stats", Via: "Mods.Stat", Depth: 1},
+				{Name: "Tags", Via: "Mods.Tags", Depth: 1},
+				{Name: "StatFamilies", Via: "Stats.Family", Depth: 2},
+				{Name: "Icons", Via: "StatFamilies.Unknown1", Depth: 3},
+			},
+		},
+		{
+			name:   "around the cycle",
+			tables: []string{"Stats"},
+			depth:  AllReferences,
+			want: []SelectedTable{
+				{Name: "Mods", Via: "Stats.Mod", Depth: 1},
+				picked("Stats"),
+				{Name: "Tags", Via: "Mods.Tags", Depth: 2},
+				{Name: "StatFamilies", Via: "Stats.Family", Depth: 1},
+				{Name: "Icons", Via: "StatFamilies.Unknown1", Depth: 2},
+			},
+		},
+		{
+			name:   "picked tables are not pulled in",
+			tables: []string{"Mods", "Stats"},
+			depth:  1,
+			want: []SelectedTable{
+				picked("Mods"),
+				picked("Stats"),
+				{Name: "Tags", Via: "Mods.Tags", Depth: 1},
+				{Name: "StatFamilies", Via: "Stats.Family", Depth: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tables, selected, err := selectTables(schema, tt.tables, tt.depth)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(selected, tt.want) {
+				t.Errorf("selected = %+v, want %+v", selected, tt.want)
+			}
+			if len(tables) != len(selected) {
+				t.Fatalf("%d tables for %d selected", len(tables), len(selected))
+			}
+			for i := range tables {
+				if tables[i].Name != selected[i].Name {
+					t.Errorf("table %d = %s, want %s", i, tables[i].Name, selected[i].Name)
+				}
+			}
+		})
+	}
+}
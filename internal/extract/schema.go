@@ -0,0 +1,209 @@
+package extract
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jchantrell/exiledb/internal/cache"
+	"github.com/jchantrell/exiledb/internal/cdn"
+	"github.com/jchantrell/exiledb/internal/config"
+	"github.com/jchantrell/exiledb/internal/dat"
+)
+
+// loadCommunitySchema loads the schema cfg asks for: the local file given
+// with --schema, the archived schema --schema-version or --schema-at pins,
+// or else the latest release, revalidated against the cached copy so an
+// unchanged schema is not downloaded again. Every schema used is archived
+// by its creation time for later pinning.
+func loadCommunitySchema(ctx context.Context, cfg *config.Config) (*dat.CommunitySchema, error) {
+	if cfg.SchemaPath != "" {
+		slog.Info("Using local schema", "path", cfg.SchemaPath)
+		return parseSchemaFile(cfg.SchemaPath)
+	}
+
+	c, err := cache.New()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.SchemaVersion != 0 || cfg.SchemaAt != "" {
+		return loadPinnedSchema(ctx, c, cfg)
+	}
+
+	if cdn.Offline() {
+		if _, err := os.Stat(c.SchemaPath()); err != nil {
+			missing := &cdn.MissingError{}
+			missing.Add("schema (or pass --schema)", c.SchemaPath())
+			return nil, missing
+		}
+	} else if err := refreshSchema(ctx, c); err != nil {
+		return nil, err
+	}
+
+	schema, err := parseSchemaFile(c.SchemaPath())
+	if err != nil {
+		return nil, err
+	}
+	logSchema("Using schema", schema.SchemaMetadata)
+	if err := archiveSchema(c, schema.SchemaMetadata); err != nil {
+		slog.Warn("Failed to archive schema", "error", err)
+	}
+	return schema, nil
+}
+
+// refreshSchema brings the cached schema up to date with the latest
+// release, downloading it only if it changed since the cached copy.
+func refreshSchema(ctx context.Context, c *cache.Cache) error {
+	if err := os.MkdirAll(c.Dir(), 0755); err != nil {
+		return fmt.Errorf("creating schema cache directory: %w", err)
+	}
+
+	var cached cdn.Validators
+	if _, err := os.Stat(c.SchemaPath()); err == nil {
+		if data, err := os.ReadFile(c.SchemaValidatorsPath()); err == nil {
+			if err := json.Unmarshal(data, &cached); err != nil {
+				slog.Debug("Ignoring unreadable schema validators", "error", err)
+				cached = cdn.Validators{}
+			}
+		}
+	}
+
+	validators, modified, err := cdn.DownloadIfModified(ctx, dat.CommunitySchemaURL, c.SchemaPath(), cached)
+	if err != nil {
+		return fmt.Errorf("downloading schema: %w", err)
+	}
+	if !modified {
+		slog.Debug("Cached schema is up to date")
+		return nil
+	}
+
+	data, err := json.Marshal(validators)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(c.SchemaValidatorsPath(), data, 0644); err != nil {
+		slog.Debug("Failed to record schema validators", "error", err)
+	}
+	return nil
+}
+
+// loadPinnedSchema loads the newest archived schema matching the pins. If
+// none does, the latest release is fetched in case it is the one wanted.
+func loadPinnedSchema(ctx context.Context, c *cache.Cache, cfg *config.Config) (*dat.CommunitySchema, error) {
+	at, err := config.ParseSchemaAt(cfg.SchemaAt)
+	if err != nil {
+		return nil, err
+	}
+
+	pinned, archived, err := pickArchivedSchema(c, cfg.SchemaVersion, at)
+	if err != nil {
+		return nil, err
+	}
+	if pinned == nil && !cdn.Offline() {
+		if err := refreshSchema(ctx, c); err != nil {
+			return nil, err
+		}
+		latest, err := parseSchemaFile(c.SchemaPath())
+		if err != nil {
+			return nil, err
+		}
+		if err := archiveSchema(c, latest.SchemaMetadata); err != nil {
+			return nil, fmt.Errorf("archiving schema: %w", err)
+		}
+		if pinned, archived, err = pickArchivedSchema(c, cfg.SchemaVersion, at); err != nil {
+			return nil, err
+		}
+	}
+	if pinned == nil {
+		var have []string
+		for _, s := range archived {
+			have = append(have, fmt.Sprintf("v%d %s", s.Version, s.CreatedAt.Format(time.RFC3339)))
+		}
+		if len(have) == 0 {
+			have = []string{"none"}
+		}
+		return nil, fmt.Errorf("no archived schema matches %s (archived: %s)", describePins(cfg), strings.Join(have, ", "))
+	}
+
+	schema, err := parseSchemaFile(pinned.Path)
+	if err != nil {
+		return nil, err
+	}
+	logSchema("Using pinned schema", schema.SchemaMetadata)
+	return schema, nil
+}
+
+// pickArchivedSchema returns the newest archived schema with the given
+// version, if not zero, created at or before at, if not zero, along with
+// everything archived.
+func pickArchivedSchema(c *cache.Cache, version int, at time.Time) (*cache.ArchivedSchema, []cache.ArchivedSchema, error) {
+	archived, err := c.ArchivedSchemas()
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, s := range archived {
+		if (version == 0 || s.Version == version) && (at.IsZero() || !s.CreatedAt.After(at)) {
+			return &archived[i], archived, nil
+		}
+	}
+	return nil, archived, nil
+}
+
+// archiveSchema copies the cached schema, described by meta, into the
+// archive unless it is there already.
+func archiveSchema(c *cache.Cache, meta dat.SchemaMetadata) error {
+	dest := c.SchemaArchivePath(meta.Version, meta.CreatedAt)
+	if _, err := os.Stat(dest); err == nil {
+		return nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(c.SchemaPath())
+	if err != nil {
+		return err
+	}
+	tmp := dest + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	logSchema("Archived schema", meta)
+	return nil
+}
+
+func parseSchemaFile(path string) (*dat.CommunitySchema, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening schema file %s: %w", path, err)
+	}
+	defer file.Close()
+	return dat.ParseCommunitySchema(file)
+}
+
+func logSchema(msg string, meta dat.SchemaMetadata) {
+	slog.Info(msg, "version", meta.Version, "created_at", time.Unix(int64(meta.CreatedAt), 0).UTC().Format(time.RFC3339))
+}
+
+func describePins(cfg *config.Config) string {
+	var pins []string
+	if cfg.SchemaVersion != 0 {
+		pins = append(pins, fmt.Sprintf("version %d", cfg.SchemaVersion))
+	}
+	if cfg.SchemaAt != "" {
+		pins = append(pins, "created at or before "+cfg.SchemaAt)
+	}
+	return strings.Join(pins, " and ")
+}
@@ -0,0 +1,97 @@
+package extract
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jchantrell/exiledb/internal/cache"
+	"github.com/jchantrell/exiledb/internal/cdn"
+	"github.com/jchantrell/exiledb/internal/config"
+)
+
+// archivedCache returns a cache in a temporary home holding an archived
+// schema for each (version, createdAt) pair.
+func archivedCache(t *testing.T, schemas ...[2]int) *cache.Cache {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	c, err := cache.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range schemas {
+		path := c.SchemaArchivePath(s[0], s[1])
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		data := `{"version":` + strconv.Itoa(s[0]) + `,"createdAt":` + strconv.Itoa(s[1]) + `,"tables":[{"validFor":3,"name":"Mods","columns":[{"name":"Id","type":"string"}]}],"enumerations":[]}`
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+func TestPickArchivedSchema(t *testing.T) {
+	day := func(d int) int { return int(time.Date(2026, 1, d, 12, 0, 0, 0, time.UTC).Unix()) }
+	c := archivedCache(t, [2]int{6, day(1)}, [2]int{7, day(10)}, [2]int{7, day(20)})
+
+	for _, tt := range []struct {
+		name    string
+		version int
+		at      string
+		want    int // createdAt of the pick, 0 for none
+	}{
+		{name: "version", version: 7, want: day(20)},
+		{name: "older version", version: 6, want: day(1)},
+		{name: "at", at: "2026-01-15", want: day(10)},
+		{name: "date is end of day", at: "2026-01-10", want: day(10)},
+		{name: "before the day", at: "2026-01-10T11:00:00Z", want: day(1)},
+		{name: "version and at", version: 7, at: "2026-01-09"},
+		{name: "missing version", version: 8},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			at, err := config.ParseSchemaAt(tt.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pinned, archived, err := pickArchivedSchema(c, tt.version, at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(archived) != 3 {
+				t.Errorf("archived = %d schemas, want 3", len(archived))
+			}
+			switch {
+			case tt.want == 0 && pinned != nil:
+				t.Errorf("picked %+v, want none", pinned)
+			case tt.want != 0 && (pinned == nil || pinned.CreatedAt.Unix() != int64(tt.want)):
+				t.Errorf("picked %+v, want the schema created at %d", pinned, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadPinnedSchemaOffline(t *testing.T) {
+	created := int(time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC).Unix())
+	c := archivedCache(t, [2]int{7, created})
+	cdn.SetOffline(true)
+	defer cdn.SetOffline(false)
+
+	schema, err := loadPinnedSchema(context.Background(), c, &config.Config{SchemaAt: "2026-01-10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.Version != 7 || schema.CreatedAt != created {
+		t.Errorf("pinned schema = v%d %d, want v7 %d", schema.Version, schema.CreatedAt, created)
+	}
+
+	_, err = loadPinnedSchema(context.Background(), c, &config.Config{SchemaVersion: 8})
+	if err == nil || !strings.Contains(err.Error(), "no archived schema matches version 8 (archived: v7 2026-01-10T00:00:00Z)") {
+		t.Errorf("loadPinnedSchema offline = %v, want no archived schema matches", err)
+	}
+}
@@ -0,0 +1,49 @@
+package extract
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/jchantrell/exiledb/internal/dat"
+	"github.com/jchantrell/exiledb/internal/database"
+	"github.com/jchantrell/exiledb/internal/poe"
+)
+
+// createViews rebuilds the _resolved view of every table in the database,
+// not only those this extract wrote, so views from earlier extracts pick up
+// references into tables added since. Tables are planned from the current
+// schema; one whose recorded layout no longer matches keeps its old view.
+func createViews(ctx context.Context, db *database.Database, schemas []dat.TableSchema, work []tableWork) error {
+	catalog, err := database.LoadCatalog(ctx, db)
+	if err != nil {
+		return fmt.Errorf("loading table catalog: %w", err)
+	}
+
+	var plans []*database.TablePlan
+	planned := make(map[string]bool)
+	for _, w := range work {
+		plans = append(plans, w.plan)
+		planned[w.plan.SQLName()] = true
+	}
+	for i := range schemas {
+		record := catalog[poe.ToSnakeCase(schemas[i].Name)]
+		if record == nil || planned[record.Name] {
+			continue
+		}
+		found, err := database.Plan(schemas[i:i+1], database.PlanOptions{MultiPatch: record.MultiPatch})
+		if err != nil || found[0].Signature() != record.Signature {
+			slog.Debug("Skipping view of table with a stale layout", "table", record.Name)
+			continue
+		}
+		plans = append(plans, found[0])
+		planned[record.Name] = true
+	}
+
+	created, err := database.CreateViews(ctx, db, plans)
+	if err != nil {
+		return fmt.Errorf("creating views: %w", err)
+	}
+	slog.Info("Created views", "count", created)
+	return nil
+}
@@ -0,0 +1,74 @@
+// Package output writes extracted tables to standalone files, one per table
+// and language, as an alternative to loading them into SQLite. Files use the
+// same column names as the SQLite tables, taken from the table's plan.
+package output
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jchantrell/exiledb/internal/database"
+)
+
+// Formats lists the file formats WriteTable accepts.
+var Formats = []string{"parquet", "ndjson", "csv"}
+
+// Table is one table's rows in one language.
+type Table struct {
+	Plan     *database.TablePlan
+	Language string
+	Patch    string
+	Rows     database.BatchSource
+}
+
+// Path returns the file a table's language is written to under dir:
+// <dir>/<language>/<table>.<format>, with the language lower-cased and
+// spaces replaced by underscores.
+func Path(dir, format string, plan *database.TablePlan, language string) string {
+	language = strings.ReplaceAll(strings.ToLower(language), " ", "_")
+	return filepath.Join(dir, language, plan.SQLName()+"."+format)
+}
+
+// WriteTable writes t to path in format and returns the number of rows
+// written. An existing file is only replaced once the new one is complete.
+func WriteTable(format, path string, t *Table) (int, error) {
+	var write func(io.Writer, *Table) (int, error)
+	switch format {
+	case "parquet":
+		write = writeParquet
+	case "ndjson":
+		write = writeNDJSON
+	case "csv":
+		write = writeCSV
+	default:
+		return 0, fmt.Errorf("unsupported output format %q (supported: %s)", format, strings.Join(Formats, ", "))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, fmt.Errorf("creating output directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return 0, fmt.Errorf("creating %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	rows, err := write(tmp, t)
+	if err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("writing %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("writing %s: %w", path, err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return 0, fmt.Errorf("writing %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, fmt.Errorf("renaming %s: %w", path, err)
+	}
+	return rows, nil
+}
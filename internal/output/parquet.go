@@ -0,0 +1,132 @@
+package output
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/jchantrell/exiledb/internal/dat"
+	"github.com/jchantrell/exiledb/internal/database"
+	"github.com/jchantrell/exiledb/internal/parquet"
+)
+
+// batchSize is how many rows are decoded at a time while writing a file.
+const batchSize = 1024
+
+// writeParquet writes the table as a single Parquet file. Column types follow
+// the SQLite mapping (INTEGER as int64, REAL as double, TEXT as string),
+// arrays become lists of their element type, and foreign keys are recorded
+// as table.column in each column's "exiledb.references" metadata. Readers
+// that only show the Arrow schema, like Polars, do not expose column chunk
+// metadata, so they are also recorded in the file metadata as
+// "exiledb.references.<column>".
+func writeParquet(w io.Writer, t *Table) (int, error) {
+	metadata := map[string]string{
+		"exiledb.table":    t.Plan.SchemaName(),
+		"exiledb.patch":    t.Patch,
+		"exiledb.language": t.Language,
+	}
+
+	var fields []parquet.Field
+	for _, name := range keyColumns(t.Plan) {
+		if name == database.IndexColumn {
+			fields = append(fields, parquet.Field{Name: name, Type: parquet.Int64})
+		} else {
+			fields = append(fields, parquet.Field{Name: name, Type: parquet.ByteArray, String: true})
+		}
+	}
+	keys := len(fields)
+
+	planFields := t.Plan.Fields()
+	for _, f := range planFields {
+		pf := parquet.Field{Name: f.Name, Optional: true, List: f.Array}
+		switch f.SQLType {
+		case "INTEGER":
+			pf.Type = parquet.Int64
+		case "REAL":
+			pf.Type = parquet.Double
+		default:
+			pf.Type, pf.String = parquet.ByteArray, true
+		}
+		if f.RefTable != "" {
+			ref := f.RefTable + "." + f.RefColumn
+			pf.Metadata = map[string]string{"exiledb.references": ref}
+			metadata["exiledb.references."+f.Name] = ref
+		}
+		fields = append(fields, pf)
+	}
+
+	pw, err := parquet.NewWriter(w, fields, metadata)
+	if err != nil {
+		return 0, err
+	}
+
+	batch := t.Rows.NewBatch()
+	written := 0
+	for n := t.Rows.ReadBatch(batch, batchSize); n > 0; n = t.Rows.ReadBatch(batch, batchSize) {
+		for row := range n {
+			i := 0
+			if t.Plan.MultiPatch() {
+				pw.Column(i).String(t.Patch)
+				i++
+			}
+			pw.Column(i).Int64(int64(batch.Start + row))
+			pw.Column(i + 1).String(t.Language)
+		}
+		for i, f := range planFields {
+			col, c := pw.Column(keys+i), &batch.Columns[f.Slot]
+			for row := range n {
+				if err := writeParquetValue(col, c, row); err != nil {
+					return 0, fmt.Errorf("column %s row %d: %w", f.Name, batch.Start+row, err)
+				}
+			}
+		}
+		if err := pw.EndRows(n); err != nil {
+			return 0, err
+		}
+		written += n
+	}
+
+	if err := pw.Close(); err != nil {
+		return 0, err
+	}
+	return written, nil
+}
+
+func writeParquetValue(col *parquet.Column, c *dat.Column, row int) error {
+	if c.IsNull(row) {
+		col.Null()
+		return nil
+	}
+	switch c.Kind {
+	case dat.KindInt:
+		col.Int64(c.Ints[row])
+	case dat.KindFloat:
+		col.Double(c.Floats[row])
+	case dat.KindString:
+		col.String(c.Strings[row])
+	case dat.KindArray:
+		writeParquetList(col, c, row)
+	default:
+		return fmt.Errorf("unsupported column kind %d", c.Kind)
+	}
+	return nil
+}
+
+// writeParquetList writes one row of an array column as a list. Bools are
+// 0 or 1 like scalar bools, and null row references are null elements.
+func writeParquetList(col *parquet.Column, c *dat.Column, row int) {
+	start, end := c.Elems(row)
+	col.List(end - start)
+	for j := start; j < end; j++ {
+		switch {
+		case c.ElemIsNull(j):
+			col.Null()
+		case c.Elem == dat.KindFloat:
+			col.Double(c.Floats[j])
+		case c.Elem == dat.KindString:
+			col.String(c.Strings[j])
+		default:
+			col.Int64(c.Ints[j])
+		}
+	}
+}
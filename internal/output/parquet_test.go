@@ -0,0 +1,139 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jchantrell/exiledb/internal/dat"
+	"github.com/jchantrell/exiledb/internal/database"
+)
+
+// readParquet prints a Parquet file's schema, file metadata and rows as JSON
+// using pyarrow.
+const readParquet = `
+import json, sys
+import pyarrow as pa, pyarrow.parquet as pq
+
+def describe(t):
+    if pa.types.is_list(t):
+        return "list<" + describe(t.value_type) + ">"
+    return str(t)
+
+f = pq.ParquetFile(sys.argv[1])
+table = f.read()
+print(json.dumps({
+    "schema": [[field.name, describe(field.type), field.nullable] for field in table.schema],
+    "metadata": {k.decode(): v.decode() for k, v in f.metadata.metadata.items()},
+    "rows": table.to_pylist(),
+}))
+`
+
+// TestParquetInterop reads writeParquet's output back with pyarrow, covering
+// every column kind and list element kind with values, nulls, empty lists and
+// null elements. It is skipped when python3 cannot import pyarrow.
+func TestParquetInterop(t *testing.T) {
+	if err := exec.Command("python3", "-c", "import pyarrow").Run(); err != nil {
+		t.Skip("python3 with pyarrow not available")
+	}
+
+	name := func(s string) *string { return &s }
+	schema := dat.TableSchema{Name: "SkillGems", Columns: []dat.TableColumn{
+		{Name: name("Id"), Type: dat.TypeString},
+		{Name: name("IsSupport"), Type: dat.TypeBool},
+		{Name: name("Level"), Type: dat.TypeInt32, Interval: true},
+		{Name: name("Hash"), Type: dat.TypeUint64},
+		{Name: name("Weight"), Type: dat.TypeFloat64},
+		{Name: name("BaseItemType"), Type: dat.TypeForeignRow, References: &dat.ColumnReference{Table: "BaseItemTypes"}},
+		{Name: name("Flags"), Type: dat.TypeBool, Array: true},
+		{Name: name("Costs"), Type: dat.TypeInt32, Array: true},
+		{Name: name("Scales"), Type: dat.TypeFloat32, Array: true},
+		{Name: name("Names"), Type: dat.TypeString, Array: true},
+		{Name: name("Tags"), Type: dat.TypeForeignRow, Array: true, References: &dat.ColumnReference{Table: "Tags"}},
+	}}
+	plans, err := database.Plan([]dat.TableSchema{schema}, database.PlanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Row 0 has values everywhere, row 1 nulls and empty lists, row 2 null
+	// lists.
+	batch := &dat.Batch{Len: 3, Columns: []dat.Column{
+		{Kind: dat.KindString, Strings: []string{"Fireball", "", "Ä€"}, Nulls: dat.Bitmap{0b010}},
+		{Kind: dat.KindInt, Ints: []int64{1, 0, 0}, Nulls: dat.Bitmap{0b010}},
+		{Kind: dat.KindInt, Ints: []int64{1, 0, -3}, Nulls: dat.Bitmap{0b010}},
+		{Kind: dat.KindInt, Ints: []int64{20, 0, 4}, Nulls: dat.Bitmap{0b010}},
+		{Kind: dat.KindInt, Ints: []int64{-1, 0, 1 << 62}, Nulls: dat.Bitmap{0b010}},
+		{Kind: dat.KindFloat, Floats: []float64{1.5, 0, -0.25}, Nulls: dat.Bitmap{0b010}},
+		{Kind: dat.KindInt, Ints: []int64{7, 0, 0}, Nulls: dat.Bitmap{0b110}},
+		{Kind: dat.KindArray, Type: dat.TypeBool, Elem: dat.KindInt, Ints: []int64{1, 0}, Offsets: []int{0, 2, 2, 2}, Nulls: dat.Bitmap{0b100}},
+		{Kind: dat.KindArray, Type: dat.TypeInt32, Elem: dat.KindInt, Ints: []int64{-5, 10, 15}, Offsets: []int{0, 3, 3, 3}, Nulls: dat.Bitmap{0b100}},
+		{Kind: dat.KindArray, Type: dat.TypeFloat32, Elem: dat.KindFloat, Floats: []float64{0.5, -2}, Offsets: []int{0, 2, 2, 2}, Nulls: dat.Bitmap{0b100}},
+		{Kind: dat.KindArray, Type: dat.TypeString, Elem: dat.KindString, Strings: []string{"fire", "", "spell"}, Offsets: []int{0, 3, 3, 3}, Nulls: dat.Bitmap{0b100}},
+		{Kind: dat.KindArray, Type: dat.TypeForeignRow, Elem: dat.KindInt, Ints: []int64{4, 0, 6}, Offsets: []int{0, 3, 3, 3}, ElemNulls: dat.Bitmap{0b010}, Nulls: dat.Bitmap{0b100}},
+	}}
+	table := &Table{Plan: plans[0], Language: "English", Patch: "3.25.0", Rows: dat.NewBatches(batch)}
+
+	path := filepath.Join(t.TempDir(), "skill_gems.parquet")
+	if n, err := WriteTable("parquet", path, table); err != nil || n != 3 {
+		t.Fatalf("WriteTable = %d, %v", n, err)
+	}
+
+	out, err := exec.Command("python3", "-c", readParquet, path).Output()
+	if exit, ok := err.(*exec.ExitError); ok {
+		t.Fatalf("reading %s with pyarrow: %v\n%s", path, err, exit.Stderr)
+	} else if err != nil {
+		t.Fatalf("reading %s with pyarrow: %v", path, err)
+	}
+
+	want := `{
+		"schema": [
+			["_index", "int64", false],
+			["_language", "string", false],
+			["id", "string", true],
+			["is_support", "int64", true],
+			["level_min", "int64", true],
+			["level_max", "int64", true],
+			["hash", "int64", true],
+			["weight", "double", true],
+			["base_item_type", "int64", true],
+			["flags", "list<int64>", true],
+			["costs", "list<int64>", true],
+			["scales", "list<double>", true],
+			["names", "list<string>", true],
+			["tags", "list<int64>", true]
+		],
+		"metadata": {"exiledb.table": "SkillGems", "exiledb.patch": "3.25.0", "exiledb.language": "English",
+			"exiledb.references.base_item_type": "base_item_types._index", "exiledb.references.tags": "tags._index"},
+		"rows": [
+			{"_index": 0, "_language": "English", "id": "Fireball", "is_support": 1, "level_min": 1, "level_max": 20,
+			 "hash": -1, "weight": 1.5, "base_item_type": 7, "flags": [1, 0], "costs": [-5, 10, 15],
+			 "scales": [0.5, -2.0], "names": ["fire", "", "spell"], "tags": [4, null, 6]},
+			{"_index": 1, "_language": "English", "id": null, "is_support": null, "level_min": null, "level_max": null,
+			 "hash": null, "weight": null, "base_item_type": null, "flags": [], "costs": [],
+			 "scales": [], "names": [], "tags": []},
+			{"_index": 2, "_language": "English", "id": "Ä€", "is_support": 0, "level_min": -3, "level_max": 4,
+			 "hash": 4611686018427387904, "weight": -0.25, "base_item_type": null, "flags": null, "costs": null,
+			 "scales": null, "names": null, "tags": null}
+		]
+	}`
+	if got, want := decodeJSON(t, out), decodeJSON(t, []byte(want)); !reflect.DeepEqual(got, want) {
+		t.Errorf("pyarrow read:\n%s\nwant:\n%v", out, want)
+	}
+}
+
+// decodeJSON decodes data keeping numbers exact, so large integers compare
+// correctly. Floats must be written as Python prints them.
+func decodeJSON(t *testing.T, data []byte) any {
+	t.Helper()
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		t.Fatalf("decoding %s: %v", data, err)
+	}
+	return v
+}
@@ -0,0 +1,174 @@
+package output
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/jchantrell/exiledb/internal/dat"
+	"github.com/jchantrell/exiledb/internal/database"
+)
+
+// keyColumns names the columns exiledb adds before the schema's own, in
+// SQLite table order.
+func keyColumns(plan *database.TablePlan) []string {
+	if plan.MultiPatch() {
+		return []string{database.PatchColumn, database.IndexColumn, database.LanguageColumn}
+	}
+	return []string{database.IndexColumn, database.LanguageColumn}
+}
+
+// writeNDJSON writes one JSON object per row, keys in column order. Arrays,
+// including those SQLite keeps in junction tables, are inlined as JSON
+// arrays; nulls and non-finite floats are null.
+func writeNDJSON(w io.Writer, t *Table) (int, error) {
+	bw := bufio.NewWriter(w)
+	fields := t.Plan.Fields()
+
+	// Only _index varies among the key columns, so the rest of each row's
+	// prefix is encoded once.
+	head := []byte("{")
+	if t.Plan.MultiPatch() {
+		head = appendJSONString(head, database.PatchColumn)
+		head = appendJSONString(append(head, ':'), t.Patch)
+		head = append(head, ',')
+	}
+	head = append(appendJSONString(head, database.IndexColumn), ':')
+	tail := appendJSONString([]byte(","), database.LanguageColumn)
+	tail = appendJSONString(append(tail, ':'), t.Language)
+
+	names := make([][]byte, len(fields))
+	for i, f := range fields {
+		names[i] = append(appendJSONString([]byte(","), f.Name), ':')
+	}
+
+	var line []byte
+	batch := t.Rows.NewBatch()
+	written := 0
+	for n := t.Rows.ReadBatch(batch, batchSize); n > 0; n = t.Rows.ReadBatch(batch, batchSize) {
+		for row := range n {
+			line = append(line[:0], head...)
+			line = strconv.AppendInt(line, int64(batch.Start+row), 10)
+			line = append(line, tail...)
+
+			for i, f := range fields {
+				line = append(line, names[i]...)
+				var err error
+				line, err = appendJSONValue(line, &batch.Columns[f.Slot], row)
+				if err != nil {
+					return 0, fmt.Errorf("column %s row %d: %w", f.Name, batch.Start+row, err)
+				}
+			}
+			line = append(line, '}', '\n')
+			if _, err := bw.Write(line); err != nil {
+				return 0, err
+			}
+		}
+		written += n
+	}
+
+	if err := bw.Flush(); err != nil {
+		return 0, err
+	}
+	return written, nil
+}
+
+// writeCSV writes a header row of column names, then one record per row.
+// Nulls are empty fields and arrays are JSON strings, matching how SQLite
+// stores non-reference arrays.
+func writeCSV(w io.Writer, t *Table) (int, error) {
+	cw := csv.NewWriter(w)
+	fields := t.Plan.Fields()
+
+	header := keyColumns(t.Plan)
+	keys := len(header)
+	for _, f := range fields {
+		header = append(header, f.Name)
+	}
+	if err := cw.Write(header); err != nil {
+		return 0, err
+	}
+
+	record := make([]string, len(header))
+	batch := t.Rows.NewBatch()
+	written := 0
+	for n := t.Rows.ReadBatch(batch, batchSize); n > 0; n = t.Rows.ReadBatch(batch, batchSize) {
+		for row := range n {
+			k := 0
+			if t.Plan.MultiPatch() {
+				record[k] = t.Patch
+				k++
+			}
+			record[k] = strconv.Itoa(batch.Start + row)
+			record[k+1] = t.Language
+
+			for i, f := range fields {
+				value, err := csvValue(&batch.Columns[f.Slot], row)
+				if err != nil {
+					return 0, fmt.Errorf("column %s row %d: %w", f.Name, batch.Start+row, err)
+				}
+				record[keys+i] = value
+			}
+			if err := cw.Write(record); err != nil {
+				return 0, err
+			}
+		}
+		written += n
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return 0, err
+	}
+	return written, nil
+}
+
+func appendJSONValue(buf []byte, c *dat.Column, row int) ([]byte, error) {
+	if c.IsNull(row) {
+		return append(buf, "null"...), nil
+	}
+	switch c.Kind {
+	case dat.KindInt:
+		return strconv.AppendInt(buf, c.Ints[row], 10), nil
+	case dat.KindFloat:
+		return appendJSONFloat(buf, c.Floats[row], 64), nil
+	case dat.KindString:
+		return appendJSONString(buf, c.Strings[row]), nil
+	case dat.KindArray:
+		return c.AppendJSON(buf, row), nil
+	}
+	return nil, fmt.Errorf("unsupported column kind %d", c.Kind)
+}
+
+func csvValue(c *dat.Column, row int) (string, error) {
+	if c.IsNull(row) {
+		return "", nil
+	}
+	switch c.Kind {
+	case dat.KindInt:
+		return strconv.FormatInt(c.Ints[row], 10), nil
+	case dat.KindFloat:
+		return strconv.FormatFloat(c.Floats[row], 'g', -1, 64), nil
+	case dat.KindString:
+		return c.Strings[row], nil
+	case dat.KindArray:
+		return string(c.AppendJSON(nil, row)), nil
+	}
+	return "", fmt.Errorf("unsupported column kind %d", c.Kind)
+}
+
+func appendJSONFloat(buf []byte, v float64, bitSize int) []byte {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return append(buf, "null"...)
+	}
+	return strconv.AppendFloat(buf, v, 'g', -1, bitSize)
+}
+
+func appendJSONString(buf []byte, s string) []byte {
+	b, _ := json.Marshal(s) // Marshaling a string cannot fail
+	return append(buf, b...)
+}
@@ -0,0 +1,86 @@
+package output
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/jchantrell/exiledb/internal/dat"
+	"github.com/jchantrell/exiledb/internal/database"
+)
+
+func testTable(t *testing.T) *Table {
+	t.Helper()
+	name := func(s string) *string { return &s }
+	schema := dat.TableSchema{Name: "SkillGems", Columns: []dat.TableColumn{
+		{Name: name("Id"), Type: dat.TypeString},
+		{Name: name("Level"), Type: dat.TypeInt32, Interval: true},
+		{Name: name("BaseItemType"), Type: dat.TypeForeignRow, References: &dat.ColumnReference{Table: "BaseItemTypes"}},
+		{Name: name("Tags"), Type: dat.TypeForeignRow, Array: true, References: &dat.ColumnReference{Table: "Tags"}},
+		{Name: name("Weight"), Type: dat.TypeFloat32},
+	}}
+	plans, err := database.Plan([]dat.TableSchema{schema}, database.PlanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch := &dat.Batch{Len: 2, Columns: []dat.Column{
+		{Kind: dat.KindString, Strings: []string{"Fireball", `Say "hi", twice`}, Nulls: dat.Bitmap{0}},
+		{Kind: dat.KindInt, Ints: []int64{1, 2}, Nulls: dat.Bitmap{0}},
+		{Kind: dat.KindInt, Ints: []int64{20, 21}, Nulls: dat.Bitmap{0}},
+		{Kind: dat.KindInt, Ints: []int64{7, 0}, Nulls: dat.Bitmap{0b10}},
+		{Kind: dat.KindArray, Type: dat.TypeForeignRow, Elem: dat.KindInt, Ints: []int64{4, 0}, Offsets: []int{0, 2, 2}, ElemNulls: dat.Bitmap{0b10}, Nulls: dat.Bitmap{0}},
+		{Kind: dat.KindFloat, Floats: []float64{1.5, 0}, Nulls: dat.Bitmap{0b10}},
+	}}
+	return &Table{Plan: plans[0], Language: "English", Patch: "3.25.0", Rows: dat.NewBatches(batch)}
+}
+
+func TestWriteNDJSON(t *testing.T) {
+	var out bytes.Buffer
+	n, err := writeNDJSON(&out, testTable(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"_index":0,"_language":"English","id":"Fireball","level_min":1,"level_max":20,"base_item_type":7,"tags":[4,null],"weight":1.5}
+{"_index":1,"_language":"English","id":"Say \"hi\", twice","level_min":2,"level_max":21,"base_item_type":null,"tags":[],"weight":null}
+`
+	if n != 2 || out.String() != want {
+		t.Errorf("writeNDJSON wrote %d rows:\n%s\nwant:\n%s", n, out.String(), want)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var out bytes.Buffer
+	n, err := writeCSV(&out, testTable(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `_index,_language,id,level_min,level_max,base_item_type,tags,weight
+0,English,Fireball,1,20,7,"[4,null]",1.5
+1,English,"Say ""hi"", twice",2,21,,[],
+`
+	if n != 2 || out.String() != want {
+		t.Errorf("writeCSV wrote %d rows:\n%s\nwant:\n%s", n, out.String(), want)
+	}
+}
+
+func TestNonFiniteFloatArrays(t *testing.T) {
+	c := &dat.Column{
+		Kind:    dat.KindArray,
+		Type:    dat.TypeFloat64,
+		Elem:    dat.KindFloat,
+		Floats:  []float64{1.5, math.NaN(), math.Inf(1), math.Inf(-1), 0.1},
+		Offsets: []int{0, 3, 5},
+		Nulls:   dat.Bitmap{0},
+	}
+
+	for row, want := range []string{"[1.5,null,null]", "[null,0.1]"} {
+		got, err := appendJSONValue(nil, c, row)
+		if err != nil || string(got) != want {
+			t.Errorf("appendJSONValue row %d = %s, %v; want %s", row, got, err, want)
+		}
+		if got, err := csvValue(c, row); err != nil || got != want {
+			t.Errorf("csvValue row %d = %s, %v; want %s", row, got, err, want)
+		}
+	}
+}
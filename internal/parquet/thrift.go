@@ -0,0 +1,90 @@
+package parquet
+
+import "encoding/binary"
+
+// Thrift compact protocol type ids, as used in field and list headers.
+const (
+	compactI32    = 5
+	compactI64    = 6
+	compactBinary = 8
+	compactList   = 9
+	compactStruct = 12
+)
+
+// encoder writes the Thrift compact protocol, which Parquet uses for page
+// headers and the file footer. Only the types those structures need are
+// supported. Field ids are delta-encoded against the previous field of the
+// enclosing struct, so nested structs save and restore that position.
+type encoder struct {
+	buf   []byte
+	last  int16
+	stack []int16
+}
+
+func (e *encoder) varint(v uint64) {
+	e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+func (e *encoder) zigzag(v int64) {
+	e.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (e *encoder) field(id int16, typ byte) {
+	if delta := id - e.last; delta > 0 && delta <= 15 {
+		e.buf = append(e.buf, byte(delta)<<4|typ)
+	} else {
+		e.buf = append(e.buf, typ)
+		e.zigzag(int64(id))
+	}
+	e.last = id
+}
+
+func (e *encoder) structBegin() {
+	e.stack = append(e.stack, e.last)
+	e.last = 0
+}
+
+func (e *encoder) structEnd() {
+	e.buf = append(e.buf, 0) // field stop
+	e.last = e.stack[len(e.stack)-1]
+	e.stack = e.stack[:len(e.stack)-1]
+}
+
+func (e *encoder) listBegin(elemType byte, n int) {
+	if n < 15 {
+		e.buf = append(e.buf, byte(n)<<4|elemType)
+		return
+	}
+	e.buf = append(e.buf, 0xf0|elemType)
+	e.varint(uint64(n))
+}
+
+func (e *encoder) binary(s string) {
+	e.varint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) i32Field(id int16, v int32) {
+	e.field(id, compactI32)
+	e.zigzag(int64(v))
+}
+
+func (e *encoder) i64Field(id int16, v int64) {
+	e.field(id, compactI64)
+	e.zigzag(v)
+}
+
+func (e *encoder) stringField(id int16, s string) {
+	e.field(id, compactBinary)
+	e.binary(s)
+}
+
+func (e *encoder) structField(id int16) {
+	e.field(id, compactStruct)
+	e.structBegin()
+}
+
+func (e *encoder) listField(id int16, elemType byte, n int) {
+	e.field(id, compactList)
+	e.listBegin(elemType, n)
+}
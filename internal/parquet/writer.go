@@ -0,0 +1,488 @@
+// Package parquet writes Apache Parquet files. It covers what table exports
+// need and nothing more: flat columns of int64, double and byte array values,
+// optional values and lists of optional elements, PLAIN encoding, no
+// compression, and key-value metadata on the file and on each column.
+package parquet
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"math/bits"
+	"slices"
+)
+
+var magic = []byte("PAR1")
+
+// rowGroupBytes is the buffered value size at which a row group is flushed.
+const rowGroupBytes = 64 << 20
+
+// Type is a Parquet physical type.
+type Type int32
+
+const (
+	Int64     Type = 2
+	Double    Type = 5
+	ByteArray Type = 6
+)
+
+// Parquet enum values used in the footer.
+const (
+	repetitionRequired = 0
+	repetitionOptional = 1
+	repetitionRepeated = 2
+
+	convertedUTF8 = 0
+	convertedList = 3
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	pageTypeData = 0
+)
+
+// Field describes one top-level column. A List field is an optional list of
+// optional elements of Type, written with the standard three-level LIST
+// layout. Metadata is recorded on the column chunk.
+type Field struct {
+	Name     string
+	Type     Type
+	String   bool // annotate byte arrays as UTF-8 strings
+	Optional bool
+	List     bool
+	Metadata map[string]string
+}
+
+// Writer streams rows to a Parquet file column by column. Values for each
+// column are appended through Column, then EndRows marks how many rows were
+// appended; every column must have received exactly that many.
+type Writer struct {
+	out      *bufio.Writer
+	offset   int64
+	fields   []Field
+	columns  []*Column
+	metadata map[string]string
+
+	rows      int64 // rows in the buffered row group
+	totalRows int64
+	rowGroups []rowGroup
+	err       error
+}
+
+type rowGroup struct {
+	rows   int64
+	bytes  int64
+	chunks []columnChunk
+}
+
+type columnChunk struct {
+	offset    int64
+	size      int64
+	numValues int64
+}
+
+// NewWriter writes the file header to w and returns a writer for fields.
+// File-level metadata is written to the footer on Close.
+func NewWriter(w io.Writer, fields []Field, metadata map[string]string) (*Writer, error) {
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("parquet: no fields")
+	}
+
+	pw := &Writer{
+		out:      bufio.NewWriter(w),
+		fields:   fields,
+		metadata: metadata,
+	}
+	for i := range fields {
+		c := &Column{field: &fields[i]}
+		switch {
+		case fields[i].List:
+			c.maxDef, c.maxRep = 3, 1
+		case fields[i].Optional:
+			c.maxDef = 1
+		}
+		pw.columns = append(pw.columns, c)
+	}
+
+	pw.write(magic)
+	return pw, pw.err
+}
+
+// Column returns the column for field i.
+func (w *Writer) Column(i int) *Column {
+	return w.columns[i]
+}
+
+// EndRows records that n more rows were appended to every column, flushing
+// a row group once enough data is buffered.
+func (w *Writer) EndRows(n int) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.rows += int64(n)
+
+	buffered := 0
+	for i, c := range w.columns {
+		if c.err != nil {
+			return fmt.Errorf("parquet: column %s: %w", w.fields[i].Name, c.err)
+		}
+		if c.rows != w.rows || c.elems != 0 {
+			return fmt.Errorf("parquet: column %s has %d rows, expected %d", w.fields[i].Name, c.rows, w.rows)
+		}
+		buffered += len(c.values)
+	}
+
+	if buffered >= rowGroupBytes {
+		w.flushRowGroup()
+	}
+	return w.err
+}
+
+// Close flushes buffered rows and writes the footer. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.rows > 0 {
+		w.flushRowGroup()
+	}
+
+	footer := w.footer()
+	w.write(footer)
+	w.write(binary.LittleEndian.AppendUint32(nil, uint32(len(footer))))
+	w.write(magic)
+	if w.err != nil {
+		return w.err
+	}
+	return w.out.Flush()
+}
+
+func (w *Writer) write(b []byte) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.out.Write(b)
+	w.offset += int64(n)
+	w.err = err
+}
+
+// flushRowGroup writes each column's buffered values as a single data page.
+func (w *Writer) flushRowGroup() {
+	group := rowGroup{rows: w.rows}
+	for _, c := range w.columns {
+		var page []byte
+		if c.maxRep > 0 {
+			page = appendLevels(page, c.reps, c.maxRep)
+		}
+		if c.maxDef > 0 {
+			page = appendLevels(page, c.defs, c.maxDef)
+		}
+		page = append(page, c.values...)
+
+		numValues := c.rows
+		if c.maxDef > 0 {
+			numValues = int64(len(c.defs))
+		}
+
+		header := pageHeader(numValues, len(page))
+		chunk := columnChunk{
+			offset:    w.offset,
+			size:      int64(len(header) + len(page)),
+			numValues: numValues,
+		}
+		w.write(header)
+		w.write(page)
+
+		group.chunks = append(group.chunks, chunk)
+		group.bytes += chunk.size
+		c.reset()
+	}
+
+	w.rowGroups = append(w.rowGroups, group)
+	w.totalRows += w.rows
+	w.rows = 0
+}
+
+// appendLevels encodes repetition or definition levels with the RLE/bit-packed
+// hybrid encoding, using RLE runs only, behind the 4-byte length prefix data
+// page v1 requires.
+func appendLevels(buf []byte, levels []uint8, maxLevel int) []byte {
+	width := (bits.Len(uint(maxLevel)) + 7) / 8
+	start := len(buf)
+	buf = append(buf, 0, 0, 0, 0)
+	for i := 0; i < len(levels); {
+		j := i + 1
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		buf = binary.AppendUvarint(buf, uint64(j-i)<<1)
+		buf = append(buf, levels[i])
+		for range width - 1 {
+			buf = append(buf, 0)
+		}
+		i = j
+	}
+	binary.LittleEndian.PutUint32(buf[start:], uint32(len(buf)-start-4))
+	return buf
+}
+
+func pageHeader(numValues int64, size int) []byte {
+	var e encoder
+	e.structBegin()
+	e.i32Field(1, pageTypeData)
+	e.i32Field(2, int32(size)) // uncompressed
+	e.i32Field(3, int32(size)) // compressed
+	e.structField(5)
+	e.i32Field(1, int32(numValues))
+	e.i32Field(2, encodingPlain)
+	e.i32Field(3, encodingRLE)
+	e.i32Field(4, encodingRLE)
+	e.structEnd()
+	e.structEnd()
+	return e.buf
+}
+
+func (w *Writer) footer() []byte {
+	var e encoder
+	e.structBegin()
+	e.i32Field(1, 1) // version
+
+	e.listField(2, compactStruct, 1+w.schemaElements())
+	e.structBegin()
+	e.stringField(4, "schema")
+	e.i32Field(5, int32(len(w.fields)))
+	e.structEnd()
+	for i := range w.fields {
+		writeSchema(&e, &w.fields[i])
+	}
+
+	e.i64Field(3, w.totalRows)
+
+	e.listField(4, compactStruct, len(w.rowGroups))
+	for _, group := range w.rowGroups {
+		e.structBegin()
+		e.listField(1, compactStruct, len(group.chunks))
+		for i, chunk := range group.chunks {
+			w.writeChunk(&e, &w.fields[i], w.columns[i], chunk)
+		}
+		e.i64Field(2, group.bytes)
+		e.i64Field(3, group.rows)
+		e.structEnd()
+	}
+
+	if len(w.metadata) > 0 {
+		writeKeyValues(&e, 5, w.metadata)
+	}
+	e.stringField(6, "exiledb")
+	e.structEnd()
+	return e.buf
+}
+
+func (w *Writer) schemaElements() int {
+	n := 0
+	for i := range w.fields {
+		n++
+		if w.fields[i].List {
+			n += 2
+		}
+	}
+	return n
+}
+
+func writeSchema(e *encoder, f *Field) {
+	if !f.List {
+		repetition := int32(repetitionRequired)
+		if f.Optional {
+			repetition = repetitionOptional
+		}
+		writeLeaf(e, f, f.Name, repetition)
+		return
+	}
+
+	e.structBegin()
+	e.i32Field(3, repetitionOptional)
+	e.stringField(4, f.Name)
+	e.i32Field(5, 1)
+	e.i32Field(6, convertedList)
+	e.structField(10)
+	e.structField(3) // ListType
+	e.structEnd()
+	e.structEnd()
+	e.structEnd()
+
+	e.structBegin()
+	e.i32Field(3, repetitionRepeated)
+	e.stringField(4, "list")
+	e.i32Field(5, 1)
+	e.structEnd()
+
+	writeLeaf(e, f, "element", repetitionOptional)
+}
+
+func writeLeaf(e *encoder, f *Field, name string, repetition int32) {
+	e.structBegin()
+	e.i32Field(1, int32(f.Type))
+	e.i32Field(3, repetition)
+	e.stringField(4, name)
+	if f.String {
+		e.i32Field(6, convertedUTF8)
+		e.structField(10)
+		e.structField(1) // StringType
+		e.structEnd()
+		e.structEnd()
+	}
+	e.structEnd()
+}
+
+func (w *Writer) writeChunk(e *encoder, f *Field, c *Column, chunk columnChunk) {
+	e.structBegin()
+	e.i64Field(2, chunk.offset)
+	e.structField(3)
+
+	e.i32Field(1, int32(f.Type))
+	encodings := []int32{encodingPlain}
+	if c.maxDef > 0 {
+		encodings = append(encodings, encodingRLE)
+	}
+	e.listField(2, compactI32, len(encodings))
+	for _, enc := range encodings {
+		e.zigzag(int64(enc))
+	}
+	path := []string{f.Name}
+	if f.List {
+		path = append(path, "list", "element")
+	}
+	e.listField(3, compactBinary, len(path))
+	for _, p := range path {
+		e.binary(p)
+	}
+	e.i32Field(4, 0) // uncompressed
+	e.i64Field(5, chunk.numValues)
+	e.i64Field(6, chunk.size)
+	e.i64Field(7, chunk.size)
+	if len(f.Metadata) > 0 {
+		writeKeyValues(e, 8, f.Metadata)
+	}
+	e.i64Field(9, chunk.offset)
+
+	e.structEnd()
+	e.structEnd()
+}
+
+func writeKeyValues(e *encoder, id int16, kv map[string]string) {
+	e.listField(id, compactStruct, len(kv))
+	for _, key := range slices.Sorted(maps.Keys(kv)) {
+		e.structBegin()
+		e.stringField(1, key)
+		e.stringField(2, kv[key])
+		e.structEnd()
+	}
+}
+
+// Column buffers one field's values for the current row group. Each row is
+// one value or Null; for list fields it is List followed by that many
+// element values or Nulls, or Null for a null list.
+type Column struct {
+	field          *Field
+	maxDef, maxRep int
+
+	defs   []uint8
+	reps   []uint8
+	values []byte
+	rows   int64
+	elems  int  // elements still expected by the open list
+	first  bool // next element starts its list
+	err    error
+}
+
+func (c *Column) reset() {
+	c.defs = c.defs[:0]
+	c.reps = c.reps[:0]
+	c.values = c.values[:0]
+	c.rows = 0
+}
+
+// List starts a row holding a list of n elements.
+func (c *Column) List(n int) {
+	if !c.field.List || c.elems != 0 {
+		c.err = fmt.Errorf("unexpected list")
+		return
+	}
+	c.rows++
+	if n == 0 {
+		c.level(1, 0)
+		return
+	}
+	c.elems = n
+	c.first = true
+}
+
+// Null appends a null value, null list element, or null list.
+func (c *Column) Null() {
+	switch {
+	case c.elems > 0:
+		c.element(2)
+	case c.field.List:
+		c.rows++
+		c.level(0, 0)
+	case c.field.Optional:
+		c.rows++
+		c.level(0, 0)
+	default:
+		c.err = fmt.Errorf("null in required column")
+	}
+}
+
+// Int64 appends an int64 value or list element.
+func (c *Column) Int64(v int64) {
+	c.present()
+	c.values = binary.LittleEndian.AppendUint64(c.values, uint64(v))
+}
+
+// Double appends a double value or list element.
+func (c *Column) Double(v float64) {
+	c.present()
+	c.values = binary.LittleEndian.AppendUint64(c.values, math.Float64bits(v))
+}
+
+// String appends a byte array value or list element.
+func (c *Column) String(s string) {
+	c.present()
+	c.values = binary.LittleEndian.AppendUint32(c.values, uint32(len(s)))
+	c.values = append(c.values, s...)
+}
+
+func (c *Column) present() {
+	switch {
+	case c.elems > 0:
+		c.element(3)
+	case c.field.List:
+		c.err = fmt.Errorf("value outside a list")
+	default:
+		c.rows++
+		if c.maxDef > 0 {
+			c.level(1, 0)
+		}
+	}
+}
+
+func (c *Column) element(def uint8) {
+	rep := uint8(1)
+	if c.first {
+		rep = 0
+		c.first = false
+	}
+	c.level(def, rep)
+	c.elems--
+}
+
+func (c *Column) level(def, rep uint8) {
+	c.defs = append(c.defs, def)
+	if c.maxRep > 0 {
+		c.reps = append(c.reps, rep)
+	}
+}
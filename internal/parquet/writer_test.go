@@ -0,0 +1,172 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// decoder reads Thrift compact structs into field id -> value maps, just
+// enough to check what Writer produces.
+type decoder struct {
+	buf []byte
+	pos int
+}
+
+func (d *decoder) varint() uint64 {
+	v, n := binary.Uvarint(d.buf[d.pos:])
+	d.pos += n
+	return v
+}
+
+func (d *decoder) zigzag() int64 {
+	v := d.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (d *decoder) value(typ byte) any {
+	switch typ {
+	case compactI32, compactI64:
+		return d.zigzag()
+	case compactBinary:
+		n := int(d.varint())
+		s := string(d.buf[d.pos : d.pos+n])
+		d.pos += n
+		return s
+	case compactList:
+		header := d.buf[d.pos]
+		d.pos++
+		n := int(header >> 4)
+		if n == 15 {
+			n = int(d.varint())
+		}
+		list := make([]any, n)
+		for i := range list {
+			list[i] = d.value(header & 0x0f)
+		}
+		return list
+	case compactStruct:
+		return d.structure()
+	}
+	panic("unsupported type")
+}
+
+func (d *decoder) structure() map[int16]any {
+	fields := make(map[int16]any)
+	var last int16
+	for {
+		header := d.buf[d.pos]
+		d.pos++
+		if header == 0 {
+			return fields
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(d.zigzag())
+		}
+		fields[id] = d.value(header & 0x0f)
+		last = id
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var out bytes.Buffer
+	w, err := NewWriter(&out, []Field{
+		{Name: "id", Type: Int64},
+		{Name: "name", Type: ByteArray, String: true, Optional: true},
+		{Name: "refs", Type: Int64, List: true, Metadata: map[string]string{"references": "mods._index"}},
+		{Name: "weight", Type: Double, Optional: true},
+	}, map[string]string{"patch": "3.25.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Row 0: full values and a two element list with a null element.
+	// Row 1: nulls, and an empty list. Row 2: a null list.
+	w.Column(0).Int64(7)
+	w.Column(0).Int64(8)
+	w.Column(0).Int64(9)
+	w.Column(1).String("Fireball")
+	w.Column(1).Null()
+	w.Column(1).String("")
+	w.Column(2).List(2)
+	w.Column(2).Int64(4)
+	w.Column(2).Null()
+	w.Column(2).List(0)
+	w.Column(2).Null()
+	w.Column(3).Double(1.5)
+	w.Column(3).Null()
+	w.Column(3).Null()
+	if err := w.EndRows(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := out.Bytes()
+	if !bytes.Equal(data[:4], magic) || !bytes.Equal(data[len(data)-4:], magic) {
+		t.Fatal("missing PAR1 magic")
+	}
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := (&decoder{buf: data[len(data)-8-footerLen : len(data)-8]}).structure()
+
+	if footer[3] != int64(3) {
+		t.Errorf("num_rows = %v, want 3", footer[3])
+	}
+	var names []string
+	for _, element := range footer[2].([]any) {
+		names = append(names, element.(map[int16]any)[4].(string))
+	}
+	if want := []string{"schema", "id", "name", "refs", "list", "element", "weight"}; !equal(names, want) {
+		t.Errorf("schema names = %v, want %v", names, want)
+	}
+
+	chunks := footer[4].([]any)[0].(map[int16]any)[1].([]any)
+	refs := chunks[2].(map[int16]any)[3].(map[int16]any)
+	if refs[5] != int64(4) {
+		t.Errorf("refs num_values = %v, want 4", refs[5])
+	}
+	kv := refs[8].([]any)[0].(map[int16]any)
+	if kv[1] != "references" || kv[2] != "mods._index" {
+		t.Errorf("refs metadata = %v", kv)
+	}
+
+	// The weight page holds one definition level run per value change
+	// followed by the single non-null double.
+	weight := chunks[3].(map[int16]any)[3].(map[int16]any)
+	d := &decoder{buf: data, pos: int(weight[9].(int64))}
+	header := d.structure()
+	page := data[d.pos : d.pos+int(header[3].(int64))]
+	levelsLen := int(binary.LittleEndian.Uint32(page))
+	if want := []byte{1 << 1, 1, 2 << 1, 0}; !bytes.Equal(page[4:4+levelsLen], want) {
+		t.Errorf("definition levels = %v, want %v", page[4:4+levelsLen], want)
+	}
+	if v := math.Float64frombits(binary.LittleEndian.Uint64(page[4+levelsLen:])); v != 1.5 {
+		t.Errorf("weight value = %v, want 1.5", v)
+	}
+}
+
+func TestWriterRowCountMismatch(t *testing.T) {
+	w, err := NewWriter(&bytes.Buffer{}, []Field{{Name: "a", Type: Int64}, {Name: "b", Type: Int64}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Column(0).Int64(1)
+	if err := w.EndRows(1); err == nil {
+		t.Fatal("expected error for column b missing a row")
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
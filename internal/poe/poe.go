@@ -40,6 +40,41 @@ func ParseGameVersion(version string) (int, error) {
 	return majorVersion, nil
 }
 
+// CompareVersions orders two dotted patch versions numerically, part by
+// part, treating missing trailing parts as zero: 3.25 equals 3.25.0.0 and
+// precedes 3.25.0.1. It returns -1, 0 or 1.
+func CompareVersions(a, b string) (int, error) {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := range max(len(as), len(bs)) {
+		x, err := versionPart(as, i, a)
+		if err != nil {
+			return 0, err
+		}
+		y, err := versionPart(bs, i, b)
+		if err != nil {
+			return 0, err
+		}
+		if x != y {
+			if x < y {
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func versionPart(parts []string, i int, version string) (int, error) {
+	if i >= len(parts) {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(parts[i])
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid version %q", version)
+	}
+	return n, nil
+}
+
 func IsPoE2(version string) bool {
 	major, err := ParseGameVersion(version)
 	if err != nil {